@@ -0,0 +1,139 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package application
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
+
+// AdminSessionID is used in place of a session id for operations that are not triggered by a session.
+const AdminSessionID = "admin"
+
+// SessionSummary describes a connected session.
+type SessionSummary struct {
+	ID         string
+	RemoteAddr string
+	// UserName is empty if the session is not logged in.
+	UserName string
+	RoomName string
+}
+
+// UserSummary describes a user account.
+type UserSummary struct {
+	Name     string
+	Role     domain.Role
+	LoggedIn bool
+	// LockedUntil is the time until which logins are blocked after failed logins, it is the zero time if they are not.
+	LockedUntil time.Time
+}
+
+// ListSessions returns all connected sessions sorted by their id.
+func (c BasicChatService) ListSessions() []SessionSummary {
+	sessions := make([]SessionSummary, 0)
+	for _, session := range c.sessionRepository.GetAll() {
+		sessions = append(sessions, SessionSummary{
+			ID:         session.ID,
+			RemoteAddr: session.RemoteAddr,
+			UserName:   c.GetUserNameForSessionID(session.ID),
+			RoomName:   c.GetRoomNameForSessionID(session.ID),
+		})
+	}
+	sort.Slice(sessions, func(a, b int) bool { return sessions[a].ID < sessions[b].ID })
+	return sessions
+}
+
+// ListUsers returns all user accounts sorted by their name.
+func (c BasicChatService) ListUsers() []UserSummary {
+	users := make([]UserSummary, 0)
+	for _, user := range c.userRepository.GetAll() {
+		users = append(users, UserSummary{
+			Name:        user.Name,
+			Role:        user.Role,
+			LoggedIn:    len(c.userSessionRepository.FindByUserID(user.ID)) > 0,
+			LockedUntil: c.lockedUntil(user.ID),
+		})
+	}
+	sort.Slice(users, func(a, b int) bool { return users[a].Name < users[b].Name })
+	return users
+}
+
+// Broadcast sends an announcement from the server to all connected sessions.
+func (c BasicChatService) Broadcast(message string) {
+	for _, session := range c.sessionRepository.GetAll() {
+		c.SendMessageToSessionFromServer(session.ID, fmt.Sprintf("Announcement: %s", message))
+	}
+	slog.Info("broadcast announcement", "message", message)
+}
+
+// DisconnectSession closes the session with the given id.
+func (c BasicChatService) DisconnectSession(sessionID string) error {
+	if _, sessionExists := c.sessionRepository.FindByID(sessionID); !sessionExists {
+		return NewErrSessionDoesNotExist(AdminSessionID, sessionID)
+	}
+	c.SendMessageToSessionFromServer(sessionID, "You were disconnected by an administrator")
+	c.QuitSession(sessionID)
+	slog.Info("disconnected session", "sessionID", sessionID)
+	return nil
+}
+
+// ResetPassword sets a new password for the user with the given name without knowing the old password.
+func (c BasicChatService) ResetPassword(userName, newPassword string) error {
+	user, userExists := c.userRepository.FindByName(userName)
+	if !userExists {
+		return NewErrUserDoesNotExist(AdminSessionID, userName)
+	}
+	if err := c.checkPassword(AdminSessionID, user.Name, newPassword); err != nil {
+		return err
+	}
+	if err := user.SetPassword(newPassword); err != nil {
+		return NewErrPasswordIsInvalid(AdminSessionID)
+	}
+	if !c.userRepository.SetPasswordHash(user.ID, user.PasswordHash()) {
+		return fmt.Errorf("could not update user, userID: %s", user.ID)
+	}
+	slog.Info("reset password", "userName", userName)
+	return nil
+}
+
+// UnlockUser forgets the failed logins of the user with the given name, so that it can log in again right away.
+func (c BasicChatService) UnlockUser(userName string) error {
+	user, userExists := c.userRepository.FindByName(userName)
+	if !userExists {
+		return NewErrUserDoesNotExist(AdminSessionID, userName)
+	}
+	c.loginFailureRepository.Delete(userLockoutKey(user.ID))
+	slog.Info("unlocked user", "userName", userName)
+	return nil
+}
+
+// UnlockHost forgets the failed logins from the given remote host.
+func (c BasicChatService) UnlockHost(host string) {
+	c.loginFailureRepository.Delete(hostLockoutKey(host))
+	slog.Info("unlocked host", "host", host)
+}
+
+// DeleteUser closes all sessions of the user with the given name and deletes the account along with its mailbox and ban.
+func (c BasicChatService) DeleteUser(userName string) error {
+	user, userExists := c.userRepository.FindByName(userName)
+	if !userExists {
+		return NewErrUserDoesNotExist(AdminSessionID, userName)
+	}
+	c.disconnectUser(user.ID, "Your account was deleted by an administrator")
+	if _, userExists := c.userRepository.Delete(user.Name); !userExists {
+		return NewErrUserDoesNotExist(AdminSessionID, userName)
+	}
+	c.mailboxRepository.Delete(user.ID)
+	c.banRepository.Delete(user.ID)
+	c.loginFailureRepository.Delete(userLockoutKey(user.ID))
+	c.presenceRepository.Delete(user.ID)
+	slog.Info("deleted user", "userName", userName)
+	return nil
+}
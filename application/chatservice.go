@@ -7,6 +7,10 @@ package application
 
 import (
 	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/benedictweis/tcpchat-server-go/domain"
 )
@@ -14,45 +18,144 @@ import (
 //go:generate mockgen -destination=../test/mock/chatservice_mock.go . ChatService
 type ChatService interface {
 	SendMessageToSessionFromServer(sessionID string, message string)
+	SendErrorToSession(sessionID string, message string)
+	SendUserListToSession(sessionID, requestID string, users []domain.UserPresence)
+	SendReplyToSession(sessionID, requestID, errorMessage string)
 	RegisterNewSession(newSession domain.Session)
-	SendTextMessageToEveryone(sessionID, message string) error
+	SendTextMessageToRoom(sessionID, message string) error
+	JoinRoom(sessionID, roomName string) error
+	PartRoom(sessionID string) error
 	ChangeUserName(sessionID string, newUserName string) error
 	SendPrivateMessage(sessionID, messagePartnerUserName, message string) error
 	CreateAccount(sessionID, userName, password string) error
 	Login(sessionID, userName, password string) error
+	Logout(sessionID string) error
 	ChangePassword(sessionID, oldPassword, newPassword string) error
+	IsLoggedIn(sessionID string) bool
 	GetUserNameForSessionID(sessionID string) string
-	GetAllLoggedInUserNames() []string
+	GetLoggedInUsers() []domain.UserPresence
+	SetPresence(sessionID string, status domain.PresenceStatus, reason string) error
+	RecordActivity(sessionID string)
+	GetRoomNameForSessionID(sessionID string) string
+	GetAllRooms() []*domain.Room
+	SendHistory(sessionID string, count int) error
+	ReplayHistory(sessionID string) error
+	DeliverMailbox(sessionID string) error
+	SendInbox(sessionID string) error
+	ClearInbox(sessionID string) error
+	GetRoleForSessionID(sessionID string) domain.Role
+	KickUser(sessionID, userName string) error
+	BanUser(sessionID, userName string, duration time.Duration) error
+	UnbanUser(sessionID, userName string) error
+	SetUserRole(sessionID, userName string, role domain.Role) error
 	QuitSession(sessionID string)
 }
 
 type BasicChatService struct {
-	sessionRepository     domain.SessionRepository
-	userRepository        domain.UserRepository
-	userSessionRepository domain.UserSessionRepository
+	sessionRepository      domain.SessionRepository
+	userRepository         domain.UserRepository
+	userSessionRepository  domain.UserSessionRepository
+	roomRepository         domain.RoomRepository
+	messageStore           domain.MessageStore
+	mailboxRepository      domain.MailboxRepository
+	banRepository          domain.BanRepository
+	loginFailureRepository domain.LoginFailureRepository
+	presenceRepository     domain.PresenceRepository
+	rateLimitRepository    domain.RateLimitRepository
+	floodOffenseRepository domain.FloodOffenseRepository
+	options                Options
+	deliveryStats          *DeliveryStats
+	// roomMutex guards moving sessions between rooms, so that rooms are never deleted while sessions join them.
+	roomMutex *sync.Mutex
+	// loginMutex guards counting and adding the sessions of a user, so that concurrent logins respect the session limit.
+	loginMutex *sync.Mutex
 }
 
-func NewChatService(sessionRepository domain.SessionRepository, userRepository domain.UserRepository, userSessionRepository domain.UserSessionRepository) *BasicChatService {
-	return &BasicChatService{sessionRepository: sessionRepository, userRepository: userRepository, userSessionRepository: userSessionRepository}
+func NewChatService(sessionRepository domain.SessionRepository, userRepository domain.UserRepository, userSessionRepository domain.UserSessionRepository, roomRepository domain.RoomRepository, messageStore domain.MessageStore, mailboxRepository domain.MailboxRepository, banRepository domain.BanRepository, loginFailureRepository domain.LoginFailureRepository, presenceRepository domain.PresenceRepository, rateLimitRepository domain.RateLimitRepository, floodOffenseRepository domain.FloodOffenseRepository, options Options) *BasicChatService {
+	return &BasicChatService{sessionRepository: sessionRepository, userRepository: userRepository, userSessionRepository: userSessionRepository, roomRepository: roomRepository, messageStore: messageStore, mailboxRepository: mailboxRepository, banRepository: banRepository, loginFailureRepository: loginFailureRepository, presenceRepository: presenceRepository, rateLimitRepository: rateLimitRepository, floodOffenseRepository: floodOffenseRepository, options: options, deliveryStats: &DeliveryStats{}, roomMutex: &sync.Mutex{}, loginMutex: &sync.Mutex{}}
+}
+
+// Metrics returns the metrics the chat service and its handlers record to.
+func (c BasicChatService) Metrics() Metrics {
+	return c.options.Metrics
+}
+
+// DeliveryStats returns the counters of messages that could not be delivered to slow sessions.
+func (c BasicChatService) DeliveryStats() *DeliveryStats {
+	return c.deliveryStats
 }
 
 func (c BasicChatService) SendMessageToSessionFromServer(sessionID string, message string) {
-	c.sendMessageToSession(sessionID, fmt.Sprintf("[server] %s", message))
+	c.sendMessageToSession(sessionID, domain.NewServerOutgoingMessage(message))
 }
 
-func (c BasicChatService) sendMessageToSession(sessionID string, message string) {
+// SendErrorToSession tells a session why its last message or command failed.
+func (c BasicChatService) SendErrorToSession(sessionID string, message string) {
+	c.sendMessageToSession(sessionID, domain.NewErrorOutgoingMessage(message))
+}
+
+func (c BasicChatService) SendUserListToSession(sessionID, requestID string, users []domain.UserPresence) {
+	c.sendMessageToSession(sessionID, domain.NewUserListOutgoingMessage(requestID, users))
+}
+
+// SendReplyToSession tells a session that its command with the request id was handled, errorMessage is empty if it succeeded.
+func (c BasicChatService) SendReplyToSession(sessionID, requestID, errorMessage string) {
+	c.sendMessageToSession(sessionID, domain.NewReplyOutgoingMessage(requestID, errorMessage))
+}
+
+// sendMessageToSession queues a message for a session without waiting for it to be written,
+// sessions are disconnected if their queue is full and the overflow policy demands it.
+func (c BasicChatService) sendMessageToSession(sessionID string, message domain.OutgoingMessage) {
 	session, sessionExists := c.sessionRepository.FindByID(sessionID)
 	if !sessionExists {
 		return
 	}
-	session.MessagesToSession <- fmt.Sprintf("%s\n", message)
+	switch session.Outgoing.Push(message) {
+	case domain.PushQueued:
+		c.options.Metrics.MessageQueued(message.Type)
+	case domain.PushDroppedOldest:
+		c.options.Metrics.MessageQueued(message.Type)
+		c.deliveryStats.DroppedMessages.Add(1)
+		slog.Debug("dropped message to slow session", "sessionID", sessionID)
+	case domain.PushDropped:
+		c.deliveryStats.DroppedMessages.Add(1)
+		slog.Debug("dropped message to slow session", "sessionID", sessionID)
+	case domain.PushOverflowed:
+		c.deliveryStats.DroppedMessages.Add(1)
+		c.deliveryStats.DisconnectedSessions.Add(1)
+		slog.Warn("disconnecting slow session", "sessionID", sessionID, "queuedMessages", session.Outgoing.Len())
+		c.QuitSession(sessionID)
+	}
+}
+
+// roomNotification is a message from the server to the sessions that were members of a room when it was created.
+type roomNotification struct {
+	memberSessionIDs []string
+	message          string
 }
 
+// sendRoomNotifications sends notifications collected while the rooms were locked.
+func (c BasicChatService) sendRoomNotifications(notifications []roomNotification) {
+	for _, notification := range notifications {
+		for _, memberSessionID := range notification.memberSessionIDs {
+			c.SendMessageToSessionFromServer(memberSessionID, notification.message)
+		}
+	}
+}
+
+// RegisterNewSession adds a new session to the default room, sessions from banned hosts are closed right away.
 func (c BasicChatService) RegisterNewSession(newSession domain.Session) {
 	c.sessionRepository.Add(newSession)
+	if ban, isBanned := c.findActiveBan(func() (*domain.Ban, bool) { return c.banRepository.FindByHost(newSession.RemoteHost()) }); isBanned {
+		slog.Info("closing session from banned host", "sessionID", newSession.ID, "remoteAddr", newSession.RemoteAddr, "bannedUserName", ban.UserName)
+		c.SendMessageToSessionFromServer(newSession.ID, banMessage(ban))
+		c.QuitSession(newSession.ID)
+		return
+	}
+	c.moveSessionToRoom(newSession.ID, domain.DefaultRoomName)
 }
 
-func (c BasicChatService) SendTextMessageToEveryone(sessionID, message string) error {
+func (c BasicChatService) SendTextMessageToRoom(sessionID, message string) error {
 	_, sessionExists := c.sessionRepository.FindByID(sessionID)
 	if !sessionExists {
 		return fmt.Errorf("revieced a text Message from an unknown session id: %s", sessionID)
@@ -66,13 +169,94 @@ func (c BasicChatService) SendTextMessageToEveryone(sessionID, message string) e
 	if !userExists {
 		return fmt.Errorf("user was not found, userID: %s", userID)
 	}
-	otherSessions := c.sessionRepository.FindAllExceptBySessionID(sessionID)
-	for _, otherSession := range otherSessions {
-		c.sendMessageToSession(otherSession.ID, fmt.Sprintf("[%s] %s", user.Name, message))
+	room, inRoom := c.roomRepository.FindBySessionID(sessionID)
+	if !inRoom {
+		return fmt.Errorf("session is not a member of any room, sessionID: %s", sessionID)
+	}
+	storedMessage := domain.NewTextStoredMessage(user, room.Name, message)
+	c.messageStore.Add(storedMessage)
+	for _, memberSessionID := range room.Members() {
+		if memberSessionID == sessionID {
+			continue
+		}
+		c.sendMessageToSession(memberSessionID, domain.NewOutgoingMessageFromStored(storedMessage, false))
 	}
 	return nil
 }
 
+func (c BasicChatService) JoinRoom(sessionID, roomName string) error {
+	_, sessionExists := c.sessionRepository.FindByID(sessionID)
+	if !sessionExists {
+		return fmt.Errorf("received a join request from an unknown session id: %s", sessionID)
+	}
+	roomName = domain.NormalizeRoomName(roomName)
+	if !domain.RoomNameIsValid(roomName) {
+		return NewErrInvalidRoomName(sessionID, roomName)
+	}
+	currentRoom, inRoom := c.roomRepository.FindBySessionID(sessionID)
+	if inRoom && currentRoom.Name == roomName {
+		return NewErrAlreadyInRoom(sessionID, roomName)
+	}
+	c.moveSessionToRoom(sessionID, roomName)
+	return nil
+}
+
+func (c BasicChatService) PartRoom(sessionID string) error {
+	currentRoom, inRoom := c.roomRepository.FindBySessionID(sessionID)
+	if !inRoom || currentRoom.Name == domain.DefaultRoomName {
+		return NewErrCannotPartDefaultRoom(sessionID)
+	}
+	c.moveSessionToRoom(sessionID, domain.DefaultRoomName)
+	return nil
+}
+
+// moveSessionToRoom removes a session from its current room and adds it to the room with the given name,
+// the room is created if it does not exist yet. Sessions that were quit in the meantime are not added.
+func (c BasicChatService) moveSessionToRoom(sessionID, roomName string) {
+	c.roomMutex.Lock()
+	notifications := c.removeFromRoom(sessionID)
+	if _, sessionExists := c.sessionRepository.FindByID(sessionID); sessionExists {
+		room, roomExists := c.roomRepository.FindByName(roomName)
+		if !roomExists {
+			room = domain.NewRoom(roomName)
+			c.roomRepository.Add(room)
+		}
+		if userName := c.GetUserNameForSessionID(sessionID); userName != "" {
+			notifications = append(notifications, roomNotification{room.Members(), fmt.Sprintf("%s joined #%s", userName, room.Name)})
+		}
+		room.AddMember(sessionID)
+	}
+	c.roomMutex.Unlock()
+	c.sendRoomNotifications(notifications)
+}
+
+// leaveRoom removes a session from its current room.
+func (c BasicChatService) leaveRoom(sessionID string) {
+	c.roomMutex.Lock()
+	notifications := c.removeFromRoom(sessionID)
+	c.roomMutex.Unlock()
+	c.sendRoomNotifications(notifications)
+}
+
+// removeFromRoom removes a session from its current room, rooms other than the default room are deleted once they are empty.
+// The remaining members have to be notified once the rooms are unlocked.
+func (c BasicChatService) removeFromRoom(sessionID string) []roomNotification {
+	room, inRoom := c.roomRepository.FindBySessionID(sessionID)
+	if !inRoom {
+		return nil
+	}
+	room.RemoveMember(sessionID)
+	if room.IsEmpty() && room.Name != domain.DefaultRoomName {
+		c.roomRepository.Delete(room.Name)
+		return nil
+	}
+	if userName := c.GetUserNameForSessionID(sessionID); userName != "" {
+		return []roomNotification{{room.Members(), fmt.Sprintf("%s left #%s", userName, room.Name)}}
+	}
+	return nil
+}
+
+// ChangeUserName renames the user of the session and tells all other logged in sessions about the new name.
 func (c BasicChatService) ChangeUserName(sessionID string, newUserName string) error {
 	userSession, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID)
 	if !userSessionExists {
@@ -82,7 +266,32 @@ func (c BasicChatService) ChangeUserName(sessionID string, newUserName string) e
 	if !userExists {
 		return fmt.Errorf("user was not found, userID: %s", userSession.UserID)
 	}
-	user.Name = newUserName
+	if user.Name == newUserName {
+		return nil
+	}
+	if err := checkUserName(sessionID, newUserName); err != nil {
+		return err
+	}
+	if !c.userRepository.Rename(user.ID, newUserName) {
+		return NewErrUserNameAlreadyExists(sessionID, newUserName)
+	}
+	for _, otherUserSession := range c.userSessionRepository.GetAll() {
+		if otherUserSession.SessionID == sessionID {
+			continue
+		}
+		c.SendMessageToSessionFromServer(otherUserSession.SessionID, fmt.Sprintf("%s is now known as %s", user.Name, newUserName))
+	}
+	return nil
+}
+
+// checkUserName returns an error explaining why a user may not be called userName.
+func checkUserName(sessionID, userName string) error {
+	if !domain.UserNameIsValid(userName) {
+		return NewErrInvalidUserName(sessionID, userName)
+	}
+	if domain.UserNameIsReserved(userName) {
+		return NewErrUserNameIsReserved(sessionID, userName)
+	}
 	return nil
 }
 
@@ -99,17 +308,30 @@ func (c BasicChatService) SendPrivateMessage(sessionID, messagePartnerUserName,
 	if !messagePartnerUserExists {
 		return NewErrMessagePartnerDoesNotExist(sessionID, messagePartnerUserName)
 	}
+	storedMessage := domain.NewPrivateStoredMessage(user, messagePartnerUser, message)
 	messagePartnerUserSessions := c.userSessionRepository.FindByUserID(messagePartnerUser.ID)
 	if len(messagePartnerUserSessions) == 0 {
-		return NewErrMessagePartnerNotLoggedIn(sessionID, messagePartnerUserName)
+		c.findOrCreateMailbox(messagePartnerUser.ID).Add(storedMessage)
+		c.SendMessageToSessionFromServer(sessionID, fmt.Sprintf("%s is not logged in, your message will be delivered when they log in", messagePartnerUser.Name))
+		return nil
 	}
+	c.messageStore.Add(storedMessage)
 	for _, partnerUserSession := range messagePartnerUserSessions {
-		c.sendMessageToSession(partnerUserSession.SessionID, fmt.Sprintf("[p %s] %s", user.Name, message))
+		c.sendMessageToSession(partnerUserSession.SessionID, domain.NewOutgoingMessageFromStored(storedMessage, false))
+	}
+	if presence, presenceExists := c.presenceRepository.Find(messagePartnerUser.ID); presenceExists && presence.Status != domain.PresenceOnline {
+		c.SendMessageToSessionFromServer(sessionID, presenceNotice(messagePartnerUser.Name, presence))
 	}
 	return nil
 }
 
 func (c BasicChatService) CreateAccount(sessionID, userName, password string) error {
+	if err := checkUserName(sessionID, userName); err != nil {
+		return err
+	}
+	if err := c.checkPassword(sessionID, userName, password); err != nil {
+		return err
+	}
 	user, err := domain.NewUser(userName, password)
 	if err != nil {
 		return NewErrCouldNotCreateUser(sessionID)
@@ -121,17 +343,91 @@ func (c BasicChatService) CreateAccount(sessionID, userName, password string) er
 	return nil
 }
 
+// checkPassword returns an error explaining why the user may not choose password.
+func (c BasicChatService) checkPassword(sessionID, userName, password string) error {
+	if len(password) > domain.MaxPasswordBytes {
+		return NewErrPasswordTooLong(sessionID)
+	}
+	return c.options.PasswordPolicy.Check(sessionID, userName, password)
+}
+
+// Login logs the session in as the user, failed logins are throttled per user and per remote host.
+// Sessions that are already logged in have to log out first.
 func (c BasicChatService) Login(sessionID, userName, password string) error {
+	session, sessionExists := c.sessionRepository.FindByID(sessionID)
+	if !sessionExists {
+		return fmt.Errorf("received a login from an unknown session id: %s", sessionID)
+	}
+	if currentUserName := c.GetUserNameForSessionID(sessionID); currentUserName != "" {
+		return NewErrAlreadyLoggedIn(sessionID, currentUserName)
+	}
+	hostKey := hostLockoutKey(session.RemoteHost())
+	if err := c.reserveLoginAttempt(sessionID, hostKey, c.options.HostLockout); err != nil {
+		return err
+	}
 	user, userExists := c.userRepository.FindByName(userName)
 	if !userExists {
 		return NewErrUserDoesNotExist(sessionID, userName)
 	}
+	userKey := userLockoutKey(user.ID)
+	if err := c.reserveLoginAttempt(sessionID, userKey, c.options.UserLockout); err != nil {
+		c.loginFailureRepository.Release(hostKey, c.options.HostLockout)
+		return err
+	}
 	passwordIsValid := user.PasswordIsValid(password)
 	if !passwordIsValid {
 		return NewErrPasswordIsInvalid(sessionID)
 	}
-	userSession := domain.NewUserSession(user.ID, sessionID)
-	c.userSessionRepository.Add(userSession)
+	c.loginFailureRepository.Release(hostKey, c.options.HostLockout)
+	c.loginFailureRepository.Delete(userKey)
+	if ban, isBanned := c.findActiveBan(func() (*domain.Ban, bool) { return c.banRepository.FindByUserID(user.ID) }); isBanned {
+		return NewErrUserIsBanned(sessionID, ban)
+	}
+	if slices.Contains(c.options.AdminUserNames, user.Name) && user.Role != domain.RoleAdmin {
+		if !c.userRepository.SetRole(user.ID, domain.RoleAdmin) {
+			return fmt.Errorf("could not update user, userID: %s", user.ID)
+		}
+		slog.Info("made configured admin an admin", "userName", user.Name)
+	}
+	replacedUserSessions, err := c.addUserSession(sessionID, user.ID)
+	if err != nil {
+		return err
+	}
+	c.presenceRepository.Touch(user.ID, time.Now())
+	for _, replacedUserSession := range replacedUserSessions {
+		slog.Info("closing session replaced by a new login", "sessionID", replacedUserSession.SessionID, "userName", user.Name)
+		c.SendMessageToSessionFromServer(replacedUserSession.SessionID, "You were logged in on another session")
+		c.QuitSession(replacedUserSession.SessionID)
+	}
+	return nil
+}
+
+// addUserSession logs the session in as the user applying the session limit,
+// it returns the sessions of the user that have to be closed to make room for the new one.
+func (c BasicChatService) addUserSession(sessionID, userID string) ([]*domain.UserSession, error) {
+	c.loginMutex.Lock()
+	defer c.loginMutex.Unlock()
+	var replacedUserSessions []*domain.UserSession
+	if userSessions := c.userSessionRepository.FindByUserID(userID); c.options.MaxSessionsPerUser > 0 && len(userSessions) >= c.options.MaxSessionsPerUser {
+		if c.options.SessionLimitPolicy == domain.SessionLimitReject {
+			return nil, NewErrTooManySessions(sessionID, c.options.MaxSessionsPerUser)
+		}
+		replacedUserSessions = domain.OldestUserSessions(userSessions, len(userSessions)-c.options.MaxSessionsPerUser+1)
+		for _, replacedUserSession := range replacedUserSessions {
+			c.userSessionRepository.DeleteBySessionID(replacedUserSession.SessionID)
+		}
+	}
+	c.userSessionRepository.Add(domain.NewUserSession(userID, sessionID))
+	return replacedUserSessions, nil
+}
+
+// Logout ends the login of the session, the session stays connected and may log in again.
+func (c BasicChatService) Logout(sessionID string) error {
+	userSession, userSessionExists := c.userSessionRepository.DeleteBySessionID(sessionID)
+	if !userSessionExists {
+		return NewErrSessionNotLoggedIn(sessionID)
+	}
+	c.forgetPresenceOfLoggedOutUser(userSession.UserID)
 	return nil
 }
 
@@ -147,13 +443,25 @@ func (c BasicChatService) ChangePassword(sessionID, oldPassword, newPassword str
 	if !user.PasswordIsValid(oldPassword) {
 		return NewErrPasswordIsInvalid(sessionID)
 	}
+	if err := c.checkPassword(sessionID, user.Name, newPassword); err != nil {
+		return err
+	}
 	err := user.SetPassword(newPassword)
 	if err != nil {
 		return NewErrPasswordIsInvalid(sessionID)
 	}
+	if !c.userRepository.SetPasswordHash(user.ID, user.PasswordHash()) {
+		return fmt.Errorf("could not update user, userID: %s", user.ID)
+	}
 	return nil
 }
 
+// IsLoggedIn returns whether a user is logged in on the session.
+func (c BasicChatService) IsLoggedIn(sessionID string) bool {
+	_, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID)
+	return userSessionExists
+}
+
 func (c BasicChatService) GetUserNameForSessionID(sessionID string) string {
 	userSession, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID)
 	if !userSessionExists {
@@ -166,23 +474,248 @@ func (c BasicChatService) GetUserNameForSessionID(sessionID string) string {
 	return user.Name
 }
 
-func (c BasicChatService) GetAllLoggedInUserNames() []string {
-	userNames := make([]string, 0)
-	for _, user := range c.userRepository.GetAll() {
-		userSessions := c.userSessionRepository.DeleteByUserID(user.ID)
-		if len(userSessions) > 0 {
-			userNames = append(userNames, user.Name)
+// CountLoggedInUsers returns the number of distinct users that are logged in on at least one session.
+func (c BasicChatService) CountLoggedInUsers() int {
+	userIDs := make(map[string]struct{})
+	for _, userSession := range c.userSessionRepository.GetAll() {
+		userIDs[userSession.UserID] = struct{}{}
+	}
+	return len(userIDs)
+}
+
+// GetAllSessions returns all sessions that are currently connected.
+func (c BasicChatService) GetAllSessions() []domain.Session {
+	return c.sessionRepository.GetAll()
+}
+
+func (c BasicChatService) GetRoomNameForSessionID(sessionID string) string {
+	room, inRoom := c.roomRepository.FindBySessionID(sessionID)
+	if !inRoom {
+		return ""
+	}
+	return room.Name
+}
+
+func (c BasicChatService) GetAllRooms() []*domain.Room {
+	return c.roomRepository.GetAll()
+}
+
+// SendHistory sends up to count of the most recent messages visible to the user of the session in its current room.
+func (c BasicChatService) SendHistory(sessionID string, count int) error {
+	userSession, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID)
+	if !userSessionExists {
+		return NewErrSessionNotLoggedIn(sessionID)
+	}
+	messages := c.messageStore.FindLastVisibleTo(userSession.UserID, c.GetRoomNameForSessionID(sessionID), count)
+	for _, message := range messages {
+		c.sendMessageToSession(sessionID, domain.NewOutgoingMessageFromStored(message, true))
+	}
+	return nil
+}
+
+// ReplayHistory sends the messages a session missed before logging in, the number of messages is set by the options.
+func (c BasicChatService) ReplayHistory(sessionID string) error {
+	if c.options.HistoryReplayCount <= 0 {
+		return nil
+	}
+	return c.SendHistory(sessionID, c.options.HistoryReplayCount)
+}
+
+// DeliverMailbox sends all private messages the user of the session received while it was not logged in.
+func (c BasicChatService) DeliverMailbox(sessionID string) error {
+	userSession, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID)
+	if !userSessionExists {
+		return NewErrSessionNotLoggedIn(sessionID)
+	}
+	mailbox, mailboxExists := c.mailboxRepository.FindByUserID(userSession.UserID)
+	if !mailboxExists {
+		return nil
+	}
+	undeliveredMessages := mailbox.TakeUndelivered()
+	if len(undeliveredMessages) == 0 {
+		return nil
+	}
+	c.SendMessageToSessionFromServer(sessionID, fmt.Sprintf("You received %d private message(s) while you were away, use /inbox to review them", len(undeliveredMessages)))
+	for _, message := range undeliveredMessages {
+		c.sendMessageToSession(sessionID, domain.NewOutgoingMessageFromStored(message, true))
+	}
+	return nil
+}
+
+// SendInbox sends all private messages the user of the session received while it was not logged in.
+func (c BasicChatService) SendInbox(sessionID string) error {
+	userSession, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID)
+	if !userSessionExists {
+		return NewErrSessionNotLoggedIn(sessionID)
+	}
+	mailbox, mailboxExists := c.mailboxRepository.FindByUserID(userSession.UserID)
+	if !mailboxExists || len(mailbox.Messages()) == 0 {
+		c.SendMessageToSessionFromServer(sessionID, "Your inbox is empty")
+		return nil
+	}
+	mailbox.TakeUndelivered()
+	for _, message := range mailbox.Messages() {
+		c.sendMessageToSession(sessionID, domain.NewOutgoingMessageFromStored(message, true))
+	}
+	return nil
+}
+
+func (c BasicChatService) ClearInbox(sessionID string) error {
+	userSession, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID)
+	if !userSessionExists {
+		return NewErrSessionNotLoggedIn(sessionID)
+	}
+	c.mailboxRepository.Delete(userSession.UserID)
+	return nil
+}
+
+func (c BasicChatService) findOrCreateMailbox(userID string) *domain.Mailbox {
+	mailbox, mailboxExists := c.mailboxRepository.FindByUserID(userID)
+	if mailboxExists {
+		return mailbox
+	}
+	mailbox = domain.NewMailbox(userID, c.options.MailboxCapacity)
+	if !c.mailboxRepository.Add(mailbox) {
+		// Another session created the mailbox in the meantime.
+		mailbox, _ = c.mailboxRepository.FindByUserID(userID)
+	}
+	return mailbox
+}
+
+// GetRoleForSessionID returns the role of the user logged in on the session, sessions that are not logged in are regular users.
+func (c BasicChatService) GetRoleForSessionID(sessionID string) domain.Role {
+	userSession, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID)
+	if !userSessionExists {
+		return domain.RoleUser
+	}
+	user, userExists := c.userRepository.FindByID(userSession.UserID)
+	if !userExists {
+		return domain.RoleUser
+	}
+	return user.Role
+}
+
+// KickUser closes all sessions of the user with the given name.
+func (c BasicChatService) KickUser(sessionID, userName string) error {
+	moderator, user, err := c.findModeratedUser(sessionID, userName)
+	if err != nil {
+		return err
+	}
+	c.disconnectUser(user.ID, fmt.Sprintf("You were kicked by %s", moderator.Name))
+	return nil
+}
+
+// BanUser bans the user with the given name along with the hosts of its sessions and closes all of its sessions,
+// a duration of zero bans the user permanently. The hosts of the banning session are never banned.
+func (c BasicChatService) BanUser(sessionID, userName string, duration time.Duration) error {
+	moderator, user, err := c.findModeratedUser(sessionID, userName)
+	if err != nil {
+		return err
+	}
+	moderatorSession, _ := c.sessionRepository.FindByID(sessionID)
+	hosts := make([]string, 0)
+	for _, userSession := range c.userSessionRepository.FindByUserID(user.ID) {
+		session, sessionExists := c.sessionRepository.FindByID(userSession.SessionID)
+		if !sessionExists || session.RemoteHost() == moderatorSession.RemoteHost() || slices.Contains(hosts, session.RemoteHost()) {
+			continue
+		}
+		hosts = append(hosts, session.RemoteHost())
+	}
+	ban := domain.NewBan(user, hosts, moderator.Name, duration)
+	c.banRepository.Delete(user.ID)
+	if !c.banRepository.Add(ban) {
+		return fmt.Errorf("could not add ban, userID: %s", user.ID)
+	}
+	c.disconnectUser(user.ID, banMessage(ban))
+	return nil
+}
+
+func (c BasicChatService) UnbanUser(sessionID, userName string) error {
+	_, user, err := c.findModeratedUser(sessionID, userName)
+	if err != nil {
+		return err
+	}
+	if _, banExists := c.banRepository.Delete(user.ID); !banExists {
+		return NewErrUserNotBanned(sessionID, userName)
+	}
+	return nil
+}
+
+// SetUserRole gives the user with the given name a role, the role has to be lower than the role of the user of the session.
+func (c BasicChatService) SetUserRole(sessionID, userName string, role domain.Role) error {
+	moderator, user, err := c.findModeratedUser(sessionID, userName)
+	if err != nil {
+		return err
+	}
+	if role >= moderator.Role {
+		return NewErrCannotModerateUser(sessionID, userName)
+	}
+	if !c.userRepository.SetRole(user.ID, role) {
+		return fmt.Errorf("could not update user, userID: %s", user.ID)
+	}
+	for _, userSession := range c.userSessionRepository.FindByUserID(user.ID) {
+		c.SendMessageToSessionFromServer(userSession.SessionID, fmt.Sprintf("%s made you a %s", moderator.Name, role))
+	}
+	return nil
+}
+
+// findModeratedUser returns the user logged in on the session and the user with the given name,
+// the user of the session has to have a higher role than the other user.
+func (c BasicChatService) findModeratedUser(sessionID, userName string) (moderator *domain.User, user *domain.User, err error) {
+	userSession, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID)
+	if !userSessionExists {
+		return nil, nil, NewErrSessionNotLoggedIn(sessionID)
+	}
+	moderator, moderatorExists := c.userRepository.FindByID(userSession.UserID)
+	if !moderatorExists {
+		return nil, nil, fmt.Errorf("user was not found, userID: %s", userSession.UserID)
+	}
+	user, userExists := c.userRepository.FindByName(userName)
+	if !userExists {
+		return nil, nil, NewErrUserDoesNotExist(sessionID, userName)
+	}
+	if user.Role >= moderator.Role {
+		return nil, nil, NewErrCannotModerateUser(sessionID, userName)
+	}
+	return moderator, user, nil
+}
+
+// disconnectUser sends a message to all sessions of a user and closes them.
+func (c BasicChatService) disconnectUser(userID, message string) {
+	for _, userSession := range c.userSessionRepository.FindByUserID(userID) {
+		c.SendMessageToSessionFromServer(userSession.SessionID, message)
+		c.QuitSession(userSession.SessionID)
+	}
+}
+
+// findActiveBan returns the ban found by find if it is still active, expired bans are deleted.
+func (c BasicChatService) findActiveBan(find func() (*domain.Ban, bool)) (*domain.Ban, bool) {
+	for {
+		ban, banExists := find()
+		if !banExists {
+			return nil, false
+		}
+		if ban.IsActive(time.Now()) {
+			return ban, true
 		}
+		c.banRepository.Delete(ban.UserID)
 	}
-	return userNames
 }
 
+// QuitSession closes a session and removes it from its room, a session is only quit once even if it is quit concurrently.
 func (c BasicChatService) QuitSession(sessionID string) {
-	session, sessionExists := c.sessionRepository.FindByID(sessionID)
+	session, sessionExists := c.sessionRepository.Delete(sessionID)
 	if !sessionExists {
 		return
 	}
-	session.Close <- struct{}{}
-	c.userSessionRepository.DeleteBySessionID(sessionID)
-	c.sessionRepository.Delete(sessionID)
+	select {
+	case session.Close <- struct{}{}:
+	default:
+		// The session is already being closed.
+	}
+	c.leaveRoom(sessionID)
+	c.forgetFloodOffense(sessionID)
+	if userSession, userSessionExists := c.userSessionRepository.DeleteBySessionID(sessionID); userSessionExists {
+		c.forgetPresenceOfLoggedOutUser(userSession.UserID)
+	}
 }
@@ -0,0 +1,16 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package application
+
+import "sync/atomic"
+
+// DeliveryStats counts the messages that could not be delivered because the outgoing queue of a session was full.
+type DeliveryStats struct {
+	// DroppedMessages is the number of dropped messages, including messages dropped to make room for newer ones.
+	DroppedMessages atomic.Uint64
+	// DisconnectedSessions is the number of sessions that were disconnected because their queue was full.
+	DisconnectedSessions atomic.Uint64
+}
@@ -5,7 +5,12 @@
 
 package application
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
 
 type UserFriendlyError interface {
 	error
@@ -54,19 +59,7 @@ func NewErrMessagePartnerDoesNotExist(sessionID string, messagePartnerUserName s
 	return &ErrMessagePartnerDoesNotExist{NewBaseError(
 		sessionID,
 		fmt.Sprintf("session %s tried to Message non existant partner %s", sessionID, messagePartnerUserName),
-		"your Message partner does not seem to be logged in",
-	)}
-}
-
-type ErrMessagePartnerNotLoggedIn struct {
-	BaseError
-}
-
-func NewErrMessagePartnerNotLoggedIn(sessionID string, messagePartnerUserName string) *ErrMessagePartnerNotLoggedIn {
-	return &ErrMessagePartnerNotLoggedIn{NewBaseError(
-		sessionID,
-		fmt.Sprintf("session %s tried to Message non logged in partner %s", sessionID, messagePartnerUserName),
-		"your Message partner does not seem to be logged in",
+		"your Message partner does not exist",
 	)}
 }
 
@@ -89,11 +82,59 @@ type ErrUserNameAlreadyExists struct {
 func NewErrUserNameAlreadyExists(sessionID string, userName string) *ErrUserNameAlreadyExists {
 	return &ErrUserNameAlreadyExists{NewBaseError(
 		sessionID,
-		fmt.Sprintf("session %s tried to create user %s that already exists", sessionID, userName),
+		fmt.Sprintf("session %s tried to take user name %s that already exists", sessionID, userName),
 		"a user with that name already exists",
 	)}
 }
 
+type ErrInvalidUserName struct {
+	BaseError
+}
+
+func NewErrInvalidUserName(sessionID string, userName string) *ErrInvalidUserName {
+	return &ErrInvalidUserName{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to take invalid user name %s", sessionID, userName),
+		fmt.Sprintf("user names may only contain letters, digits, '-' and '_' and be at most %d characters long", domain.MaxUserNameLength),
+	)}
+}
+
+type ErrUserNameIsReserved struct {
+	BaseError
+}
+
+func NewErrUserNameIsReserved(sessionID string, userName string) *ErrUserNameIsReserved {
+	return &ErrUserNameIsReserved{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to take reserved user name %s", sessionID, userName),
+		"that user name is reserved",
+	)}
+}
+
+type ErrAlreadyLoggedIn struct {
+	BaseError
+}
+
+func NewErrAlreadyLoggedIn(sessionID string, userName string) *ErrAlreadyLoggedIn {
+	return &ErrAlreadyLoggedIn{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to log in while it is logged in as %s", sessionID, userName),
+		fmt.Sprintf("you are already logged in as %s, use /logout first", userName),
+	)}
+}
+
+type ErrTooManySessions struct {
+	BaseError
+}
+
+func NewErrTooManySessions(sessionID string, maxSessions int) *ErrTooManySessions {
+	return &ErrTooManySessions{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to log in as a user that is logged in on %d sessions", sessionID, maxSessions),
+		"you are logged in on too many sessions, log out on one of them first",
+	)}
+}
+
 type ErrUserDoesNotExist struct {
 	BaseError
 }
@@ -117,3 +158,204 @@ func NewErrPasswordIsInvalid(sessionID string) *ErrPasswordIsInvalid {
 		"wrong password",
 	)}
 }
+
+type ErrPasswordTooShort struct {
+	BaseError
+}
+
+func NewErrPasswordTooShort(sessionID string, minLength int) *ErrPasswordTooShort {
+	return &ErrPasswordTooShort{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s chose a password shorter than %d characters", sessionID, minLength),
+		fmt.Sprintf("your password must be at least %d characters long", minLength),
+	)}
+}
+
+type ErrPasswordTooLong struct {
+	BaseError
+}
+
+func NewErrPasswordTooLong(sessionID string) *ErrPasswordTooLong {
+	return &ErrPasswordTooLong{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s chose a password longer than %d bytes", sessionID, domain.MaxPasswordBytes),
+		fmt.Sprintf("your password must be at most %d bytes long", domain.MaxPasswordBytes),
+	)}
+}
+
+type ErrPasswordTooSimple struct {
+	BaseError
+}
+
+func NewErrPasswordTooSimple(sessionID string, minCharacterClasses int) *ErrPasswordTooSimple {
+	return &ErrPasswordTooSimple{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s chose a password with less than %d character classes", sessionID, minCharacterClasses),
+		fmt.Sprintf("your password must contain at least %d of lowercase letters, uppercase letters, digits and symbols", minCharacterClasses),
+	)}
+}
+
+type ErrPasswordTooCommon struct {
+	BaseError
+}
+
+func NewErrPasswordTooCommon(sessionID string) *ErrPasswordTooCommon {
+	return &ErrPasswordTooCommon{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s chose a commonly used password", sessionID),
+		"your password is too common, please choose another one",
+	)}
+}
+
+type ErrPasswordEqualsUserName struct {
+	BaseError
+}
+
+func NewErrPasswordEqualsUserName(sessionID string) *ErrPasswordEqualsUserName {
+	return &ErrPasswordEqualsUserName{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s chose its user name as password", sessionID),
+		"your password must not be your user name",
+	)}
+}
+
+type ErrLoginLockedOut struct {
+	BaseError
+}
+
+func NewErrLoginLockedOut(sessionID string, blockedUntil time.Time) *ErrLoginLockedOut {
+	return &ErrLoginLockedOut{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to log in while logins are blocked until %s", sessionID, blockedUntil.Format(time.DateTime)),
+		fmt.Sprintf("too many failed logins, try again in %s", max(time.Until(blockedUntil).Round(time.Second), time.Second)),
+	)}
+}
+
+type ErrInvalidRoomName struct {
+	BaseError
+}
+
+func NewErrInvalidRoomName(sessionID string, roomName string) *ErrInvalidRoomName {
+	return &ErrInvalidRoomName{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to join room with invalid name %s", sessionID, roomName),
+		"room names may only contain letters, digits, '-' and '_' and be at most 32 characters long",
+	)}
+}
+
+type ErrAlreadyInRoom struct {
+	BaseError
+}
+
+func NewErrAlreadyInRoom(sessionID string, roomName string) *ErrAlreadyInRoom {
+	return &ErrAlreadyInRoom{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to join room %s it is already a member of", sessionID, roomName),
+		"you are already in that room",
+	)}
+}
+
+type ErrCannotPartDefaultRoom struct {
+	BaseError
+}
+
+func NewErrCannotPartDefaultRoom(sessionID string) *ErrCannotPartDefaultRoom {
+	return &ErrCannotPartDefaultRoom{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to leave the default room", sessionID),
+		fmt.Sprintf("you can not leave #%s, use /join <room> to switch rooms", domain.DefaultRoomName),
+	)}
+}
+
+type ErrPermissionDenied struct {
+	BaseError
+}
+
+func NewErrPermissionDenied(sessionID string, commandType domain.CommandType) *ErrPermissionDenied {
+	return &ErrPermissionDenied{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to use command %s without the required role", sessionID, commandType),
+		"you are not allowed to use this command",
+	)}
+}
+
+type ErrCannotModerateUser struct {
+	BaseError
+}
+
+func NewErrCannotModerateUser(sessionID string, userName string) *ErrCannotModerateUser {
+	return &ErrCannotModerateUser{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to moderate user %s that does not have a lower role", sessionID, userName),
+		"you can only moderate users with a lower role than yours",
+	)}
+}
+
+type ErrUserIsBanned struct {
+	BaseError
+}
+
+func NewErrUserIsBanned(sessionID string, ban *domain.Ban) *ErrUserIsBanned {
+	return &ErrUserIsBanned{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to log in as banned user %s", sessionID, ban.UserName),
+		banMessage(ban),
+	)}
+}
+
+type ErrUserNotBanned struct {
+	BaseError
+}
+
+func NewErrUserNotBanned(sessionID string, userName string) *ErrUserNotBanned {
+	return &ErrUserNotBanned{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to unban user %s that is not banned", sessionID, userName),
+		"that user is not banned",
+	)}
+}
+
+// banMessage tells a banned user how long the ban lasts.
+func banMessage(ban *domain.Ban) string {
+	if ban.IsPermanent() {
+		return "you are banned from this server"
+	}
+	return fmt.Sprintf("you are banned from this server until %s", ban.ExpiresAt.Format(time.DateTime))
+}
+
+type ErrSessionDoesNotExist struct {
+	BaseError
+}
+
+func NewErrSessionDoesNotExist(sessionID string, unknownSessionID string) *ErrSessionDoesNotExist {
+	return &ErrSessionDoesNotExist{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s tried to access session %s that does not exist", sessionID, unknownSessionID),
+		"a session with that id does not exist",
+	)}
+}
+
+type ErrUnknownCommand struct {
+	BaseError
+}
+
+func NewErrUnknownCommand(sessionID string, commandType domain.CommandType) *ErrUnknownCommand {
+	return &ErrUnknownCommand{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s used unknown command %s", sessionID, commandType),
+		"Unknown command",
+	)}
+}
+
+type ErrInvalidArguments struct {
+	BaseError
+}
+
+// NewErrInvalidArguments tells the session that the arguments of a command are wrong, userMsg explains how to use it.
+func NewErrInvalidArguments(sessionID string, commandType domain.CommandType, userMsg string) *ErrInvalidArguments {
+	return &ErrInvalidArguments{NewBaseError(
+		sessionID,
+		fmt.Sprintf("session %s used command %s with invalid arguments", sessionID, commandType),
+		userMsg,
+	)}
+}
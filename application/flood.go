@@ -0,0 +1,76 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package application
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
+
+// sessionRateLimitKey, userRateLimitKey and hostRateLimitKey keep the token buckets apart in the RateLimitRepository.
+func sessionRateLimitKey(sessionID string) string {
+	return "session:" + sessionID
+}
+
+func userRateLimitKey(userID string) string {
+	return "user:" + userID
+}
+
+func hostRateLimitKey(host string) string {
+	return "host:" + host
+}
+
+// CheckFlood takes a token for a line read from the session from the buckets of the session, its user and its
+// remote host and decides what happens to the line. Sessions that keep exceeding the limits are warned, throttled,
+// muted and finally disconnected, they are told about every step.
+func (c BasicChatService) CheckFlood(sessionID string) domain.FloodVerdict {
+	session, sessionExists := c.sessionRepository.FindByID(sessionID)
+	if !sessionExists {
+		return domain.FloodVerdict{Action: domain.FloodAllow}
+	}
+	policy := c.options.FloodPolicy
+	now := time.Now()
+	wait := c.rateLimitRepository.Take(sessionRateLimitKey(sessionID), now, policy.Session)
+	if userSession, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID); userSessionExists {
+		wait = max(wait, c.rateLimitRepository.Take(userRateLimitKey(userSession.UserID), now, policy.User))
+	}
+	wait = max(wait, c.rateLimitRepository.Take(hostRateLimitKey(session.RemoteHost()), now, policy.Host))
+	offense, _ := c.floodOffenseRepository.Find(sessionID)
+	wasMuted := offense.IsMuted(now)
+	if wait == 0 {
+		if wasMuted {
+			return domain.FloodVerdict{Action: domain.FloodMute}
+		}
+		return domain.FloodVerdict{Action: domain.FloodAllow}
+	}
+	offense = c.floodOffenseRepository.Record(sessionID, now, policy)
+	action := policy.Action(offense.Violations)
+	c.options.Metrics.FloodActionTaken(action)
+	switch action {
+	case domain.FloodWarn:
+		slog.Info("session exceeded its rate limits", "sessionID", sessionID, "wait", wait)
+		c.SendMessageToSessionFromServer(sessionID, "You are sending messages too fast, your messages are slowed down")
+	case domain.FloodMute:
+		if !wasMuted {
+			slog.Warn("muted flooding session", "sessionID", sessionID, "violations", offense.Violations, "mutedUntil", offense.MutedUntil)
+			c.SendMessageToSessionFromServer(sessionID, fmt.Sprintf("You are muted for %s for flooding, your messages are dropped", policy.MuteDuration))
+		}
+	case domain.FloodDisconnect:
+		slog.Warn("disconnected flooding session", "sessionID", sessionID, "violations", offense.Violations)
+		c.SendMessageToSessionFromServer(sessionID, "You were disconnected for flooding")
+		c.QuitSession(sessionID)
+	}
+	return domain.FloodVerdict{Action: action, Wait: wait}
+}
+
+// forgetFloodOffense deletes the rate limit and the offense of a session that was closed.
+func (c BasicChatService) forgetFloodOffense(sessionID string) {
+	c.rateLimitRepository.Delete(sessionRateLimitKey(sessionID))
+	c.floodOffenseRepository.Delete(sessionID)
+}
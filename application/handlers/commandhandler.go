@@ -6,143 +6,318 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/benedictweis/tcpchat-server-go/application"
 	"github.com/benedictweis/tcpchat-server-go/domain"
 )
 
-func HandleCommand(command domain.Command, chatService *application.BasicChatService) {
-	slog.Info("received command", "sessionID", command.SessionID, "commandType", command.CommandType, "commandArgs", command.Arguments)
-	matchCommandTypeToFunc(command.CommandType)(command, chatService)
-}
+// defaultHistoryCount is the number of messages shown by /history if no count is given.
+const defaultHistoryCount = 20
 
-func matchCommandTypeToFunc(commandType domain.CommandType) func(command domain.Command, chatService *application.BasicChatService) {
-	handlers := []func(command domain.Command, chatService *application.BasicChatService){
-		handleUnknownCommand,        // 0
-		handleChangeNameCommand,     // 1
-		handlePrivateMessageCommand, // 2
-		handleCreateAccountCommand,  // 3
-		handleLoginCommand,          // 4
-		handleChangePasswordCommand, // 5
-		handleInfoCommand,           // 6
-		handleWhoCommand,            // 7
-		handleQuitCommand,           // 8
+// NewDefaultCommandRegistry returns a registry containing all built-in commands and /help, further commands may be
+// registered before the registry is used to handle messages.
+func NewDefaultCommandRegistry() *CommandRegistry {
+	registry := NewCommandRegistry()
+	builtinCommands := []CommandSpec{
+		{Name: domain.Help, Usage: "[command]", Description: "list all commands or describe a single one", MaxArgs: 1, Handle: registry.handleHelpCommand},
+		{Name: domain.CreateAccount, Usage: "<username> <password>", Description: "create a new account", MinArgs: 2, MaxArgs: 2, Handle: handleCreateAccountCommand},
+		{Name: domain.Login, Usage: "<username> <password>", Description: "log in to your account", MinArgs: 2, MaxArgs: 2, Handle: handleLoginCommand},
+		{Name: domain.Logout, Description: "log out without disconnecting", RequiresLogin: true, Handle: handleLogoutCommand},
+		{Name: domain.ChangeName, Usage: "<new username>", Description: "change your user name", MinArgs: 1, MaxArgs: 1, RequiresLogin: true, Handle: handleChangeNameCommand},
+		{Name: domain.ChangePassword, Usage: "<old password> <new password>", Description: "change your password", MinArgs: 2, MaxArgs: 2, RequiresLogin: true, Handle: handleChangePasswordCommand},
+		{Name: domain.PrivateMessage, Aliases: []domain.CommandType{"m"}, Usage: "<username> <message...>", Description: "send a private message", MinArgs: 2, MaxArgs: 2, RestOfLine: true, RequiresLogin: true, Handle: handlePrivateMessageCommand},
+		{Name: domain.Info, Description: "show your session, user name, room and role", MaxArgs: VariadicArgs, Handle: handleInfoCommand},
+		{Name: domain.Who, Description: "list the users that are logged in and their presence", MaxArgs: VariadicArgs, Handle: handleWhoCommand},
+		{Name: domain.Quit, Aliases: []domain.CommandType{"exit"}, Description: "disconnect from the server", MaxArgs: VariadicArgs, Handle: handleQuitCommand},
+		{Name: domain.Join, Usage: "<room>", Description: "switch to another room", MinArgs: 1, MaxArgs: 1, Handle: handleJoinCommand},
+		{Name: domain.Part, Description: "leave the current room for #" + domain.DefaultRoomName, MaxArgs: VariadicArgs, Handle: handlePartCommand},
+		{Name: domain.Rooms, Description: "list all rooms and their number of members", MaxArgs: VariadicArgs, Handle: handleRoomsCommand},
+		{Name: domain.History, Usage: "[count]", Description: "show the latest messages of the current room", MaxArgs: 1, RequiresLogin: true, Handle: handleHistoryCommand},
+		{Name: domain.Inbox, Usage: "[clear]", Description: "show or clear the private messages received while offline", MaxArgs: 1, RequiresLogin: true, Handle: handleInboxCommand},
+		{Name: domain.Away, Usage: "[reason]", Description: "mark yourself as away", MaxArgs: 1, RestOfLine: true, RequiresLogin: true, Handle: handleAwayCommand},
+		{Name: domain.Busy, Usage: "[reason]", Description: "mark yourself as busy", MaxArgs: 1, RestOfLine: true, RequiresLogin: true, Handle: handleBusyCommand},
+		{Name: domain.Back, Description: "mark yourself as online again", RequiresLogin: true, Handle: handleBackCommand},
+		{Name: domain.KickUser, Usage: "<username>", Description: "disconnect all sessions of a user", MinArgs: 1, MaxArgs: 1, RequiresLogin: true, RequiredRole: domain.RoleModerator, Handle: handleKickCommand},
+		{Name: domain.BanUser, Usage: "<username> [duration]", Description: "ban a user permanently or for a duration like 30m", MinArgs: 1, MaxArgs: 2, RequiresLogin: true, RequiredRole: domain.RoleModerator, Handle: handleBanCommand},
+		{Name: domain.UnbanUser, Usage: "<username>", Description: "lift the ban of a user", MinArgs: 1, MaxArgs: 1, RequiresLogin: true, RequiredRole: domain.RoleModerator, Handle: handleUnbanCommand},
+		{Name: domain.Op, Usage: "<username>", Description: "make a user a moderator", MinArgs: 1, MaxArgs: 1, RequiresLogin: true, RequiredRole: domain.RoleAdmin, Handle: handleOpCommand},
+		{Name: domain.Deop, Usage: "<username>", Description: "make a moderator a regular user again", MinArgs: 1, MaxArgs: 1, RequiresLogin: true, RequiredRole: domain.RoleAdmin, Handle: handleDeopCommand},
 	}
-
-	// Ensure commandType is valid and within bounds
-	if int(commandType) < 0 || int(commandType) >= len(handlers) {
-		return handleUnknownCommand
+	for _, spec := range builtinCommands {
+		if err := registry.Register(spec); err != nil {
+			panic(err)
+		}
 	}
-
-	return handlers[commandType]
+	return registry
 }
 
-func handleUnknownCommand(command domain.Command, chatService *application.BasicChatService) {
+func handleUnknownCommand(command domain.Command, _ *application.BasicChatService) error {
 	slog.Info("received unknown command", "sessionID", command.SessionID, "commandType", command.CommandType, "commandArgs", command.Arguments)
-	chatService.SendMessageToSessionFromServer(command.SessionID, "Unknown command")
+	return application.NewErrUnknownCommand(command.SessionID, command.CommandType)
 }
 
-func handleChangeNameCommand(command domain.Command, chatService *application.BasicChatService) {
-	if len(command.Arguments) != 1 {
-		slog.Info("invalid number of arguments", "sessionID", command.SessionID, "commandType", command.CommandType, "commandArgs", command.Arguments)
-		chatService.SendMessageToSessionFromServer(command.SessionID, "Wrong number of arguments, usage: /name <new username>")
-		return
-	}
+func handleChangeNameCommand(command domain.Command, chatService *application.BasicChatService) error {
 	newUserName := command.Arguments[0]
 	err := chatService.ChangeUserName(command.SessionID, newUserName)
 	if err != nil {
-		handleErrors(err, chatService, command.SessionID)
-		return
+		return err
 	}
 	slog.Info("changed name of user", "sessionID", command.SessionID, "newUserName", newUserName)
 	chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("Changed username to %s", newUserName))
+	return nil
 }
 
-func handlePrivateMessageCommand(command domain.Command, chatService *application.BasicChatService) {
-	if len(command.Arguments) < 2 {
-		slog.Info("invalid number of arguments", "sessionID", command.SessionID, "commandType", command.CommandType, "commandArgs", command.Arguments)
-		chatService.SendMessageToSessionFromServer(command.SessionID, "Wrong number of arguments, usage: /msg <username> <message...>")
-		return
-	}
+func handlePrivateMessageCommand(command domain.Command, chatService *application.BasicChatService) error {
 	messagePartnerUserName := command.Arguments[0]
-	message := strings.Join(command.Arguments[1:], " ")
+	message := command.Arguments[1]
 	err := chatService.SendPrivateMessage(command.SessionID, messagePartnerUserName, message)
 	if err != nil {
-		handleErrors(err, chatService, command.SessionID)
-		return
+		return err
 	}
 	slog.Info("sent private message", "sessionID", command.SessionID, "messagePartnerUserName", messagePartnerUserName)
+	return nil
 }
 
-func handleCreateAccountCommand(command domain.Command, chatService *application.BasicChatService) {
-	if len(command.Arguments) != 2 {
-		slog.Info("invalid number of arguments", "sessionID", command.SessionID, "commandType", command.CommandType, "commandArgs", command.Arguments)
-		chatService.SendMessageToSessionFromServer(command.SessionID, "Wrong number of arguments, usage: /acc <username> <password>")
-		return
-	}
+func handleCreateAccountCommand(command domain.Command, chatService *application.BasicChatService) error {
 	userName := command.Arguments[0]
 	password := command.Arguments[1]
 	err := chatService.CreateAccount(command.SessionID, userName, password)
 	if err != nil {
-		handleErrors(err, chatService, command.SessionID)
-		return
+		return err
 	}
 	slog.Info("created new account", "userName", userName)
 	chatService.SendMessageToSessionFromServer(command.SessionID, "Created new account, please login now")
+	return nil
 }
 
-func handleLoginCommand(command domain.Command, chatService *application.BasicChatService) {
-	if len(command.Arguments) != 2 {
-		slog.Info("invalid number of arguments", "sessionID", command.SessionID, "commandType", command.CommandType, "commandArgs", command.Arguments)
-		chatService.SendMessageToSessionFromServer(command.SessionID, "Wrong number of arguments, usage: /login <username> <password>")
-		return
-	}
+func handleLoginCommand(command domain.Command, chatService *application.BasicChatService) error {
 	userName := command.Arguments[0]
 	password := command.Arguments[1]
 
 	err := chatService.Login(command.SessionID, userName, password)
 	if err != nil {
-		handleErrors(err, chatService, command.SessionID)
-		return
+		// Only guessed credentials count as failed logins, not logins that were rejected for other reasons.
+		if errors.As(err, new(*application.ErrUserDoesNotExist)) || errors.As(err, new(*application.ErrPasswordIsInvalid)) {
+			chatService.Metrics().LoginFailed()
+		}
+		return err
 	}
 	slog.Info("logged in session", "sessionID", command.SessionID, "userName", userName)
 	chatService.SendMessageToSessionFromServer(command.SessionID, "Logged in")
+	err = chatService.ReplayHistory(command.SessionID)
+	if err != nil {
+		handleErrors(err, chatService, command.SessionID)
+	}
+	err = chatService.DeliverMailbox(command.SessionID)
+	if err != nil {
+		handleErrors(err, chatService, command.SessionID)
+	}
+	return nil
 }
 
-func handleChangePasswordCommand(command domain.Command, chatService *application.BasicChatService) {
-	if len(command.Arguments) != 2 {
-		slog.Info("invalid number of arguments", "sessionID", command.SessionID, "commandType", command.CommandType, "commandArgs", command.Arguments)
-		chatService.SendMessageToSessionFromServer(command.SessionID, "Wrong number of arguments, usage: /passwd <old password> <new password>")
-		return
+func handleLogoutCommand(command domain.Command, chatService *application.BasicChatService) error {
+	err := chatService.Logout(command.SessionID)
+	if err != nil {
+		return err
 	}
+	slog.Info("logged out session", "sessionID", command.SessionID)
+	chatService.SendMessageToSessionFromServer(command.SessionID, "Logged out")
+	return nil
+}
+
+func handleChangePasswordCommand(command domain.Command, chatService *application.BasicChatService) error {
 	oldPassword := command.Arguments[0]
 	newPassword := command.Arguments[1]
 	err := chatService.ChangePassword(command.SessionID, oldPassword, newPassword)
 	if err != nil {
-		handleErrors(err, chatService, command.SessionID)
-		return
+		return err
 	}
 	slog.Info("changed password of user associated with session", "sessionID", command.SessionID)
 	chatService.SendMessageToSessionFromServer(command.SessionID, "Changed Password")
+	return nil
 }
 
-func handleInfoCommand(command domain.Command, chatService *application.BasicChatService) {
+func handleInfoCommand(command domain.Command, chatService *application.BasicChatService) error {
 	userName := chatService.GetUserNameForSessionID(command.SessionID)
 	slog.Info("served info", "sessionID", command.SessionID)
-	chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("sessionID: %s\n[plugin] userName:  %s", command.SessionID, userName))
+	chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("sessionID: %s\n[plugin] userName:  %s\n[plugin] room:  #%s\n[plugin] role:  %s", command.SessionID, userName, chatService.GetRoomNameForSessionID(command.SessionID), chatService.GetRoleForSessionID(command.SessionID)))
+	return nil
 }
 
-func handleWhoCommand(command domain.Command, chatService *application.BasicChatService) {
-	for _, userName := range chatService.GetAllLoggedInUserNames() {
-		chatService.SendMessageToSessionFromServer(command.SessionID, userName)
-	}
+func handleWhoCommand(command domain.Command, chatService *application.BasicChatService) error {
+	chatService.SendUserListToSession(command.SessionID, command.RequestID, chatService.GetLoggedInUsers())
 	slog.Info("served who", "sessionID", command.SessionID)
+	return nil
 }
 
-func handleQuitCommand(command domain.Command, chatService *application.BasicChatService) {
+func handleQuitCommand(command domain.Command, chatService *application.BasicChatService) error {
 	chatService.QuitSession(command.SessionID)
 	slog.Info("quit session", "sessionID", command.SessionID)
+	return nil
+}
+
+func handleJoinCommand(command domain.Command, chatService *application.BasicChatService) error {
+	err := chatService.JoinRoom(command.SessionID, command.Arguments[0])
+	if err != nil {
+		return err
+	}
+	roomName := chatService.GetRoomNameForSessionID(command.SessionID)
+	slog.Info("joined room", "sessionID", command.SessionID, "roomName", roomName)
+	chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("Joined #%s", roomName))
+	return nil
+}
+
+func handlePartCommand(command domain.Command, chatService *application.BasicChatService) error {
+	err := chatService.PartRoom(command.SessionID)
+	if err != nil {
+		return err
+	}
+	roomName := chatService.GetRoomNameForSessionID(command.SessionID)
+	slog.Info("left room", "sessionID", command.SessionID, "roomName", roomName)
+	chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("Left room, you are now in #%s", roomName))
+	return nil
+}
+
+func handleRoomsCommand(command domain.Command, chatService *application.BasicChatService) error {
+	for _, room := range chatService.GetAllRooms() {
+		chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("#%s (%d)", room.Name, len(room.Members())))
+	}
+	slog.Info("served rooms", "sessionID", command.SessionID)
+	return nil
+}
+
+func handleHistoryCommand(command domain.Command, chatService *application.BasicChatService) error {
+	count := defaultHistoryCount
+	if len(command.Arguments) == 1 {
+		parsedCount, err := strconv.Atoi(command.Arguments[0])
+		if err != nil || parsedCount <= 0 {
+			return application.NewErrInvalidArguments(command.SessionID, command.CommandType, "The count has to be a positive number, usage: /history [count]")
+		}
+		count = parsedCount
+	}
+	err := chatService.SendHistory(command.SessionID, count)
+	if err != nil {
+		return err
+	}
+	slog.Info("served history", "sessionID", command.SessionID, "count", count)
+	return nil
+}
+
+func handleInboxCommand(command domain.Command, chatService *application.BasicChatService) error {
+	if len(command.Arguments) == 1 && command.Arguments[0] == "clear" {
+		err := chatService.ClearInbox(command.SessionID)
+		if err != nil {
+			return err
+		}
+		slog.Info("cleared inbox", "sessionID", command.SessionID)
+		chatService.SendMessageToSessionFromServer(command.SessionID, "Cleared inbox")
+		return nil
+	}
+	if len(command.Arguments) != 0 {
+		return application.NewErrInvalidArguments(command.SessionID, command.CommandType, "Wrong arguments, usage: /inbox [clear]")
+	}
+	err := chatService.SendInbox(command.SessionID)
+	if err != nil {
+		return err
+	}
+	slog.Info("served inbox", "sessionID", command.SessionID)
+	return nil
+}
+
+func handleKickCommand(command domain.Command, chatService *application.BasicChatService) error {
+	userName := command.Arguments[0]
+	err := chatService.KickUser(command.SessionID, userName)
+	if err != nil {
+		return err
+	}
+	slog.Info("kicked user", "sessionID", command.SessionID, "userName", userName)
+	chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("Kicked %s", userName))
+	return nil
+}
+
+func handleBanCommand(command domain.Command, chatService *application.BasicChatService) error {
+	userName := command.Arguments[0]
+	var duration time.Duration
+	if len(command.Arguments) == 2 {
+		var err error
+		duration, err = time.ParseDuration(command.Arguments[1])
+		if err != nil || duration <= 0 {
+			return application.NewErrInvalidArguments(command.SessionID, command.CommandType, "The duration has to be positive, e.g. 30m or 24h")
+		}
+	}
+	err := chatService.BanUser(command.SessionID, userName, duration)
+	if err != nil {
+		return err
+	}
+	slog.Info("banned user", "sessionID", command.SessionID, "userName", userName, "duration", duration)
+	if duration == 0 {
+		chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("Banned %s permanently", userName))
+		return nil
+	}
+	chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("Banned %s for %s", userName, duration))
+	return nil
+}
+
+func handleUnbanCommand(command domain.Command, chatService *application.BasicChatService) error {
+	userName := command.Arguments[0]
+	err := chatService.UnbanUser(command.SessionID, userName)
+	if err != nil {
+		return err
+	}
+	slog.Info("unbanned user", "sessionID", command.SessionID, "userName", userName)
+	chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("Unbanned %s", userName))
+	return nil
+}
+
+func handleOpCommand(command domain.Command, chatService *application.BasicChatService) error {
+	return handleSetRoleCommand(command, chatService, domain.RoleModerator)
+}
+
+func handleDeopCommand(command domain.Command, chatService *application.BasicChatService) error {
+	return handleSetRoleCommand(command, chatService, domain.RoleUser)
+}
+
+func handleSetRoleCommand(command domain.Command, chatService *application.BasicChatService, role domain.Role) error {
+	userName := command.Arguments[0]
+	err := chatService.SetUserRole(command.SessionID, userName, role)
+	if err != nil {
+		return err
+	}
+	slog.Info("changed role of user", "sessionID", command.SessionID, "userName", userName, "role", role)
+	chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("%s is now a %s", userName, role))
+	return nil
+}
+
+func handleAwayCommand(command domain.Command, chatService *application.BasicChatService) error {
+	return handleSetPresenceCommand(command, chatService, domain.PresenceAway)
+}
+
+func handleBusyCommand(command domain.Command, chatService *application.BasicChatService) error {
+	return handleSetPresenceCommand(command, chatService, domain.PresenceBusy)
+}
+
+func handleBackCommand(command domain.Command, chatService *application.BasicChatService) error {
+	return handleSetPresenceCommand(command, chatService, domain.PresenceOnline)
+}
+
+// handleSetPresenceCommand changes the status of the user, the optional argument is the reason.
+func handleSetPresenceCommand(command domain.Command, chatService *application.BasicChatService, status domain.PresenceStatus) error {
+	reason := strings.Join(command.Arguments, " ")
+	err := chatService.SetPresence(command.SessionID, status, reason)
+	if err != nil {
+		return err
+	}
+	slog.Info("changed presence of user", "sessionID", command.SessionID, "status", status)
+	if status == domain.PresenceOnline {
+		chatService.SendMessageToSessionFromServer(command.SessionID, "You are no longer marked as away")
+		return nil
+	}
+	chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("You are now marked as %s", status))
+	return nil
 }
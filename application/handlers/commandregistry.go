@@ -0,0 +1,212 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/benedictweis/tcpchat-server-go/application"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
+
+// VariadicArgs is used as MaxArgs by commands that accept any number of trailing arguments.
+const VariadicArgs = -1
+
+// CommandHandler executes a command after the CommandRegistry checked its arguments, the login state and the role of the session.
+// The returned error is reported to the session, as the reply to the command if the command has a request id.
+type CommandHandler func(command domain.Command, chatService *application.BasicChatService) error
+
+// CommandSpec declares a command, everything the registry needs to check, dispatch and document it.
+type CommandSpec struct {
+	Name    domain.CommandType
+	Aliases []domain.CommandType
+	// Usage lists the arguments of the command, e.g. "<username> [duration]".
+	Usage       string
+	Description string
+	MinArgs     int
+	// MaxArgs is the highest number of arguments accepted, VariadicArgs removes the upper bound.
+	MaxArgs int
+	// RestOfLine makes the last argument the rest of the line exactly as typed, including its whitespace and quotes.
+	// It requires a positive MaxArgs.
+	RestOfLine    bool
+	RequiresLogin bool
+	// RequiredRole is the role needed at least to use the command, RoleUser allows everyone.
+	RequiredRole domain.Role
+	Handle       CommandHandler
+}
+
+// UsageLine returns how the command is invoked, e.g. "/ban <username> [duration]".
+func (c CommandSpec) UsageLine() string {
+	if c.Usage == "" {
+		return "/" + c.Name.String()
+	}
+	return fmt.Sprintf("/%s %s", c.Name, c.Usage)
+}
+
+// ArgumentLimit returns the limit to split the arguments of the command with, see domain.SplitArguments.
+func (c CommandSpec) ArgumentLimit() int {
+	if !c.RestOfLine {
+		return 0
+	}
+	return c.MaxArgs
+}
+
+// arguments parses the arguments of command according to the spec. Commands that were not typed as text
+// may have split the rest of the line already, those arguments are joined again.
+func (c CommandSpec) arguments(command domain.Command) ([]string, error) {
+	if command.Line != "" {
+		return domain.SplitArguments(command.Line, c.ArgumentLimit())
+	}
+	if c.RestOfLine && len(command.Arguments) > c.MaxArgs {
+		arguments := append([]string{}, command.Arguments[:c.MaxArgs-1]...)
+		return append(arguments, strings.Join(command.Arguments[c.MaxArgs-1:], " ")), nil
+	}
+	return command.Arguments, nil
+}
+
+func (c CommandSpec) acceptsArguments(count int) bool {
+	return count >= c.MinArgs && (c.MaxArgs == VariadicArgs || count <= c.MaxArgs)
+}
+
+// CommandRegistry maps the names and aliases of commands to their specs, it is safe for concurrent use.
+type CommandRegistry struct {
+	mutex sync.RWMutex
+	// commands contains every spec once under its name and once under each of its aliases.
+	commands map[domain.CommandType]CommandSpec
+}
+
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{commands: make(map[domain.CommandType]CommandSpec)}
+}
+
+// Register adds a command, it fails if the name or one of the aliases is already taken.
+func (r *CommandRegistry) Register(spec CommandSpec) error {
+	if spec.Name == "" || spec.Name == domain.Unknown {
+		return fmt.Errorf("command name %q is not allowed", spec.Name)
+	}
+	if spec.Handle == nil {
+		return fmt.Errorf("command %s has no handler", spec.Name)
+	}
+	if spec.MinArgs < 0 || (spec.MaxArgs != VariadicArgs && spec.MaxArgs < spec.MinArgs) {
+		return fmt.Errorf("command %s accepts between %d and %d arguments", spec.Name, spec.MinArgs, spec.MaxArgs)
+	}
+	if spec.RestOfLine && spec.MaxArgs < 1 {
+		return fmt.Errorf("command %s takes the rest of the line without accepting arguments", spec.Name)
+	}
+	names := append([]domain.CommandType{spec.Name}, spec.Aliases...)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for index, name := range names {
+		if _, nameTaken := r.commands[name]; nameTaken || strings.ContainsAny(name.String(), " \t/") || slices.Contains(names[:index], name) {
+			return fmt.Errorf("command name %q of %s is taken or invalid", name, spec.Name)
+		}
+	}
+	for _, name := range names {
+		r.commands[name] = spec
+	}
+	return nil
+}
+
+// Lookup returns the spec of the command with the given name or alias.
+func (r *CommandRegistry) Lookup(name domain.CommandType) (spec CommandSpec, specExists bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	spec, specExists = r.commands[name]
+	return
+}
+
+// Resolve returns the name of the command the given name or alias refers to, or Unknown if there is none.
+func (r *CommandRegistry) Resolve(name domain.CommandType) domain.CommandType {
+	spec, specExists := r.Lookup(name)
+	if !specExists {
+		return domain.Unknown
+	}
+	return spec.Name
+}
+
+// Commands returns the specs of all registered commands sorted by their name.
+func (r *CommandRegistry) Commands() []CommandSpec {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	specs := make([]CommandSpec, 0, len(r.commands))
+	for name, spec := range r.commands {
+		if name == spec.Name {
+			specs = append(specs, spec)
+		}
+	}
+	sort.Slice(specs, func(a, b int) bool { return specs[a].Name < specs[b].Name })
+	return specs
+}
+
+// Handle checks the command against its spec and executes it, it returns the name of the command that was handled
+// so that aliases and unknown commands are recorded under a fixed set of names.
+func (r *CommandRegistry) Handle(command domain.Command, chatService *application.BasicChatService) domain.CommandType {
+	slog.Info("received command", "sessionID", command.SessionID, "commandType", command.CommandType, "commandArgs", command.Arguments)
+	commandType, err := r.handle(command, chatService)
+	if command.RequestID != "" {
+		chatService.SendReplyToSession(command.SessionID, command.RequestID, userFriendlyMessage(err))
+	} else if err != nil {
+		handleErrors(err, chatService, command.SessionID)
+	}
+	return commandType
+}
+
+func (r *CommandRegistry) handle(command domain.Command, chatService *application.BasicChatService) (domain.CommandType, error) {
+	spec, specExists := r.Lookup(command.CommandType)
+	if !specExists {
+		return domain.Unknown, handleUnknownCommand(command, chatService)
+	}
+	command.CommandType = spec.Name
+	if spec.RequiresLogin && !chatService.IsLoggedIn(command.SessionID) {
+		return spec.Name, application.NewErrSessionNotLoggedIn(command.SessionID)
+	}
+	if chatService.GetRoleForSessionID(command.SessionID) < spec.RequiredRole {
+		return spec.Name, application.NewErrPermissionDenied(command.SessionID, spec.Name)
+	}
+	arguments, err := spec.arguments(command)
+	if err != nil {
+		return spec.Name, application.NewErrInvalidArguments(command.SessionID, spec.Name, fmt.Sprintf("Invalid arguments, %s, usage: %s", err, spec.UsageLine()))
+	}
+	command.Arguments = arguments
+	if !spec.acceptsArguments(len(command.Arguments)) {
+		return spec.Name, application.NewErrInvalidArguments(command.SessionID, spec.Name, fmt.Sprintf("Wrong number of arguments, usage: %s", spec.UsageLine()))
+	}
+	return spec.Name, spec.Handle(command, chatService)
+}
+
+// handleHelpCommand lists the commands the session may use or describes a single command.
+func (r *CommandRegistry) handleHelpCommand(command domain.Command, chatService *application.BasicChatService) error {
+	if len(command.Arguments) == 1 {
+		spec, specExists := r.Lookup(domain.CommandType(strings.TrimPrefix(command.Arguments[0], "/")))
+		if !specExists {
+			return application.NewErrInvalidArguments(command.SessionID, command.CommandType, fmt.Sprintf("Unknown command %s, use /help to list all commands", command.Arguments[0]))
+		}
+		chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("%s - %s", spec.UsageLine(), spec.Description))
+		if len(spec.Aliases) > 0 {
+			aliases := make([]string, 0, len(spec.Aliases))
+			for _, alias := range spec.Aliases {
+				aliases = append(aliases, "/"+alias.String())
+			}
+			chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("aliases: %s", strings.Join(aliases, ", ")))
+		}
+		slog.Info("served help", "sessionID", command.SessionID, "commandType", spec.Name)
+		return nil
+	}
+	role := chatService.GetRoleForSessionID(command.SessionID)
+	for _, spec := range r.Commands() {
+		if role < spec.RequiredRole {
+			continue
+		}
+		chatService.SendMessageToSessionFromServer(command.SessionID, fmt.Sprintf("%s - %s", spec.UsageLine(), spec.Description))
+	}
+	slog.Info("served help", "sessionID", command.SessionID)
+	return nil
+}
@@ -0,0 +1,146 @@
+package handlers_test
+
+import (
+	"slices"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/application"
+	"github.com/benedictweis/tcpchat-server-go/application/handlers"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CommandRegistry", func() {
+	var registry *handlers.CommandRegistry
+	var handled []domain.Command
+
+	roll := handlers.CommandSpec{Name: "roll", Aliases: []domain.CommandType{"dice"}, Usage: "<sides>", Description: "roll a die", MinArgs: 1, MaxArgs: 1, Handle: func(command domain.Command, _ *application.BasicChatService) error {
+		handled = append(handled, command)
+		return nil
+	}}
+
+	BeforeEach(func() {
+		registry = handlers.NewDefaultCommandRegistry()
+		handled = nil
+	})
+
+	Context("#Register", func() {
+		It("should resolve the name and the aliases of a command", func() {
+			Expect(registry.Register(roll)).To(Succeed())
+			Expect(registry.Resolve("roll")).To(Equal(domain.CommandType("roll")))
+			Expect(registry.Resolve("dice")).To(Equal(domain.CommandType("roll")))
+			Expect(registry.Resolve("m")).To(Equal(domain.PrivateMessage))
+			Expect(registry.Resolve("does-not-exist")).To(Equal(domain.Unknown))
+		})
+
+		DescribeTable("Rejecting invalid commands",
+			func(modify func(spec *handlers.CommandSpec)) {
+				spec := roll
+				modify(&spec)
+				Expect(registry.Register(spec)).NotTo(Succeed())
+				Expect(registry.Resolve("roll")).To(Equal(domain.Unknown))
+			},
+			Entry("When the name is taken", func(spec *handlers.CommandSpec) { spec.Name = domain.Join }),
+			Entry("When an alias is taken", func(spec *handlers.CommandSpec) { spec.Aliases = []domain.CommandType{"m"} }),
+			Entry("When the name contains a space", func(spec *handlers.CommandSpec) { spec.Aliases = []domain.CommandType{"r oll"} }),
+			Entry("When the handler is missing", func(spec *handlers.CommandSpec) { spec.Handle = nil }),
+			Entry("When the argument range is empty", func(spec *handlers.CommandSpec) { spec.MinArgs = 2 }),
+			Entry("When the rest of the line has no argument", func(spec *handlers.CommandSpec) { spec.RestOfLine, spec.MinArgs, spec.MaxArgs = true, 0, 0 }),
+		)
+	})
+
+	Context("#Commands", func() {
+		It("should list every command once sorted by name", func() {
+			Expect(registry.Register(roll)).To(Succeed())
+			names := make([]domain.CommandType, 0)
+			for _, spec := range registry.Commands() {
+				names = append(names, spec.Name)
+			}
+			Expect(names).To(ContainElements(domain.Help, domain.PrivateMessage, domain.CommandType("roll")))
+			Expect(names).NotTo(ContainElements(domain.CommandType("dice"), domain.CommandType("m")))
+			Expect(slices.IsSorted(names)).To(BeTrue())
+		})
+	})
+
+	Context("#Handle", func() {
+		var chatService *application.BasicChatService
+		var sessionID string
+		var messages <-chan domain.OutgoingMessage
+
+		BeforeEach(func() {
+			chatService = application.NewChatService(domain.NewInMemorySessionRepository(), domain.NewInMemoryUserRepository(), domain.NewInMemoryUserSessionRepository(), domain.NewInMemoryRoomRepository(), domain.NewInMemoryMessageStore(100), domain.NewInMemoryMailboxRepository(), domain.NewInMemoryBanRepository(), domain.NewInMemoryLoginFailureRepository(), domain.NewInMemoryPresenceRepository(), domain.NewInMemoryRateLimitRepository(), domain.NewInMemoryFloodOffenseRepository(), application.DefaultOptions())
+			outgoing := domain.NewOutgoingQueue(16, domain.OverflowBlock, time.Second)
+			session := domain.NewSession("127.0.0.1:1234", outgoing, make(chan interface{}, 1))
+			chatService.RegisterNewSession(*session)
+			sessionID, messages = session.ID, outgoing.Messages()
+		})
+
+		It("should call the handler of an alias with the canonical name", func() {
+			Expect(registry.Register(roll)).To(Succeed())
+			Expect(registry.Handle(domain.Command{SessionID: sessionID, CommandType: "dice", Arguments: []string{"6"}}, chatService)).To(Equal(domain.CommandType("roll")))
+			Expect(handled).To(ConsistOf(domain.Command{SessionID: sessionID, CommandType: "roll", Arguments: []string{"6"}}))
+		})
+
+		It("should parse the line of commands typed as text", func() {
+			spec := roll
+			spec.MaxArgs, spec.RestOfLine = 2, true
+			Expect(registry.Register(spec)).To(Succeed())
+			registry.Handle(domain.Command{SessionID: sessionID, CommandType: "roll", Arguments: []string{"ignored"}, Line: `"6 sides"  for  'me'`}, chatService)
+			registry.Handle(domain.Command{SessionID: sessionID, CommandType: "roll", Arguments: []string{"6", "for", "me"}}, chatService)
+			Expect(handled).To(HaveLen(2))
+			Expect(handled[0].Arguments).To(Equal([]string{"6 sides", "for  'me'"}))
+			Expect(handled[1].Arguments).To(Equal([]string{"6", "for me"}))
+		})
+
+		It("should report arguments that can not be parsed", func() {
+			Expect(registry.Register(roll)).To(Succeed())
+			registry.Handle(domain.Command{SessionID: sessionID, CommandType: "roll", Line: `"6`}, chatService)
+			waitForMessage(messages, "Invalid arguments, unterminated quote, usage: /roll <sides>")
+			Expect(handled).To(BeEmpty())
+		})
+
+		It("should check the number of arguments", func() {
+			Expect(registry.Register(roll)).To(Succeed())
+			registry.Handle(domain.Command{SessionID: sessionID, CommandType: "roll"}, chatService)
+			waitForMessage(messages, "Wrong number of arguments, usage: /roll <sides>")
+			Expect(handled).To(BeEmpty())
+		})
+
+		It("should check the login state and the role", func() {
+			spec := roll
+			spec.RequiresLogin = true
+			spec.RequiredRole = domain.RoleAdmin
+			Expect(registry.Register(spec)).To(Succeed())
+			registry.Handle(domain.Command{SessionID: sessionID, CommandType: "roll", Arguments: []string{"6"}}, chatService)
+			waitForMessage(messages, "you are not logged in")
+			Expect(chatService.CreateAccount(sessionID, "alice", "s3cret-pw")).To(Succeed())
+			Expect(chatService.Login(sessionID, "alice", "s3cret-pw")).To(Succeed())
+			registry.Handle(domain.Command{SessionID: sessionID, CommandType: "roll", Arguments: []string{"6"}}, chatService)
+			waitForMessage(messages, "you are not allowed to use this command")
+			Expect(handled).To(BeEmpty())
+		})
+
+		It("should record unknown commands as unknown", func() {
+			Expect(registry.Handle(domain.Command{SessionID: sessionID, CommandType: "does-not-exist"}, chatService)).To(Equal(domain.Unknown))
+			waitForMessage(messages, "Unknown command")
+		})
+
+		It("should reply to commands with a request id", func() {
+			Expect(registry.Register(roll)).To(Succeed())
+			registry.Handle(domain.Command{SessionID: sessionID, CommandType: "roll", Arguments: []string{"6"}, RequestID: "1"}, chatService)
+			Eventually(messages).Should(Receive(And(HaveField("Type", domain.MessageTypeReply), HaveField("RequestID", "1"), HaveField("Error", ""))))
+
+			registry.Handle(domain.Command{SessionID: sessionID, CommandType: "roll", RequestID: "2"}, chatService)
+			Eventually(messages).Should(Receive(And(HaveField("Type", domain.MessageTypeReply), HaveField("RequestID", "2"), HaveField("Error", "Wrong number of arguments, usage: /roll <sides>"))))
+			Consistently(messages, 50*time.Millisecond).ShouldNot(Receive())
+		})
+
+		It("should describe a command with /help", func() {
+			Expect(registry.Register(roll)).To(Succeed())
+			registry.Handle(domain.Command{SessionID: sessionID, CommandType: domain.Help, Arguments: []string{"/dice"}}, chatService)
+			waitForMessage(messages, "/roll <sides> - roll a die")
+			waitForMessage(messages, "aliases: /dice")
+		})
+	})
+})
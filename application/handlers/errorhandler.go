@@ -13,12 +13,19 @@ import (
 )
 
 func handleErrors(err error, chatService application.ChatService, sessionID string) {
+	chatService.SendErrorToSession(sessionID, userFriendlyMessage(err))
+}
+
+// userFriendlyMessage logs err and returns what the session is told about it, it is empty if err is nil.
+func userFriendlyMessage(err error) string {
+	if err == nil {
+		return ""
+	}
 	var userFriendlyError application.UserFriendlyError
 	if errors.As(err, &userFriendlyError) {
 		slog.Info("recovered from error", "err", err)
-		chatService.SendMessageToSessionFromServer(sessionID, userFriendlyError.UserFriendlyError())
-	} else {
-		slog.Error("internal server error", "err", err)
-		chatService.SendMessageToSessionFromServer(sessionID, "internal server error")
+		return userFriendlyError.UserFriendlyError()
 	}
+	slog.Error("internal server error", "err", err)
+	return "internal server error"
 }
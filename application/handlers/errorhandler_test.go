@@ -36,14 +36,14 @@ var _ = Describe("Error Handler", func() {
 
 		Context("when the error is a UserFriendlyError", func() {
 			It("should be sent to the session as a UserFriendlyError", func() {
-				chatService.EXPECT().SendMessageToSessionFromServer(sessionID, userFriendlyError.UserFriendlyError()).Times(1)
+				chatService.EXPECT().SendErrorToSession(sessionID, userFriendlyError.UserFriendlyError()).Times(1)
 				handleErrors(userFriendlyError, chatService, sessionID)
 			})
 		})
 
 		Context("when the error is a not UserFriendlyError", func() {
 			It("should be a sent to the session as an internal server error", func() {
-				chatService.EXPECT().SendMessageToSessionFromServer(sessionID, "internal server error").Times(1)
+				chatService.EXPECT().SendErrorToSession(sessionID, "internal server error").Times(1)
 				handleErrors(nonUserFriendlyError, chatService, sessionID)
 			})
 		})
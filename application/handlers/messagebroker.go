@@ -7,27 +7,73 @@ package handlers
 
 import (
 	"context"
+	"hash/fnv"
+	"time"
 
 	"github.com/benedictweis/tcpchat-server-go/application"
 	"github.com/benedictweis/tcpchat-server-go/domain"
 )
 
-// HandleMessages handles all incoming messages.
-func HandleMessages(ctx context.Context, sessions <-chan domain.Session, textMessages <-chan domain.TextMessage, commands <-chan domain.Command) {
-	sessionRepository := domain.NewInMemorySessionRepository()
-	userRepository := domain.NewInMemoryUserRepository()
-	userSessionRepository := domain.NewInMemoryUserSessionRepository()
-	chatService := application.NewChatService(sessionRepository, userRepository, userSessionRepository)
+// workerQueueSize is the number of events that may wait for a single worker before the dispatcher blocks.
+const workerQueueSize = 64
+
+// HandleMessages handles all incoming messages using chatService, commands are looked up in commandRegistry. Sessions are distributed across workers goroutines,
+// the events of a single session are always handled by the same worker in the order they were received.
+func HandleMessages(ctx context.Context, chatService *application.BasicChatService, commandRegistry *CommandRegistry, workers int, sessions <-chan domain.Session, textMessages <-chan domain.TextMessage, commands <-chan domain.Command) {
+	workerQueues := make([]chan func(), max(workers, 1))
+	for index := range workerQueues {
+		workerQueues[index] = make(chan func(), workerQueueSize)
+		go handleEvents(ctx, workerQueues[index])
+	}
+	dispatch := func(sessionID string, handle func()) {
+		select {
+		case <-ctx.Done():
+		case workerQueues[workerIndex(sessionID, len(workerQueues))] <- handle:
+		}
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case newSession := <-sessions:
-			HandleNewSession(newSession, chatService)
+			dispatch(newSession.ID, func() {
+				start := time.Now()
+				HandleNewSession(newSession, chatService)
+				chatService.Metrics().SessionRegistered(time.Since(start))
+			})
 		case textMessage := <-textMessages:
-			HandleTextMessage(textMessage, chatService)
+			dispatch(textMessage.SessionID, func() {
+				start := time.Now()
+				chatService.RecordActivity(textMessage.SessionID)
+				HandleTextMessage(textMessage, chatService)
+				chatService.Metrics().TextMessageHandled(time.Since(start))
+			})
 		case command := <-commands:
-			HandleCommand(command, chatService)
+			dispatch(command.SessionID, func() {
+				start := time.Now()
+				chatService.RecordActivity(command.SessionID)
+				commandType := commandRegistry.Handle(command, chatService)
+				chatService.Metrics().CommandHandled(commandType, time.Since(start))
+			})
+		}
+	}
+}
+
+// handleEvents handles the events of a single worker one after another until ctx is Done.
+func handleEvents(ctx context.Context, events <-chan func()) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case handle := <-events:
+			handle()
 		}
 	}
 }
+
+// workerIndex returns the index of the worker handling all events of a session.
+func workerIndex(sessionID string, workers int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(sessionID))
+	return int(hash.Sum32() % uint32(workers))
+}
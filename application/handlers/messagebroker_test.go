@@ -0,0 +1,213 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/application"
+	"github.com/benedictweis/tcpchat-server-go/application/handlers"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// messageBroker feeds events into HandleMessages like the plugin does.
+type messageBroker struct {
+	sessions     chan domain.Session
+	textMessages chan domain.TextMessage
+	commands     chan domain.Command
+}
+
+func startMessageBroker(ctx context.Context, workers int) *messageBroker {
+	options := application.DefaultOptions()
+	options.HistoryReplayCount = 0
+	return startMessageBrokerWithOptions(ctx, workers, options)
+}
+
+func startMessageBrokerWithOptions(ctx context.Context, workers int, options application.Options) *messageBroker {
+	chatService := application.NewChatService(domain.NewInMemorySessionRepository(), domain.NewInMemoryUserRepository(), domain.NewInMemoryUserSessionRepository(), domain.NewInMemoryRoomRepository(), domain.NewInMemoryMessageStore(100), domain.NewInMemoryMailboxRepository(), domain.NewInMemoryBanRepository(), domain.NewInMemoryLoginFailureRepository(), domain.NewInMemoryPresenceRepository(), domain.NewInMemoryRateLimitRepository(), domain.NewInMemoryFloodOffenseRepository(), options)
+	broker := &messageBroker{sessions: make(chan domain.Session), textMessages: make(chan domain.TextMessage), commands: make(chan domain.Command)}
+	go handlers.HandleMessages(ctx, chatService, handlers.NewDefaultCommandRegistry(), workers, broker.sessions, broker.textMessages, broker.commands)
+	return broker
+}
+
+// newSession registers a new session, the returned channel receives all messages sent to it.
+func (m *messageBroker) newSession(queueSize int) (string, <-chan domain.OutgoingMessage) {
+	outgoing := domain.NewOutgoingQueue(queueSize, domain.OverflowBlock, 10*time.Second)
+	session := domain.NewSession("127.0.0.1:1234", outgoing, make(chan interface{}, 1))
+	m.sessions <- *session
+	return session.ID, outgoing.Messages()
+}
+
+// login creates an account for a session and logs it in.
+func (m *messageBroker) login(sessionID, userName string) {
+	m.commands <- domain.Command{SessionID: sessionID, CommandType: domain.CreateAccount, Arguments: []string{userName, "s3cret-pw"}}
+	m.commands <- domain.Command{SessionID: sessionID, CommandType: domain.Login, Arguments: []string{userName, "s3cret-pw"}}
+}
+
+func waitForMessage(messages <-chan domain.OutgoingMessage, message string) {
+	GinkgoHelper()
+	Eventually(messages).Should(Receive(HaveField("Message", message)))
+}
+
+var _ = Describe("Messagebroker", func() {
+	Context("#HandleMessages", func() {
+		It("should keep the order of the messages of every session", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			DeferCleanup(cancel)
+			broker := startMessageBroker(ctx, 4)
+			const senders, messagesPerSender = 20, 50
+
+			receiverID, received := broker.newSession(senders * messagesPerSender * 2)
+			broker.login(receiverID, "receiver")
+			waitForMessage(received, "Logged in")
+			senderIDs := make([]string, senders)
+			for index := range senderIDs {
+				var senderMessages <-chan domain.OutgoingMessage
+				senderIDs[index], senderMessages = broker.newSession(senders * messagesPerSender * 2)
+				broker.login(senderIDs[index], fmt.Sprintf("sender%d", index))
+				waitForMessage(senderMessages, "Logged in")
+			}
+
+			var sending sync.WaitGroup
+			for index, senderID := range senderIDs {
+				sending.Add(1)
+				go func() {
+					defer sending.Done()
+					for number := range messagesPerSender {
+						broker.textMessages <- domain.TextMessage{SessionID: senderID, Message: fmt.Sprintf("%d %d", index, number)}
+					}
+				}()
+			}
+			sending.Wait()
+
+			nextNumbers := make([]int, senders)
+			for range senders * messagesPerSender {
+				var message domain.OutgoingMessage
+				Eventually(received).Should(Receive(&message))
+				fields := strings.Fields(message.Message)
+				sender, _ := strconv.Atoi(fields[0])
+				number, _ := strconv.Atoi(fields[1])
+				Expect(number).To(Equal(nextNumbers[sender]), "message of %s", message.SenderName)
+				nextNumbers[sender]++
+			}
+		})
+
+		It("should not let concurrent logins try more passwords than the lockout allows", func() {
+			// Hashing with a higher cost keeps the logins running on all workers at the same time.
+			Expect(domain.SetPasswordCost(10)).To(Succeed())
+			DeferCleanup(domain.SetPasswordCost, 4)
+			ctx, cancel := context.WithCancel(context.Background())
+			DeferCleanup(cancel)
+			options := application.DefaultOptions()
+			options.HistoryReplayCount = 0
+			// Logins stay blocked until all guesses were handled, even if they are handled one after another.
+			options.UserLockout.BaseDelay = time.Minute
+			options.HostLockout.BaseDelay = time.Minute
+			broker := startMessageBrokerWithOptions(ctx, 8, options)
+			ownerID, ownerMessages := broker.newSession(16)
+			broker.login(ownerID, "alice")
+			Eventually(ownerMessages, 10*time.Second).Should(Receive(HaveField("Message", "Logged in")))
+
+			guesses := make([]<-chan domain.OutgoingMessage, 8)
+			for index := range guesses {
+				var sessionID string
+				sessionID, guesses[index] = broker.newSession(16)
+				broker.commands <- domain.Command{SessionID: sessionID, CommandType: domain.Login, Arguments: []string{"alice", "wrong"}}
+			}
+			wrongPasswords := 0
+			for _, messages := range guesses {
+				var message domain.OutgoingMessage
+				Eventually(messages, 10*time.Second).Should(Receive(&message, HaveField("Type", domain.MessageTypeError)))
+				if message.Message == "wrong password" {
+					wrongPasswords++
+				}
+			}
+			Expect(wrongPasswords).To(Equal(2))
+		})
+	})
+})
+
+// BenchmarkHandleMessages measures how many text messages are handled per second with thousands of sessions
+// spread across rooms, and how many logins are handled per second while passwords are hashed with the default cost.
+func BenchmarkHandleMessages(b *testing.B) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	const sessionCount, roomCount = 2000, 20
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("messages/workers=%d", workers), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			broker := startMessageBroker(ctx, workers)
+			var delivered atomic.Int64
+			sessionIDs := make([]string, sessionCount)
+			for index := range sessionIDs {
+				var messages <-chan domain.OutgoingMessage
+				sessionIDs[index], messages = broker.newSession(256)
+				go drainMessages(ctx, messages, &delivered)
+				// Joining before logging in keeps the rooms from being notified about every join.
+				broker.commands <- domain.Command{SessionID: sessionIDs[index], CommandType: domain.Join, Arguments: []string{fmt.Sprintf("room%d", index%roomCount)}}
+				broker.login(sessionIDs[index], fmt.Sprintf("user%d", index))
+			}
+			// Every session receives a welcome, the account creation and the login message.
+			setupMessages := int64(3 * sessionCount)
+			waitForDeliveries(&delivered, setupMessages)
+
+			b.ResetTimer()
+			for index := range b.N {
+				broker.textMessages <- domain.TextMessage{SessionID: sessionIDs[index%sessionCount], Message: "hello"}
+			}
+			waitForDeliveries(&delivered, setupMessages+int64(b.N)*(sessionCount/roomCount-1))
+		})
+		b.Run(fmt.Sprintf("logins/workers=%d", workers), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if err := domain.SetPasswordCost(10); err != nil {
+				b.Fatal(err)
+			}
+			defer domain.SetPasswordCost(4)
+			broker := startMessageBroker(ctx, workers)
+			var delivered atomic.Int64
+			sessionIDs := make([]string, min(b.N, sessionCount))
+			for index := range sessionIDs {
+				var messages <-chan domain.OutgoingMessage
+				sessionIDs[index], messages = broker.newSession(256)
+				go drainMessages(ctx, messages, &delivered)
+				broker.commands <- domain.Command{SessionID: sessionIDs[index], CommandType: domain.CreateAccount, Arguments: []string{fmt.Sprintf("user%d", index), "s3cret-pw"}}
+			}
+			// Every session receives a welcome and the account creation message.
+			waitForDeliveries(&delivered, int64(2*len(sessionIDs)))
+
+			b.ResetTimer()
+			for index := range b.N {
+				sessionIndex := index % len(sessionIDs)
+				broker.commands <- domain.Command{SessionID: sessionIDs[sessionIndex], CommandType: domain.Login, Arguments: []string{fmt.Sprintf("user%d", sessionIndex), "s3cret-pw"}}
+			}
+			waitForDeliveries(&delivered, int64(2*len(sessionIDs)+b.N))
+		})
+	}
+}
+
+func drainMessages(ctx context.Context, messages <-chan domain.OutgoingMessage, delivered *atomic.Int64) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-messages:
+			delivered.Add(1)
+		}
+	}
+}
+
+func waitForDeliveries(delivered *atomic.Int64, count int64) {
+	for delivered.Load() < count {
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -1,6 +1,8 @@
 package handlers_test
 
 import (
+	"time"
+
 	"github.com/benedictweis/tcpchat-server-go/application/handlers"
 	"github.com/benedictweis/tcpchat-server-go/domain"
 	mock_application "github.com/benedictweis/tcpchat-server-go/test/mock"
@@ -18,7 +20,7 @@ var _ = Describe("NewSessionHandler", func() {
 
 		BeforeEach(func() {
 			ctrl = gomock.NewController(GinkgoT())
-			session = domain.NewSession(make(chan<- string), make(chan<- interface{}))
+			session = domain.NewSession("", domain.NewOutgoingQueue(1, domain.OverflowDropOldest, time.Second), make(chan<- interface{}))
 			chatService = mock_application.NewMockChatService(ctrl)
 		})
 
@@ -14,10 +14,10 @@ import (
 
 func HandleTextMessage(textMessage domain.TextMessage, chatService application.ChatService) {
 	slog.Info("received text message", "sessionID", textMessage.SessionID, "textMessage", textMessage.Message)
-	err := chatService.SendTextMessageToEveryone(textMessage.SessionID, textMessage.Message)
+	err := chatService.SendTextMessageToRoom(textMessage.SessionID, textMessage.Message)
 	if err != nil {
 		handleErrors(err, chatService, textMessage.SessionID)
 		return
 	}
-	slog.Info("sent text message from to everyone", "sessionID", textMessage.SessionID, "textMessage", textMessage.Message)
+	slog.Info("sent text message to room", "sessionID", textMessage.SessionID, "textMessage", textMessage.Message)
 }
@@ -24,8 +24,8 @@ var _ = Describe("Textmessagehandler", func() {
 		})
 
 		Context("when sending a text message", func() {
-			It("should send the text message to everyone", func() {
-				chatService.EXPECT().SendTextMessageToEveryone(textMessage.SessionID, textMessage.Message).Times(1)
+			It("should send the text message to the room", func() {
+				chatService.EXPECT().SendTextMessageToRoom(textMessage.SessionID, textMessage.Message).Times(1)
 				handlers.HandleTextMessage(*textMessage, chatService)
 			})
 		})
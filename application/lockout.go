@@ -0,0 +1,44 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package application
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
+
+// userLockoutKey and hostLockoutKey keep failed logins of users and hosts apart in the LoginFailureRepository.
+func userLockoutKey(userID string) string {
+	return "user:" + userID
+}
+
+func hostLockoutKey(host string) string {
+	return "host:" + host
+}
+
+// reserveLoginAttempt counts a login as failed before the password is checked, so that concurrent logins are throttled
+// like consecutive ones. It returns an error if logins are blocked for the given lockout key.
+func (c BasicChatService) reserveLoginAttempt(sessionID, key string, policy domain.LockoutPolicy) error {
+	failures, reserved := c.loginFailureRepository.Reserve(key, time.Now(), policy)
+	if !reserved {
+		return NewErrLoginLockedOut(sessionID, failures.BlockedUntil)
+	}
+	if policy.MaxFailures > 0 && failures.Count == policy.MaxFailures {
+		slog.Warn("locked out logins after repeated failures", "key", key, "failures", failures.Count, "blockedUntil", failures.BlockedUntil)
+	}
+	return nil
+}
+
+// lockedUntil returns the time until which logins of the user are blocked, it is the zero time if they are not.
+func (c BasicChatService) lockedUntil(userID string) time.Time {
+	failures, failuresExist := c.loginFailureRepository.Find(userLockoutKey(userID))
+	if !failuresExist || !failures.IsBlocked(time.Now()) {
+		return time.Time{}
+	}
+	return failures.BlockedUntil
+}
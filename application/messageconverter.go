@@ -32,25 +32,37 @@ func ConvertMessages(ctx context.Context, incomingMessages <-chan MessageResult,
 			message := cleanIncomingMessageString(incomingMessage.Message)
 			slog.Debug("incoming Message", "Message", message)
 			if incomingMessage.Err != nil {
-				slog.Warn("incoming Message error", "Err", incomingMessage.Err)
-				if errors.Is(incomingMessage.Err, io.EOF) {
-					commands <- domain.Command{SessionID: incomingMessage.SessionID, CommandType: domain.Quit, Arguments: nil}
+				// The connection can not be read from anymore (e.g. closed or failed TLS handshake), so the session is quit.
+				if !errors.Is(incomingMessage.Err, io.EOF) {
+					slog.Warn("incoming Message error", "Err", incomingMessage.Err)
 				}
+				commands <- domain.Command{SessionID: incomingMessage.SessionID, CommandType: domain.Quit, Arguments: nil}
 				continue
 			}
-			if strings.HasPrefix(message, "/") {
-				command := strings.TrimPrefix(message, "/")
-				commandSplit := strings.Fields(command)
-				commandType := commandSplit[0]
-				commandArgs := commandSplit[1:]
-				commands <- domain.Command{SessionID: incomingMessage.SessionID, CommandType: domain.CommandTypeFromString(commandType), Arguments: commandArgs}
+			textMessage, command := ConvertMessage(incomingMessage.SessionID, message)
+			if command != nil {
+				commands <- *command
 			} else {
-				textMessages <- domain.TextMessage{SessionID: incomingMessage.SessionID, Message: message}
+				textMessages <- *textMessage
 			}
 		}
 	}
 }
 
+// ConvertMessage converts a single cleaned message into either a text message or a command, exactly one of both is returned.
+// The arguments of commands that can not be parsed are left empty, the error is reported when the command is handled.
+func ConvertMessage(sessionID, message string) (*domain.TextMessage, *domain.Command) {
+	if !strings.HasPrefix(message, "/") {
+		return domain.NewTextMessage(sessionID, message), nil
+	}
+	commandType, line := domain.SplitCommandLine(strings.TrimPrefix(message, "/"))
+	commandArgs, err := domain.SplitArguments(line, 0)
+	if err != nil {
+		commandArgs = nil
+	}
+	return nil, &domain.Command{SessionID: sessionID, CommandType: commandType, Arguments: commandArgs, Line: line}
+}
+
 // cleanIncomingMessageString is a helper function to clean strings that were received by the client.
 func cleanIncomingMessageString(message string) string {
 	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(message, "\n"), "\r"))
@@ -0,0 +1,38 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package application
+
+import (
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
+
+// Metrics records what the chat service and its handlers do, implementations have to be safe for concurrent use.
+type Metrics interface {
+	// SessionRegistered is called once a new session was handled.
+	SessionRegistered(duration time.Duration)
+	// TextMessageHandled is called once a text message received from a session was handled.
+	TextMessageHandled(duration time.Duration)
+	// CommandHandled is called once a command received from a session was handled.
+	CommandHandled(commandType domain.CommandType, duration time.Duration)
+	// MessageQueued is called for every message queued to be sent to a session.
+	MessageQueued(messageType domain.MessageType)
+	// LoginFailed is called for every login with an unknown user name or a wrong password.
+	LoginFailed()
+	// FloodActionTaken is called for every line read from a session that exceeded its rate limits.
+	FloodActionTaken(action domain.FloodAction)
+}
+
+// NoopMetrics discards all metrics.
+type NoopMetrics struct{}
+
+func (NoopMetrics) SessionRegistered(time.Duration)                  {}
+func (NoopMetrics) TextMessageHandled(time.Duration)                 {}
+func (NoopMetrics) CommandHandled(domain.CommandType, time.Duration) {}
+func (NoopMetrics) MessageQueued(domain.MessageType)                 {}
+func (NoopMetrics) LoginFailed()                                     {}
+func (NoopMetrics) FloodActionTaken(domain.FloodAction)              {}
@@ -0,0 +1,57 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package application
+
+import (
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
+
+// Options configures the behaviour of a BasicChatService.
+type Options struct {
+	// HistoryReplayCount is the number of messages replayed to a session after logging in.
+	HistoryReplayCount int
+	// MailboxCapacity is the number of private messages kept for a user that is not logged in.
+	MailboxCapacity int
+	// AdminUserNames are the names of users that are made admins when they log in.
+	AdminUserNames []string
+	// UserLockout throttles failed logins per user.
+	UserLockout domain.LockoutPolicy
+	// HostLockout throttles failed logins per remote host, it should allow more failures because hosts may be shared.
+	HostLockout domain.LockoutPolicy
+	// MaxSessionsPerUser is the number of sessions a user may be logged in on at the same time, zero allows any number.
+	MaxSessionsPerUser int
+	// SessionLimitPolicy is applied when a user logs in on more than MaxSessionsPerUser sessions.
+	SessionLimitPolicy domain.SessionLimitPolicy
+	// FloodPolicy rate limits the lines read from sessions.
+	FloodPolicy domain.FloodPolicy
+	// PasswordPolicy decides which passwords users may choose.
+	PasswordPolicy PasswordPolicy
+	// Metrics records what the chat service does.
+	Metrics Metrics
+}
+
+// DefaultOptions returns the options used if nothing else is configured.
+func DefaultOptions() Options {
+	return Options{
+		HistoryReplayCount: 20,
+		MailboxCapacity:    100,
+		UserLockout:        domain.LockoutPolicy{MaxFailures: 5, BaseDelay: time.Second, Duration: 15 * time.Minute},
+		HostLockout:        domain.LockoutPolicy{MaxFailures: 20, BaseDelay: time.Second, Duration: 15 * time.Minute},
+		FloodPolicy: domain.FloodPolicy{
+			Session:         domain.RateLimit{Burst: 20, RefillInterval: 250 * time.Millisecond},
+			User:            domain.RateLimit{Burst: 30, RefillInterval: 200 * time.Millisecond},
+			Host:            domain.RateLimit{Burst: 100, RefillInterval: 50 * time.Millisecond},
+			MuteAfter:       50,
+			MuteDuration:    time.Minute,
+			DisconnectAfter: 200,
+			ForgiveAfter:    time.Minute,
+		},
+		PasswordPolicy: DefaultPasswordPolicy(),
+		Metrics:        NoopMetrics{},
+	}
+}
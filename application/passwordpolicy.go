@@ -0,0 +1,89 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package application
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy decides which passwords users may choose, violations are returned as UserFriendlyErrors.
+type PasswordPolicy interface {
+	Check(sessionID, userName, password string) error
+}
+
+// commonPasswords are denied by DefaultPasswordPolicy, they are the first guesses of every attacker.
+var commonPasswords = []string{
+	"123456", "123456789", "12345678", "1234567890", "password", "password1", "password123", "qwerty", "qwerty123",
+	"qwertyuiop", "abc123", "abcd1234", "111111", "000000", "123123", "1q2w3e4r", "1qaz2wsx", "iloveyou", "letmein",
+	"welcome", "welcome1", "admin", "admin123", "administrator", "changeme", "passw0rd", "p@ssw0rd", "p@ssword",
+	"monkey", "dragon", "football", "baseball", "sunshine", "princess", "master", "superman", "trustno1", "secret",
+	"secret123", "zaq12wsx", "asdfghjkl", "tcpchat", "tcpchat123",
+}
+
+// BasicPasswordPolicy requires a minimum length and number of character classes, rejects denied passwords and
+// passwords equal to the user name.
+type BasicPasswordPolicy struct {
+	MinLength int
+	// MinCharacterClasses is how many of lowercase letters, uppercase letters, digits and other characters a password
+	// has to contain.
+	MinCharacterClasses int
+	// DeniedPasswords are rejected regardless of their case.
+	DeniedPasswords []string
+}
+
+// DefaultPasswordPolicy returns the policy used if nothing else is configured.
+func DefaultPasswordPolicy() BasicPasswordPolicy {
+	return BasicPasswordPolicy{MinLength: 8, MinCharacterClasses: 2, DeniedPasswords: CommonPasswords()}
+}
+
+// CommonPasswords returns a list of frequently used passwords.
+func CommonPasswords() []string {
+	return append([]string(nil), commonPasswords...)
+}
+
+func (p BasicPasswordPolicy) Check(sessionID, userName, password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return NewErrPasswordTooShort(sessionID, p.MinLength)
+	}
+	if countCharacterClasses(password) < p.MinCharacterClasses {
+		return NewErrPasswordTooSimple(sessionID, p.MinCharacterClasses)
+	}
+	if strings.EqualFold(password, userName) {
+		return NewErrPasswordEqualsUserName(sessionID)
+	}
+	for _, deniedPassword := range p.DeniedPasswords {
+		if strings.EqualFold(password, deniedPassword) {
+			return NewErrPasswordTooCommon(sessionID)
+		}
+	}
+	return nil
+}
+
+// countCharacterClasses returns how many of lowercase letters, uppercase letters, digits and other characters s contains.
+func countCharacterClasses(s string) int {
+	var hasLower, hasUpper, hasDigit, hasOther bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasOther = true
+		}
+	}
+	classes := 0
+	for _, hasClass := range []bool{hasLower, hasUpper, hasDigit, hasOther} {
+		if hasClass {
+			classes++
+		}
+	}
+	return classes
+}
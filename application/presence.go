@@ -0,0 +1,68 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package application
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
+
+// RecordActivity resets the idle time of the user the session is logged in as, sessions that are not logged in are ignored.
+func (c BasicChatService) RecordActivity(sessionID string) {
+	userSession, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID)
+	if !userSessionExists {
+		return
+	}
+	c.presenceRepository.Touch(userSession.UserID, time.Now())
+}
+
+// SetPresence changes the status of the user the session is logged in as, the status is shared by all of its sessions.
+func (c BasicChatService) SetPresence(sessionID string, status domain.PresenceStatus, reason string) error {
+	userSession, userSessionExists := c.userSessionRepository.FindBySessionID(sessionID)
+	if !userSessionExists {
+		return NewErrSessionNotLoggedIn(sessionID)
+	}
+	c.presenceRepository.SetStatus(userSession.UserID, status, reason, time.Now())
+	return nil
+}
+
+// GetLoggedInUsers returns the presence of all users that are logged in on at least one session sorted by their name.
+func (c BasicChatService) GetLoggedInUsers() []domain.UserPresence {
+	now := time.Now()
+	users := make([]domain.UserPresence, 0)
+	for _, user := range c.userRepository.GetAll() {
+		if len(c.userSessionRepository.FindByUserID(user.ID)) == 0 {
+			continue
+		}
+		presence, presenceExists := c.presenceRepository.Find(user.ID)
+		if !presenceExists {
+			presence = domain.Presence{Status: domain.PresenceOnline, LastActivityAt: now}
+		}
+		users = append(users, domain.UserPresence{Name: user.Name, Status: presence.Status, Reason: presence.Reason, Idle: presence.Idle(now)})
+	}
+	sort.Slice(users, func(a, b int) bool { return users[a].Name < users[b].Name })
+	return users
+}
+
+// forgetPresenceOfLoggedOutUser deletes the presence of a user once its last session is gone,
+// so that it is online again when it logs in the next time.
+func (c BasicChatService) forgetPresenceOfLoggedOutUser(userID string) {
+	if len(c.userSessionRepository.FindByUserID(userID)) > 0 {
+		return
+	}
+	c.presenceRepository.Delete(userID)
+}
+
+// presenceNotice tells the sender of a private message that the recipient might not answer right away.
+func presenceNotice(userName string, presence domain.Presence) string {
+	if presence.Reason == "" {
+		return fmt.Sprintf("%s is %s", userName, presence.Status)
+	}
+	return fmt.Sprintf("%s is %s: %s", userName, presence.Status, presence.Reason)
+}
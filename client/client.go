@@ -0,0 +1,414 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+// Package client connects to a tcpchat server using its json protocol.
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eventBufferSize is the number of events buffered before reading from the connection stops.
+const eventBufferSize = 64
+
+// ErrClosed is returned for requests on a connection that was closed.
+var ErrClosed = errors.New("connection closed")
+
+// ServerError is returned if the server rejected a command.
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error: %s", e.Message)
+}
+
+type EventType string
+
+const (
+	EventText     EventType = "text"
+	EventPrivate  EventType = "private"
+	EventServer   EventType = "server"
+	EventUserList EventType = "userlist"
+	EventError    EventType = "error"
+	// eventReply is sent once a request was handled, replies are never delivered on Events.
+	eventReply EventType = "reply"
+)
+
+// Event is a message received from the server.
+type Event struct {
+	Type      EventType `json:"type"`
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Sender    string    `json:"sender,omitempty"`
+	Room      string    `json:"room,omitempty"`
+	Recipient string    `json:"recipient,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	// Users and Presence are only set for events of type EventUserList, Presence describes the users in the same order.
+	Users    []string       `json:"users,omitempty"`
+	Presence []UserPresence `json:"presence,omitempty"`
+	// Replayed is set for messages from the history or the mailbox that are delivered after they were sent.
+	Replayed bool `json:"replayed,omitempty"`
+	// RequestID is set for events answering a request, Error for replies to requests that failed.
+	RequestID string `json:"requestId,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// UserPresence tells whether a logged in user is around.
+type UserPresence struct {
+	Name string `json:"name"`
+	// Status is one of online, away or busy.
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	IdleSeconds int64  `json:"idleSeconds"`
+}
+
+// Idle returns how long the user had not been active when it was listed.
+func (u UserPresence) Idle() time.Duration {
+	return time.Duration(u.IdleSeconds) * time.Second
+}
+
+type frame struct {
+	Type      string   `json:"type"`
+	Protocol  string   `json:"protocol,omitempty"`
+	To        string   `json:"to,omitempty"`
+	Message   string   `json:"message,omitempty"`
+	Command   string   `json:"command,omitempty"`
+	Args      []string `json:"args,omitempty"`
+	RequestID string   `json:"requestId,omitempty"`
+}
+
+// request waits for the reply with its id.
+type request struct {
+	id string
+	// answer is the last other event with the id, e.g. the user list answering who.
+	answer Event
+	// collect claims events without a request id that answer the request, e.g. the lines of the help.
+	collect   func(Event) bool
+	collected []Event
+	response  chan Event
+}
+
+// Client is a connection to a tcpchat server, it is safe for concurrent use.
+// Events that do not answer Login, CreateAccount, Who or another request are delivered on Events, which has to be drained.
+type Client struct {
+	connection net.Conn
+	reader     *bufio.Reader
+	events     chan Event
+	done       chan struct{}
+	closed     chan struct{}
+	closeOnce  sync.Once
+
+	writeMutex sync.Mutex
+	// requestMutex makes sure that only one request waits for a reply at a time.
+	requestMutex sync.Mutex
+	pendingMutex sync.Mutex
+	pending      *request
+	requestIDs   atomic.Uint64
+}
+
+// Dial connects to the server at address.
+func Dial(ctx context.Context, address string) (*Client, error) {
+	var dialer net.Dialer
+	connection, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return newClientClosingOnError(ctx, connection)
+}
+
+// DialTLS connects to the server at address using TLS.
+func DialTLS(ctx context.Context, address string, tlsConfig *tls.Config) (*Client, error) {
+	dialer := tls.Dialer{Config: tlsConfig}
+	connection, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return newClientClosingOnError(ctx, connection)
+}
+
+// NewClient switches an established connection to the json protocol.
+func NewClient(ctx context.Context, connection net.Conn) (*Client, error) {
+	client := &Client{
+		connection: connection,
+		reader:     bufio.NewReader(connection),
+		events:     make(chan Event, eventBufferSize),
+		done:       make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+	if err := client.negotiate(ctx); err != nil {
+		return nil, err
+	}
+	go client.readEvents()
+	return client, nil
+}
+
+func newClientClosingOnError(ctx context.Context, connection net.Conn) (*Client, error) {
+	client, err := NewClient(ctx, connection)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// negotiate sends the hello frame and skips everything the server sent until it replies to it.
+func (c *Client) negotiate(ctx context.Context) error {
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		if err := c.connection.SetDeadline(deadline); err != nil {
+			return err
+		}
+		defer c.connection.SetDeadline(time.Time{})
+	}
+	requestID := c.nextRequestID()
+	if err := c.write(frame{Type: "hello", Protocol: "json", RequestID: requestID}); err != nil {
+		return err
+	}
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return fmt.Errorf("could not negotiate the json protocol: %w", err)
+		}
+		var event Event
+		if json.Unmarshal(line, &event) == nil && event.Type == eventReply && event.RequestID == requestID {
+			return nil
+		}
+	}
+}
+
+// readEvents hands events to the pending request or to Events until the connection is closed.
+func (c *Client) readEvents() {
+	defer close(c.events)
+	defer close(c.done)
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+		if c.reply(event) {
+			continue
+		}
+		select {
+		case <-c.closed:
+			return
+		case c.events <- event:
+		}
+	}
+}
+
+// reply hands event to the pending request and reports whether it answered a request.
+func (c *Client) reply(event Event) bool {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+	if event.RequestID == "" {
+		if c.pending == nil || c.pending.collect == nil || !c.pending.collect(event) {
+			return false
+		}
+		c.pending.collected = append(c.pending.collected, event)
+		return true
+	}
+	if c.pending == nil || c.pending.id != event.RequestID {
+		// Replies to requests that were given up on are dropped.
+		return event.Type == eventReply
+	}
+	if event.Type != eventReply {
+		c.pending.answer = event
+		return true
+	}
+	c.pending.response <- event
+	c.pending = nil
+	return true
+}
+
+// Events returns the channel of events that are not replies to requests, it is closed when the connection is closed.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Done is closed when the connection is closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the connection, events that were not received yet are discarded.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.connection.Close()
+}
+
+// CreateAccount creates a new account on the server, it does not log in.
+func (c *Client) CreateAccount(ctx context.Context, userName, password string) error {
+	_, err := c.request(ctx, frame{Type: "command", Command: "acc", Args: []string{userName, password}})
+	return err
+}
+
+// Login logs the session in as the given user.
+func (c *Client) Login(ctx context.Context, userName, password string) error {
+	_, err := c.request(ctx, frame{Type: "command", Command: "login", Args: []string{userName, password}})
+	return err
+}
+
+// Logout ends the login of the session, the connection stays open.
+func (c *Client) Logout(ctx context.Context) error {
+	_, err := c.request(ctx, frame{Type: "command", Command: "logout"})
+	return err
+}
+
+// ChangeName renames the user the session is logged in as.
+func (c *Client) ChangeName(ctx context.Context, newUserName string) error {
+	_, err := c.request(ctx, frame{Type: "command", Command: "name", Args: []string{newUserName}})
+	return err
+}
+
+// Who returns the names of all users that are logged in.
+func (c *Client) Who(ctx context.Context) ([]string, error) {
+	event, err := c.requestUserList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return event.Users, nil
+}
+
+// Presence returns the status and idle time of all users that are logged in.
+func (c *Client) Presence(ctx context.Context) ([]UserPresence, error) {
+	event, err := c.requestUserList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return event.Presence, nil
+}
+
+// Commands returns the names of the commands the session may use, as listed by the help of the server.
+func (c *Client) Commands(ctx context.Context) ([]string, error) {
+	pending, err := c.await(ctx, frame{Type: "command", Command: "help"}, isHelpLine)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(pending.collected))
+	for _, event := range pending.collected {
+		name, _, _ := strings.Cut(strings.TrimPrefix(event.Message, "/"), " ")
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// isHelpLine reports whether event describes a command, e.g. "/join <room> - switch to another room".
+func isHelpLine(event Event) bool {
+	return event.Type == EventServer && strings.HasPrefix(event.Message, "/") && strings.Contains(event.Message, " - ")
+}
+
+func (c *Client) requestUserList(ctx context.Context) (Event, error) {
+	event, err := c.request(ctx, frame{Type: "command", Command: "who"})
+	if err != nil {
+		return Event{}, err
+	}
+	if event.Type != EventUserList {
+		return Event{}, errors.New("the server did not send a user list")
+	}
+	return event, nil
+}
+
+// Send sends a message to the current room.
+func (c *Client) Send(message string) error {
+	return c.write(frame{Type: "message", Message: message})
+}
+
+// SendPrivate sends a private message to the user with the given name.
+func (c *Client) SendPrivate(userName, message string) error {
+	return c.write(frame{Type: "private", To: userName, Message: message})
+}
+
+// Command sends any command, e.g. "join" with the room as argument, replies are delivered on Events.
+func (c *Client) Command(command string, args ...string) error {
+	return c.write(frame{Type: "command", Command: command, Args: args})
+}
+
+// request sends f with a new request id and waits for the reply of the server. It returns the last other event
+// answering the request, errors sent by the server are returned as ServerError.
+func (c *Client) request(ctx context.Context, f frame) (Event, error) {
+	pending, err := c.await(ctx, f, nil)
+	if err != nil {
+		return Event{}, err
+	}
+	return pending.answer, nil
+}
+
+// await sends f with a new request id and returns the request once the server replied to it,
+// events without a request id that are claimed by collect until then are collected by the request.
+func (c *Client) await(ctx context.Context, f frame, collect func(Event) bool) (*request, error) {
+	c.requestMutex.Lock()
+	defer c.requestMutex.Unlock()
+	f.RequestID = c.nextRequestID()
+	pending := &request{id: f.RequestID, collect: collect, response: make(chan Event, 1)}
+	c.pendingMutex.Lock()
+	c.pending = pending
+	c.pendingMutex.Unlock()
+	defer func() {
+		c.pendingMutex.Lock()
+		if c.pending == pending {
+			c.pending = nil
+		}
+		c.pendingMutex.Unlock()
+	}()
+	if err := c.write(f); err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		// The reply may have been received right before the connection was closed.
+		select {
+		case reply := <-pending.response:
+			return replyResult(pending, reply)
+		default:
+			return nil, ErrClosed
+		}
+	case reply := <-pending.response:
+		return replyResult(pending, reply)
+	}
+}
+
+func replyResult(pending *request, reply Event) (*request, error) {
+	if reply.Error != "" {
+		return nil, &ServerError{Message: reply.Error}
+	}
+	return pending, nil
+}
+
+func (c *Client) nextRequestID() string {
+	return strconv.FormatUint(c.requestIDs.Add(1), 10)
+}
+
+func (c *Client) write(f frame) error {
+	line, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	_, err = c.connection.Write(append(line, '\n'))
+	return err
+}
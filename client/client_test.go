@@ -0,0 +1,163 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/client"
+	"github.com/benedictweis/tcpchat-server-go/config"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		address string
+		ctx     context.Context
+	)
+
+	BeforeEach(func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		port := listener.Addr().(*net.TCPAddr).Port
+		Expect(listener.Close()).To(Succeed())
+		address = fmt.Sprintf("127.0.0.1:%d", port)
+
+		cfg := config.Default()
+		cfg.Address = "127.0.0.1"
+		cfg.Port = port
+		server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		serverCtx, cancelServer := context.WithCancel(context.Background())
+		stopped := make(chan error, 1)
+		go func() {
+			stopped <- server.Start(serverCtx)
+		}()
+		DeferCleanup(func() {
+			cancelServer()
+			Eventually(stopped, 5*time.Second).Should(Receive(BeNil()))
+		})
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		DeferCleanup(cancel)
+	})
+
+	dial := func() *client.Client {
+		var chatClient *client.Client
+		Eventually(func() error {
+			var err error
+			chatClient, err = client.Dial(ctx, address)
+			return err
+		}).Should(Succeed())
+		DeferCleanup(chatClient.Close)
+		return chatClient
+	}
+
+	loggedIn := func(name string) *client.Client {
+		chatClient := dial()
+		Expect(chatClient.CreateAccount(ctx, name, "s3cret-pw")).To(Succeed())
+		Expect(chatClient.Login(ctx, name, "s3cret-pw")).To(Succeed())
+		return chatClient
+	}
+
+	// nextEvent returns the first event of the given type, skipping all others.
+	nextEvent := func(chatClient *client.Client, eventType client.EventType) client.Event {
+		var event client.Event
+		Eventually(chatClient.Events(), 5*time.Second).Should(Receive(&event, HaveField("Type", eventType)))
+		return event
+	}
+
+	It("should create accounts and log in", func() {
+		chatClient := dial()
+		Expect(chatClient.CreateAccount(ctx, "alice", "s3cret-pw")).To(Succeed())
+		Expect(chatClient.Login(ctx, "alice", "wrong")).To(MatchError(ContainSubstring("wrong password")))
+		Expect(chatClient.Login(ctx, "alice", "s3cret-pw")).To(Succeed())
+		Expect(chatClient.Login(ctx, "alice", "s3cret-pw")).To(MatchError(ContainSubstring("already logged in")))
+		Expect(chatClient.Logout(ctx)).To(Succeed())
+		Expect(chatClient.Login(ctx, "alice", "s3cret-pw")).To(Succeed())
+	})
+
+	It("should return errors sent by the server", func() {
+		chatClient := dial()
+		Expect(chatClient.CreateAccount(ctx, "alice", "s3cret-pw")).To(Succeed())
+		err := chatClient.CreateAccount(ctx, "alice", "s3cret-pw")
+		var serverError *client.ServerError
+		Expect(errors.As(err, &serverError)).To(BeTrue())
+		Expect(serverError.Message).NotTo(BeEmpty())
+	})
+
+	It("should deliver errors that do not answer a request as events", func() {
+		chatClient := dial()
+		Expect(chatClient.Send("hello")).To(Succeed())
+		Expect(chatClient.CreateAccount(ctx, "alice", "s3cret-pw")).To(Succeed())
+		Expect(chatClient.Login(ctx, "alice", "s3cret-pw")).To(Succeed())
+		Expect(nextEvent(chatClient, client.EventError).Message).To(Equal("you are not logged in"))
+	})
+
+	It("should change the name of the user", func() {
+		alice := loggedIn("alice")
+		bob := loggedIn("bob")
+		Expect(alice.ChangeName(ctx, "bob")).To(MatchError(ContainSubstring("already exists")))
+		Expect(alice.ChangeName(ctx, "alicia")).To(Succeed())
+		Eventually(bob.Events(), 5*time.Second).Should(Receive(HaveField("Message", "alice is now known as alicia")))
+
+		Expect(bob.SendPrivate("alicia", "hi")).To(Succeed())
+		Expect(nextEvent(alice, client.EventPrivate).Recipient).To(Equal("alicia"))
+	})
+
+	It("should deliver room and private messages as events", func() {
+		alice := loggedIn("alice")
+		bob := loggedIn("bob")
+
+		Expect(alice.Send("hello everyone")).To(Succeed())
+		event := nextEvent(bob, client.EventText)
+		Expect(event.Sender).To(Equal("alice"))
+		Expect(event.Room).To(Equal("lobby"))
+		Expect(event.Message).To(Equal("hello everyone"))
+		Expect(event.Timestamp).NotTo(BeZero())
+
+		Expect(bob.SendPrivate("alice", "hi alice")).To(Succeed())
+		event = nextEvent(alice, client.EventPrivate)
+		Expect(event.Sender).To(Equal("bob"))
+		Expect(event.Recipient).To(Equal("alice"))
+		Expect(event.Message).To(Equal("hi alice"))
+	})
+
+	It("should list the users that are logged in", func() {
+		alice := loggedIn("alice")
+		bob := loggedIn("bob")
+		dial()
+		Expect(alice.Who(ctx)).To(Equal([]string{"alice", "bob"}))
+		Expect(bob.Who(ctx)).To(Equal([]string{"alice", "bob"}))
+
+		Expect(bob.Command("away", "lunch")).To(Succeed())
+		Eventually(bob.Events(), 5*time.Second).Should(Receive(HaveField("Message", "You are now marked as away")))
+		presence, err := alice.Presence(ctx)
+		Expect(err).To(BeNil())
+		Expect(presence).To(HaveLen(2))
+		Expect(presence[0]).To(Equal(client.UserPresence{Name: "alice", Status: "online"}))
+		Expect(presence[1]).To(Equal(client.UserPresence{Name: "bob", Status: "away", Reason: "lunch"}))
+	})
+
+	It("should list the commands the session may use", func() {
+		chatClient := loggedIn("alice")
+		commands, err := chatClient.Commands(ctx)
+		Expect(err).To(BeNil())
+		Expect(commands).To(ContainElements("help", "msg", "join"))
+		Expect(commands).NotTo(ContainElement("op"))
+		Consistently(chatClient.Events(), 100*time.Millisecond).ShouldNot(Receive(HaveField("Message", HavePrefix("/"))))
+	})
+
+	It("should close the events channel when the server closes the connection", func() {
+		chatClient := loggedIn("alice")
+		Expect(chatClient.Command("quit")).To(Succeed())
+		Eventually(chatClient.Done(), 5*time.Second).Should(BeClosed())
+		Expect(chatClient.Login(ctx, "alice", "s3cret-pw")).To(MatchError(client.ErrClosed))
+	})
+})
@@ -0,0 +1,77 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package main
+
+import (
+	"slices"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
+
+// clientCommand is a built-in command of the server the client knows without asking the server.
+type clientCommand struct {
+	name    domain.CommandType
+	aliases []domain.CommandType
+	// argumentLimit is the limit to split the arguments of the command with, see domain.SplitArguments.
+	argumentLimit int
+}
+
+// clientCommands are resolved and parsed by the client, they are completed until the server listed the commands
+// the session may use.
+var clientCommands = []clientCommand{
+	{name: domain.Help},
+	{name: domain.CreateAccount},
+	{name: domain.Login},
+	{name: domain.Logout},
+	{name: domain.ChangeName},
+	{name: domain.ChangePassword},
+	{name: domain.PrivateMessage, aliases: []domain.CommandType{"m"}, argumentLimit: 2},
+	{name: domain.Info},
+	{name: domain.Who},
+	{name: domain.Quit, aliases: []domain.CommandType{"exit"}},
+	{name: domain.Join},
+	{name: domain.Part},
+	{name: domain.Rooms},
+	{name: domain.History},
+	{name: domain.Inbox},
+	{name: domain.Away, argumentLimit: 1},
+	{name: domain.Busy, argumentLimit: 1},
+	{name: domain.Back},
+}
+
+// lookupCommand returns the client command with the name or alias.
+func lookupCommand(name domain.CommandType) (clientCommand, bool) {
+	for _, command := range clientCommands {
+		if command.name == name || slices.Contains(command.aliases, name) {
+			return command, true
+		}
+	}
+	return clientCommand{}, false
+}
+
+// resolveCommand returns the name of the client command with the name or alias, or domain.Unknown.
+func resolveCommand(name domain.CommandType) domain.CommandType {
+	command, commandExists := lookupCommand(name)
+	if !commandExists {
+		return domain.Unknown
+	}
+	return command.name
+}
+
+// commandSuggestions returns the commands to complete, names are the commands listed by the server
+// or nil if the server did not list them yet.
+func commandSuggestions(names []string) []string {
+	if names == nil {
+		for _, command := range clientCommands {
+			names = append(names, command.name.String())
+		}
+	}
+	suggestions := make([]string, 0, len(names))
+	for _, name := range names {
+		suggestions = append(suggestions, "/"+name)
+	}
+	return suggestions
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/client"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+	// requestTimeout is the time to wait for the reply to a command.
+	requestTimeout = 10 * time.Second
+)
+
+// errNotConnected is shown for input while the client is reconnecting.
+var errNotConnected = errors.New("not connected, waiting for the connection to be established")
+
+// eventMsg is an event received from the server.
+type eventMsg client.Event
+
+// commandsMsg lists the commands the session may use.
+type commandsMsg []string
+
+// statusMsg is a notice of the client itself.
+type statusMsg string
+
+// errorMsg is an error of the client itself.
+type errorMsg struct{ err error }
+
+// sentMsg echoes a message that was sent, the server does not send messages back to their sender.
+type sentMsg struct {
+	// recipient is empty for messages sent to the current room.
+	recipient string
+	message   string
+}
+
+// connection keeps a client connected to the server, after reconnecting the user is logged in again.
+type connection struct {
+	address string
+	dial    func(ctx context.Context) (*client.Client, error)
+
+	mutex    sync.Mutex
+	current  *client.Client
+	userName string
+	password string
+}
+
+func newConnection(address string, dial func(ctx context.Context) (*client.Client, error)) *connection {
+	return &connection{address: address, dial: dial}
+}
+
+func (c *connection) setCredentials(userName, password string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.userName = userName
+	c.password = password
+}
+
+func (c *connection) credentials() (string, string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.userName, c.password
+}
+
+func (c *connection) setClient(chatClient *client.Client) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.current = chatClient
+}
+
+func (c *connection) client() (*client.Client, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.current, c.current != nil
+}
+
+// run connects to the server and passes all events to send until ctx is Done, lost connections are reestablished
+// with an increasing delay.
+func (c *connection) run(ctx context.Context, send func(tea.Msg)) {
+	delay := minReconnectDelay
+	for ctx.Err() == nil {
+		chatClient, err := c.dial(ctx)
+		if err != nil {
+			send(errorMsg{fmt.Errorf("could not connect to %s, retrying in %s: %w", c.address, delay, err)})
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(2*delay, maxReconnectDelay)
+			continue
+		}
+		delay = minReconnectDelay
+		c.setClient(chatClient)
+		send(statusMsg(fmt.Sprintf("Connected to %s", c.address)))
+		if userName, password := c.credentials(); userName != "" {
+			c.login(ctx, chatClient, userName, password, send)
+		}
+		send(listCommands(ctx, chatClient))
+		c.forwardEvents(ctx, chatClient, send)
+		c.setClient(nil)
+		chatClient.Close()
+		if ctx.Err() == nil {
+			send(errorMsg{fmt.Errorf("lost the connection to %s, reconnecting", c.address)})
+		}
+	}
+}
+
+func (c *connection) login(ctx context.Context, chatClient *client.Client, userName, password string, send func(tea.Msg)) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if err := chatClient.Login(ctx, userName, password); err != nil {
+		send(errorMsg{fmt.Errorf("could not log in as %s: %w", userName, err)})
+		return
+	}
+	send(statusMsg(fmt.Sprintf("Logged in as %s", userName)))
+}
+
+// listCommands asks the server which commands the session may use, they depend on the role of the user.
+func listCommands(ctx context.Context, chatClient *client.Client) tea.Msg {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	names, err := chatClient.Commands(ctx)
+	if err != nil {
+		return errorMsg{fmt.Errorf("could not list the commands of the server: %w", err)}
+	}
+	return commandsMsg(names)
+}
+
+func (c *connection) forwardEvents(ctx context.Context, chatClient *client.Client, send func(tea.Msg)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, open := <-chatClient.Events():
+			if !open {
+				return
+			}
+			send(eventMsg(event))
+		}
+	}
+}
+
+// execute returns a command sending the input of the user to the server. Input starting with a slash is a command,
+// everything else is sent to the current room.
+func (c *connection) execute(input string) tea.Cmd {
+	return func() tea.Msg {
+		chatClient, connected := c.client()
+		if !connected {
+			return errorMsg{errNotConnected}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		command, isCommand := parseInput(input)
+		if !isCommand {
+			if err := chatClient.Send(input); err != nil {
+				return errorMsg{err}
+			}
+			return sentMsg{message: input}
+		}
+		if command.err != nil {
+			return errorMsg{command.err}
+		}
+		switch resolveCommand(domain.CommandType(command.name)) {
+		case domain.PrivateMessage:
+			if len(command.args) < 2 {
+				return resultMsg(chatClient.Command(command.name, command.args...))
+			}
+			message := command.args[1]
+			if err := chatClient.SendPrivate(command.args[0], message); err != nil {
+				return errorMsg{err}
+			}
+			return sentMsg{recipient: command.args[0], message: message}
+		case domain.CreateAccount:
+			if len(command.args) != 2 {
+				return resultMsg(chatClient.Command(command.name, command.args...))
+			}
+			if err := chatClient.CreateAccount(ctx, command.args[0], command.args[1]); err != nil {
+				return errorMsg{err}
+			}
+			return statusMsg(fmt.Sprintf("Created account %s, log in with /login %s <password>", command.args[0], command.args[0]))
+		case domain.Login:
+			if len(command.args) != 2 {
+				return resultMsg(chatClient.Command(command.name, command.args...))
+			}
+			if err := chatClient.Login(ctx, command.args[0], command.args[1]); err != nil {
+				return errorMsg{err}
+			}
+			c.setCredentials(command.args[0], command.args[1])
+			return tea.BatchMsg{
+				func() tea.Msg { return statusMsg(fmt.Sprintf("Logged in as %s", command.args[0])) },
+				func() tea.Msg { return listCommands(context.Background(), chatClient) },
+			}
+		case domain.Logout:
+			if err := chatClient.Logout(ctx); err != nil {
+				return errorMsg{err}
+			}
+			c.setCredentials("", "")
+			return statusMsg("Logged out")
+		case domain.ChangeName:
+			if len(command.args) != 1 {
+				return resultMsg(chatClient.Command(command.name, command.args...))
+			}
+			if err := chatClient.ChangeName(ctx, command.args[0]); err != nil {
+				return errorMsg{err}
+			}
+			// The new name has to be used to log in again after reconnecting.
+			if userName, password := c.credentials(); userName != "" {
+				c.setCredentials(command.args[0], password)
+			}
+			return statusMsg(fmt.Sprintf("Changed name to %s", command.args[0]))
+		case domain.Who:
+			presence, err := chatClient.Presence(ctx)
+			if err != nil {
+				return errorMsg{err}
+			}
+			return eventMsg(client.Event{Type: client.EventUserList, Timestamp: time.Now(), Presence: presence})
+		default:
+			return resultMsg(chatClient.Command(command.name, command.args...))
+		}
+	}
+}
+
+// resultMsg shows err if sending failed, the reply of the server is received as an event.
+func resultMsg(err error) tea.Msg {
+	if err != nil {
+		return errorMsg{err}
+	}
+	return nil
+}
+
+type inputCommand struct {
+	name string
+	args []string
+	// err is set if the arguments could not be parsed, e.g. because of an unterminated quote.
+	err error
+}
+
+// parseInput splits input starting with a slash into the command name and its arguments, arguments are parsed
+// like the server does it, so that quotes work the same in both.
+func parseInput(input string) (inputCommand, bool) {
+	if !strings.HasPrefix(input, "/") {
+		return inputCommand{}, false
+	}
+	name, line := domain.SplitCommandLine(strings.TrimPrefix(input, "/"))
+	limit := 0
+	if command, commandExists := lookupCommand(name); commandExists {
+		limit = command.argumentLimit
+	}
+	args, err := domain.SplitArguments(line, limit)
+	return inputCommand{name: name.String(), args: args, err: err}, true
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/client"
+	"github.com/benedictweis/tcpchat-server-go/config"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	tea "github.com/charmbracelet/bubbletea"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection", func() {
+	Context("#parseInput", func() {
+		It("should split commands into name and arguments", func() {
+			command, isCommand := parseInput(`/login "bob" 'pass word'`)
+			Expect(isCommand).To(BeTrue())
+			Expect(command).To(Equal(inputCommand{name: "login", args: []string{"bob", "pass word"}}))
+		})
+
+		It("should keep the whitespace of messages", func() {
+			command, _ := parseInput("/msg  bob hello   there")
+			Expect(command).To(Equal(inputCommand{name: "msg", args: []string{"bob", "hello   there"}}))
+		})
+
+		It("should report arguments that can not be parsed", func() {
+			command, isCommand := parseInput(`/login bob "pass`)
+			Expect(isCommand).To(BeTrue())
+			Expect(command.err).To(MatchError(domain.ErrUnterminatedQuote))
+		})
+
+		It("should not treat text messages as commands", func() {
+			_, isCommand := parseInput("hello /msg")
+			Expect(isCommand).To(BeFalse())
+		})
+	})
+
+	Context("#commandSuggestions", func() {
+		It("should contain the commands known to the client until the server listed its commands", func() {
+			Expect(commandSuggestions(nil)).To(ContainElements("/msg", "/login", "/quit"))
+			Expect(commandSuggestions(nil)).NotTo(ContainElement("/unknown"))
+		})
+
+		It("should contain the commands listed by the server", func() {
+			Expect(commandSuggestions([]string{"help", "roll"})).To(Equal([]string{"/help", "/roll"}))
+		})
+	})
+
+	Context("#resolveCommand", func() {
+		It("should resolve aliases", func() {
+			Expect(resolveCommand("m")).To(Equal(domain.PrivateMessage))
+			Expect(resolveCommand("exit")).To(Equal(domain.Quit))
+			Expect(resolveCommand("roll")).To(Equal(domain.Unknown))
+		})
+	})
+
+	Context("#run", func() {
+		var (
+			port           int
+			userRepository domain.UserRepository
+			messages       chan tea.Msg
+		)
+
+		startServer := func() context.CancelFunc {
+			cfg := config.Default()
+			cfg.Address = "127.0.0.1"
+			cfg.Port = port
+			server, err := plugin.NewTCPChatServer(cfg, userRepository, domain.NewInMemoryBanRepository())
+			Expect(err).To(BeNil())
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan error, 1)
+			go func() {
+				stopped <- server.Start(ctx)
+			}()
+			return func() {
+				cancel()
+				Eventually(stopped, 5*time.Second).Should(Receive(BeNil()))
+			}
+		}
+
+		// receive returns the first message that matches, skipping all others.
+		receive := func(matcher OmegaMatcher) {
+			Eventually(messages, 10*time.Second).Should(Receive(matcher))
+		}
+
+		BeforeEach(func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).To(BeNil())
+			port = listener.Addr().(*net.TCPAddr).Port
+			Expect(listener.Close()).To(Succeed())
+			userRepository = domain.NewInMemoryUserRepository()
+			user, err := domain.NewUser("alice", "s3cret-pw")
+			Expect(err).To(BeNil())
+			userRepository.Add(user)
+			messages = make(chan tea.Msg, 100)
+		})
+
+		It("should log in again after reconnecting", func() {
+			stopServer := startServer()
+			address := fmt.Sprintf("127.0.0.1:%d", port)
+			connection := newConnection(address, func(ctx context.Context) (*client.Client, error) {
+				return client.Dial(ctx, address)
+			})
+			connection.setCredentials("alice", "s3cret-pw")
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				connection.run(ctx, func(msg tea.Msg) { messages <- msg })
+			}()
+			DeferCleanup(func() {
+				cancel()
+				Eventually(stopped, 5*time.Second).Should(BeClosed())
+			})
+			receive(Equal(statusMsg("Logged in as alice")))
+
+			stopServer()
+			receive(BeAssignableToTypeOf(errorMsg{}))
+			DeferCleanup(startServer())
+			receive(Equal(statusMsg("Logged in as alice")))
+
+			Expect(connection.execute("hello again")()).To(Equal(sentMsg{message: "hello again"}))
+			Expect(connection.execute("/join general")()).To(BeNil())
+			receive(And(BeAssignableToTypeOf(eventMsg{}), HaveField("Message", "Joined #general")))
+		})
+
+		It("should list the commands the user may use after logging in", func() {
+			user, _ := userRepository.FindByName("alice")
+			Expect(userRepository.SetRole(user.ID, domain.RoleAdmin)).To(BeTrue())
+			DeferCleanup(startServer())
+			address := fmt.Sprintf("127.0.0.1:%d", port)
+			connection := newConnection(address, func(ctx context.Context) (*client.Client, error) {
+				return client.Dial(ctx, address)
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				connection.run(ctx, func(msg tea.Msg) { messages <- msg })
+			}()
+			DeferCleanup(func() {
+				cancel()
+				Eventually(stopped, 5*time.Second).Should(BeClosed())
+			})
+			receive(And(BeAssignableToTypeOf(commandsMsg{}), ContainElement("msg"), Not(ContainElement("op"))))
+
+			msg := connection.execute("/login alice s3cret-pw")()
+			Expect(msg).To(BeAssignableToTypeOf(tea.BatchMsg{}))
+			batch := msg.(tea.BatchMsg)
+			Expect(batch).To(HaveLen(2))
+			Expect(batch[0]()).To(Equal(statusMsg("Logged in as alice")))
+			Expect(batch[1]()).To(And(BeAssignableToTypeOf(commandsMsg{}), ContainElement("op")))
+		})
+	})
+})
@@ -0,0 +1,59 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+// Command tcpchat-client is an interactive terminal client for the tcpchat server.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/benedictweis/tcpchat-server-go/client"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func main() {
+	flags := flag.NewFlagSet("tcpchat-client", flag.ContinueOnError)
+	address := flags.String("address", "localhost:8080", "address of the server")
+	useTLS := flags.Bool("tls", false, "connect using tls")
+	insecureSkipVerify := flags.Bool("insecure-skip-verify", false, "do not verify the certificate of the server")
+	userName := flags.String("user", "", "user to log in as after connecting")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: tcpchat-client [options]\n\nThe password for -user is read from TCPCHAT_PASSWORD.\n\nOptions:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		os.Exit(2)
+	}
+
+	dial := func(ctx context.Context) (*client.Client, error) {
+		return client.Dial(ctx, *address)
+	}
+	if *useTLS {
+		tlsConfig := &tls.Config{InsecureSkipVerify: *insecureSkipVerify}
+		dial = func(ctx context.Context) (*client.Client, error) {
+			return client.DialTLS(ctx, *address, tlsConfig)
+		}
+	}
+	connection := newConnection(*address, dial)
+	if *userName != "" {
+		connection.setCredentials(*userName, os.Getenv("TCPCHAT_PASSWORD"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	program := tea.NewProgram(newModel(connection), tea.WithAltScreen(), tea.WithMouseCellMotion())
+	go connection.run(ctx, program.Send)
+	if _, err := program.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
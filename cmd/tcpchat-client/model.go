@@ -0,0 +1,201 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/client"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// scrollbackLines is the number of lines kept in the scrollback, older lines are discarded.
+const scrollbackLines = 5000
+
+var (
+	// nameColors are the colors user names are shown in, every name always gets the same color.
+	nameColors   = []lipgloss.Color{"1", "2", "3", "4", "5", "6", "9", "10", "11", "12", "13", "14"}
+	timeStyle    = lipgloss.NewStyle().Faint(true)
+	serverStyle  = lipgloss.NewStyle().Faint(true)
+	errorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	privateStyle = lipgloss.NewStyle().Italic(true)
+	dividerStyle = lipgloss.NewStyle().Faint(true)
+)
+
+type model struct {
+	connection *connection
+	scrollback viewport.Model
+	input      textinput.Model
+	lines      []string
+	width      int
+}
+
+func newModel(connection *connection) model {
+	input := textinput.New()
+	input.Prompt = "> "
+	input.Placeholder = "Type a message or /command, Tab completes commands"
+	input.ShowSuggestions = true
+	input.SetSuggestions(commandSuggestions(nil))
+	input.Focus()
+	return model{connection: connection, scrollback: viewport.New(0, 0), input: input, lines: make([]string, 0)}
+}
+
+func (m model) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.scrollback.Width = msg.Width
+		// The last two lines are used by the divider and the input line.
+		m.scrollback.Height = max(msg.Height-2, 1)
+		m.input.Width = max(msg.Width-len(m.input.Prompt)-1, 1)
+		m.scrollback.SetContent(strings.Join(m.lines, "\n"))
+		m.scrollback.GotoBottom()
+		return m, nil
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.scrollback, cmd = m.scrollback.Update(msg)
+		return m, cmd
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			return m, tea.Quit
+		case tea.KeyPgUp:
+			m.scrollback.PageUp()
+			return m, nil
+		case tea.KeyPgDown:
+			m.scrollback.PageDown()
+			return m, nil
+		case tea.KeyEnter:
+			input := strings.TrimSpace(m.input.Value())
+			m.input.Reset()
+			if input == "" {
+				return m, nil
+			}
+			if command, isCommand := parseInput(input); isCommand && resolveCommand(domain.CommandType(command.name)) == domain.Quit {
+				return m, tea.Quit
+			}
+			return m, m.connection.execute(input)
+		}
+	case commandsMsg:
+		m.input.SetSuggestions(commandSuggestions(msg))
+		return m, nil
+	case eventMsg:
+		m.appendLines(renderEvent(client.Event(msg)))
+		return m, nil
+	case sentMsg:
+		if msg.recipient == "" {
+			m.appendLines(renderText(time.Now(), false, "you", msg.message))
+		} else {
+			m.appendLines(renderPrivate(time.Now(), false, "you", msg.recipient, msg.message))
+		}
+		return m, nil
+	case statusMsg:
+		m.appendLines(renderServer(time.Now(), string(msg)))
+		return m, nil
+	case errorMsg:
+		m.appendLines(renderError(time.Now(), msg.err.Error()))
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// appendLines adds text to the scrollback, the view follows new lines unless the user scrolled up.
+func (m *model) appendLines(text string) {
+	follow := m.scrollback.AtBottom()
+	m.lines = append(m.lines, strings.Split(text, "\n")...)
+	if len(m.lines) > scrollbackLines {
+		m.lines = m.lines[len(m.lines)-scrollbackLines:]
+	}
+	m.scrollback.SetContent(strings.Join(m.lines, "\n"))
+	if follow {
+		m.scrollback.GotoBottom()
+	}
+}
+
+func (m model) View() string {
+	return fmt.Sprintf("%s\n%s\n%s", m.scrollback.View(), dividerStyle.Render(strings.Repeat("─", max(m.width, 1))), m.input.View())
+}
+
+// renderEvent renders an event as one or more lines for the scrollback.
+func renderEvent(event client.Event) string {
+	switch event.Type {
+	case client.EventText:
+		return renderText(event.Timestamp, event.Replayed, event.Sender, event.Message)
+	case client.EventPrivate:
+		return renderPrivate(event.Timestamp, event.Replayed, event.Sender, event.Recipient, event.Message)
+	case client.EventUserList:
+		lines := []string{renderServer(event.Timestamp, "Logged in users:")}
+		for _, user := range event.Presence {
+			lines = append(lines, renderPresence(event.Timestamp, user))
+		}
+		return strings.Join(lines, "\n")
+	case client.EventError:
+		return renderError(event.Timestamp, event.Message)
+	default:
+		return renderServer(event.Timestamp, event.Message)
+	}
+}
+
+func renderText(timestamp time.Time, replayed bool, sender, message string) string {
+	return fmt.Sprintf("%s %s %s", renderTime(timestamp, replayed), renderName(sender), message)
+}
+
+func renderPrivate(timestamp time.Time, replayed bool, sender, recipient, message string) string {
+	return fmt.Sprintf("%s %s → %s %s", renderTime(timestamp, replayed), renderName(sender), renderName(recipient), privateStyle.Render(message))
+}
+
+func renderServer(timestamp time.Time, message string) string {
+	lines := strings.Split(message, "\n")
+	for index, line := range lines {
+		lines[index] = fmt.Sprintf("%s %s", renderTime(timestamp, false), serverStyle.Render("-- "+line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderPresence shows a user listed by /who along with its status and idle time.
+func renderPresence(timestamp time.Time, user client.UserPresence) string {
+	status := user.Status
+	if user.Reason != "" {
+		status = fmt.Sprintf("%s: %s", status, user.Reason)
+	}
+	return fmt.Sprintf("%s %s   %s %s", renderTime(timestamp, false), serverStyle.Render("--"), renderName(user.Name), serverStyle.Render(fmt.Sprintf("(%s, idle %s)", status, user.Idle())))
+}
+
+func renderError(timestamp time.Time, message string) string {
+	return fmt.Sprintf("%s %s", renderTime(timestamp, false), errorStyle.Render("!! "+message))
+}
+
+// renderTime shows the time of day, replayed messages also show the date because they may be old.
+func renderTime(timestamp time.Time, replayed bool) string {
+	layout := time.TimeOnly
+	if replayed {
+		layout = time.DateTime
+	}
+	return timeStyle.Render(timestamp.Local().Format(layout))
+}
+
+func renderName(userName string) string {
+	return lipgloss.NewStyle().Bold(true).Foreground(nameColor(userName)).Render(userName)
+}
+
+func nameColor(userName string) lipgloss.Color {
+	hash := fnv.New32a()
+	hash.Write([]byte(userName))
+	return nameColors[hash.Sum32()%uint32(len(nameColors))]
+}
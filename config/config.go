@@ -0,0 +1,688 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+// Package config loads the configuration of the server.
+//
+// Every setting can be given in an optional YAML config file, as an environment variable and as a command-line flag.
+// Settings are merged with the following precedence, from lowest to highest:
+//
+//  1. the defaults returned by Default
+//  2. the config file given by the -config flag or the TCPCHAT_CONFIG environment variable
+//  3. environment variables prefixed with TCPCHAT_
+//  4. command-line flags
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/application"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// minAdminTokenLength is the minimum length of the admin token, shorter tokens are too easy to guess.
+const minAdminTokenLength = 16
+
+const (
+	envPrefix     = "TCPCHAT_"
+	configFlag    = "config"
+	configEnvName = envPrefix + "CONFIG"
+)
+
+type Config struct {
+	Address     string            `yaml:"address"`
+	Port        int               `yaml:"port"`
+	Log         LogConfig         `yaml:"log"`
+	UsersFile   string            `yaml:"usersFile"`
+	BcryptCost  int               `yaml:"bcryptCost"`
+	Admins      []string          `yaml:"admins"`
+	BansFile    string            `yaml:"bansFile"`
+	TLS         TLSConfig         `yaml:"tls"`
+	Buffers     BuffersConfig     `yaml:"buffers"`
+	Limits      LimitsConfig      `yaml:"limits"`
+	Delivery    DeliveryConfig    `yaml:"delivery"`
+	Processing  ProcessingConfig  `yaml:"processing"`
+	History     HistoryConfig     `yaml:"history"`
+	WebSocket   WebSocketConfig   `yaml:"websocket"`
+	IRC         IRCConfig         `yaml:"irc"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Lockout     LockoutConfig     `yaml:"lockout"`
+	Passwords   PasswordsConfig   `yaml:"passwords"`
+	Sessions    SessionsConfig    `yaml:"sessions"`
+	Flood       FloodConfig       `yaml:"flood"`
+	Connections ConnectionsConfig `yaml:"connections"`
+}
+
+type LogConfig struct {
+	// Level is one of debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is either text or json.
+	Format string `yaml:"format"`
+}
+
+type TLSConfig struct {
+	CertFile     string `yaml:"certFile"`
+	KeyFile      string `yaml:"keyFile"`
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+// Enabled reports whether the server should only accept connections using TLS.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != ""
+}
+
+type WebSocketConfig struct {
+	// Address is the host:port the websocket listener listens on, websockets are disabled if it is empty.
+	Address string `yaml:"address"`
+	// Path is the http path websocket connections are upgraded on.
+	Path string `yaml:"path"`
+	// AllowedOrigins are the origins browsers may connect from besides the same origin, "*" allows every origin.
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+}
+
+// Enabled reports whether the websocket listener should be started.
+func (w WebSocketConfig) Enabled() bool {
+	return w.Address != ""
+}
+
+type IRCConfig struct {
+	// Address is the host:port the irc listener listens on, irc is disabled if it is empty.
+	Address string `yaml:"address"`
+	// ServerName is the name the server uses as the prefix of irc messages.
+	ServerName string `yaml:"serverName"`
+}
+
+// Enabled reports whether the irc listener should be started.
+func (i IRCConfig) Enabled() bool {
+	return i.Address != ""
+}
+
+type MetricsConfig struct {
+	// Address is the host:port the metrics listener listens on, metrics are not exposed if it is empty.
+	Address string `yaml:"address"`
+	// Path is the http path the metrics are exposed on in the prometheus text format.
+	Path string `yaml:"path"`
+}
+
+// Enabled reports whether the metrics listener should be started.
+func (m MetricsConfig) Enabled() bool {
+	return m.Address != ""
+}
+
+type AdminConfig struct {
+	// Address is the host:port the admin api listens on, the admin api is disabled if it is empty.
+	Address string `yaml:"address"`
+	// Token has to be sent as a bearer token with every request to the admin api.
+	Token string `yaml:"token"`
+}
+
+// Enabled reports whether the admin api should be started.
+func (a AdminConfig) Enabled() bool {
+	return a.Address != ""
+}
+
+type LockoutConfig struct {
+	// MaxUserFailures is the number of consecutive failed logins after which a user is locked out for Duration,
+	// zero disables the lockout of users.
+	MaxUserFailures int `yaml:"maxUserFailures"`
+	// MaxHostFailures is the number of consecutive failed logins after which a remote host is locked out for Duration,
+	// zero disables the lockout of hosts.
+	MaxHostFailures int `yaml:"maxHostFailures"`
+	// BaseDelay is how long logins are blocked after the second failed login, the delay doubles with every further failure.
+	BaseDelay time.Duration `yaml:"baseDelay"`
+	// Duration is how long logins are blocked after too many failed logins.
+	Duration time.Duration `yaml:"duration"`
+}
+
+type PasswordsConfig struct {
+	// MinLength is the minimum number of characters of a password.
+	MinLength int `yaml:"minLength"`
+	// MinCharacterClasses is how many of lowercase letters, uppercase letters, digits and symbols a password has to contain.
+	MinCharacterClasses int `yaml:"minCharacterClasses"`
+	// DenyCommon rejects a built-in list of commonly used passwords.
+	DenyCommon bool `yaml:"denyCommon"`
+	// DenyListFile is the path of a file containing further passwords to reject, one per line.
+	DenyListFile string `yaml:"denyListFile"`
+}
+
+type SessionsConfig struct {
+	// MaxPerUser is the number of sessions a user may be logged in on at the same time, zero allows any number.
+	MaxPerUser int `yaml:"maxPerUser"`
+	// LimitPolicy is applied when a user logs in on more than MaxPerUser sessions, either reject or replace-oldest.
+	LimitPolicy string `yaml:"limitPolicy"`
+}
+
+type FloodConfig struct {
+	// Session, User and Host rate limit the lines of a single session, of all sessions of a user and of all
+	// sessions from a remote host.
+	Session RateLimitConfig `yaml:"session"`
+	User    RateLimitConfig `yaml:"user"`
+	Host    RateLimitConfig `yaml:"host"`
+	// MuteAfter is the number of lines exceeding the limits after which a session is muted, zero disables muting.
+	MuteAfter int `yaml:"muteAfter"`
+	// MuteDuration is how long the lines of a muted session are dropped.
+	MuteDuration time.Duration `yaml:"muteDuration"`
+	// DisconnectAfter is the number of lines exceeding the limits after which a session is closed, zero disables it.
+	DisconnectAfter int `yaml:"disconnectAfter"`
+	// ForgiveAfter is how long a session has to stay within the limits for its violations to be forgotten.
+	ForgiveAfter time.Duration `yaml:"forgiveAfter"`
+}
+
+func newFloodConfig(policy domain.FloodPolicy) FloodConfig {
+	return FloodConfig{
+		Session:         newRateLimitConfig(policy.Session),
+		User:            newRateLimitConfig(policy.User),
+		Host:            newRateLimitConfig(policy.Host),
+		MuteAfter:       policy.MuteAfter,
+		MuteDuration:    policy.MuteDuration,
+		DisconnectAfter: policy.DisconnectAfter,
+		ForgiveAfter:    policy.ForgiveAfter,
+	}
+}
+
+// Policy returns the flood policy of the chat service described by the config.
+func (f FloodConfig) Policy() domain.FloodPolicy {
+	return domain.FloodPolicy{
+		Session:         f.Session.RateLimit(),
+		User:            f.User.RateLimit(),
+		Host:            f.Host.RateLimit(),
+		MuteAfter:       f.MuteAfter,
+		MuteDuration:    f.MuteDuration,
+		DisconnectAfter: f.DisconnectAfter,
+		ForgiveAfter:    f.ForgiveAfter,
+	}
+}
+
+// RateLimitConfig is a token bucket, Burst lines may be sent at once and one more line every Refill.
+type RateLimitConfig struct {
+	// Burst is the size of the bucket, zero disables the limit.
+	Burst  int           `yaml:"burst"`
+	Refill time.Duration `yaml:"refill"`
+}
+
+func newRateLimitConfig(rateLimit domain.RateLimit) RateLimitConfig {
+	return RateLimitConfig{Burst: rateLimit.Burst, Refill: rateLimit.RefillInterval}
+}
+
+// RateLimit returns the rate limit described by the config.
+func (r RateLimitConfig) RateLimit() domain.RateLimit {
+	return domain.RateLimit{Burst: r.Burst, RefillInterval: r.Refill}
+}
+
+type ConnectionsConfig struct {
+	// MaxTotal is the number of connections accepted on all chat listeners together, zero allows any number.
+	MaxTotal int `yaml:"maxTotal"`
+	// MaxPerHost is the number of connections accepted from a single remote host, zero allows any number.
+	MaxPerHost int `yaml:"maxPerHost"`
+	// IdleTimeout is the time after which a connection that did not send anything is closed, zero disables it.
+	IdleTimeout time.Duration `yaml:"idleTimeout"`
+	// IdleWarning is how long before the idle timeout the session is warned.
+	IdleWarning time.Duration `yaml:"idleWarning"`
+	// WriteTimeout is the time writing a single message to a connection may take before the connection is closed.
+	WriteTimeout time.Duration   `yaml:"writeTimeout"`
+	KeepAlive    KeepAliveConfig `yaml:"keepAlive"`
+}
+
+// KeepAliveConfig configures tcp keepalive probes, which detect connections whose remote host is gone.
+type KeepAliveConfig struct {
+	// Idle is the time a connection has to be idle before probes are sent, zero disables keepalive.
+	Idle time.Duration `yaml:"idle"`
+	// Interval is the time between two probes.
+	Interval time.Duration `yaml:"interval"`
+	// Count is the number of unanswered probes after which the connection is closed.
+	Count int `yaml:"count"`
+}
+
+type BuffersConfig struct {
+	// IncomingMessages is the number of read messages that may be queued before they are converted.
+	IncomingMessages int `yaml:"incomingMessages"`
+	// AcceptedConnections is the number of accepted connections that may be queued before they are handled.
+	AcceptedConnections int `yaml:"acceptedConnections"`
+}
+
+type LimitsConfig struct {
+	// MaxLineLength is the maximum number of bytes of a single line sent by a client, longer lines are truncated.
+	MaxLineLength int `yaml:"maxLineLength"`
+	// MailboxCapacity is the number of private messages kept for a user that is not logged in.
+	MailboxCapacity int `yaml:"mailboxCapacity"`
+}
+
+type DeliveryConfig struct {
+	// QueueSize is the number of messages that may wait to be written to a single session.
+	QueueSize int `yaml:"queueSize"`
+	// OverflowPolicy is applied when the queue of a session is full, one of drop-oldest, disconnect or block.
+	OverflowPolicy string `yaml:"overflowPolicy"`
+	// BlockTimeout is how long the block policy waits for room in a full queue before the message is dropped.
+	BlockTimeout time.Duration `yaml:"blockTimeout"`
+}
+
+type ProcessingConfig struct {
+	// Workers is the number of goroutines handling sessions in parallel, messages of a single session are always
+	// handled in order by the same worker.
+	Workers int `yaml:"workers"`
+}
+
+type HistoryConfig struct {
+	// Capacity is the number of messages kept in the history, older messages are discarded.
+	Capacity int `yaml:"capacity"`
+	// ReplayOnLogin is the number of messages replayed to a session after logging in.
+	ReplayOnLogin int `yaml:"replayOnLogin"`
+}
+
+// Default returns the configuration used when nothing else is configured.
+func Default() Config {
+	// The defaults of the chat service are kept by the application, so that both can not drift apart.
+	options := application.DefaultOptions()
+	passwordPolicy := application.DefaultPasswordPolicy()
+	return Config{
+		Address:    "localhost",
+		Port:       8080,
+		Log:        LogConfig{Level: "info", Format: "text"},
+		BcryptCost: bcrypt.DefaultCost,
+		Buffers:    BuffersConfig{IncomingMessages: 5, AcceptedConnections: 5},
+		Limits:     LimitsConfig{MaxLineLength: 4096, MailboxCapacity: options.MailboxCapacity},
+		Delivery:   DeliveryConfig{QueueSize: 256, OverflowPolicy: domain.OverflowDropOldest.String(), BlockTimeout: time.Second},
+		Processing: ProcessingConfig{Workers: runtime.NumCPU()},
+		History:    HistoryConfig{Capacity: 1000, ReplayOnLogin: options.HistoryReplayCount},
+		WebSocket:  WebSocketConfig{Path: "/"},
+		IRC:        IRCConfig{ServerName: "tcpchat"},
+		Metrics:    MetricsConfig{Path: "/metrics"},
+		Passwords:  PasswordsConfig{MinLength: passwordPolicy.MinLength, MinCharacterClasses: passwordPolicy.MinCharacterClasses, DenyCommon: true},
+		Lockout: LockoutConfig{
+			MaxUserFailures: options.UserLockout.MaxFailures,
+			MaxHostFailures: options.HostLockout.MaxFailures,
+			BaseDelay:       options.UserLockout.BaseDelay,
+			Duration:        options.UserLockout.Duration,
+		},
+		Sessions: SessionsConfig{MaxPerUser: options.MaxSessionsPerUser, LimitPolicy: options.SessionLimitPolicy.String()},
+		Flood:    newFloodConfig(options.FloodPolicy),
+		Connections: ConnectionsConfig{
+			MaxTotal:     10000,
+			MaxPerHost:   100,
+			IdleTimeout:  time.Hour,
+			IdleWarning:  time.Minute,
+			WriteTimeout: 10 * time.Second,
+			KeepAlive:    KeepAliveConfig{Idle: 30 * time.Second, Interval: 15 * time.Second, Count: 4},
+		},
+	}
+}
+
+// option is a single setting that can be set using a flag or an environment variable.
+type option struct {
+	name  string
+	usage string
+	// register defines the flag of the option with the value of the option in defaults as its default.
+	register func(flagSet *flag.FlagSet, defaults Config, usage string)
+	set      func(c *Config, value string) error
+}
+
+// envName returns the name of the environment variable of the option, e.g. TCPCHAT_LOG_LEVEL for log-level.
+func (o option) envName() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(o.name, "-", "_"))
+}
+
+func stringOption(name, usage string, field func(c *Config) *string) option {
+	return option{
+		name:  name,
+		usage: usage,
+		register: func(flagSet *flag.FlagSet, defaults Config, usage string) {
+			flagSet.String(name, *field(&defaults), usage)
+		},
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+func intOption(name, usage string, field func(c *Config) *int) option {
+	return option{
+		name:  name,
+		usage: usage,
+		register: func(flagSet *flag.FlagSet, defaults Config, usage string) {
+			flagSet.Int(name, *field(&defaults), usage)
+		},
+		set: func(c *Config, value string) error {
+			parsedValue, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s must be an integer: %w", name, err)
+			}
+			*field(c) = parsedValue
+			return nil
+		},
+	}
+}
+
+func boolOption(name, usage string, field func(c *Config) *bool) option {
+	return option{
+		name:  name,
+		usage: usage,
+		register: func(flagSet *flag.FlagSet, defaults Config, usage string) {
+			flagSet.Bool(name, *field(&defaults), usage)
+		},
+		set: func(c *Config, value string) error {
+			parsedValue, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s must be a boolean: %w", name, err)
+			}
+			*field(c) = parsedValue
+			return nil
+		},
+	}
+}
+
+func durationOption(name, usage string, field func(c *Config) *time.Duration) option {
+	return option{
+		name:  name,
+		usage: usage,
+		register: func(flagSet *flag.FlagSet, defaults Config, usage string) {
+			flagSet.Duration(name, *field(&defaults), usage)
+		},
+		set: func(c *Config, value string) error {
+			parsedValue, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s must be a duration: %w", name, err)
+			}
+			*field(c) = parsedValue
+			return nil
+		},
+	}
+}
+
+// stringListOption is an option holding a comma separated list of strings.
+func stringListOption(name, usage string, field func(c *Config) *[]string) option {
+	return option{
+		name:  name,
+		usage: usage + ", comma separated",
+		register: func(flagSet *flag.FlagSet, defaults Config, usage string) {
+			flagSet.String(name, strings.Join(*field(&defaults), ","), usage)
+		},
+		set: func(c *Config, value string) error {
+			*field(c) = make([]string, 0)
+			for _, element := range strings.Split(value, ",") {
+				if element = strings.TrimSpace(element); element != "" {
+					*field(c) = append(*field(c), element)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func options() []option {
+	return []option{
+		stringOption("address", "address to listen on", func(c *Config) *string { return &c.Address }),
+		intOption("port", "port to listen on", func(c *Config) *int { return &c.Port }),
+		stringOption("log-level", "log level, one of debug, info, warn or error", func(c *Config) *string { return &c.Log.Level }),
+		stringOption("log-format", "log format, either text or json", func(c *Config) *string { return &c.Log.Format }),
+		stringOption("users-file", "path of the file user accounts are persisted in, accounts are only kept in memory if empty", func(c *Config) *string { return &c.UsersFile }),
+		intOption("bcrypt-cost", "bcrypt cost used to hash passwords", func(c *Config) *int { return &c.BcryptCost }),
+		stringListOption("admins", "names of users that are made admins when they log in", func(c *Config) *[]string { return &c.Admins }),
+		stringOption("bans-file", "path of the file bans are persisted in, bans are only kept in memory if empty", func(c *Config) *string { return &c.BansFile }),
+		stringOption("tls-cert", "path of the tls certificate, tls is enabled if set", func(c *Config) *string { return &c.TLS.CertFile }),
+		stringOption("tls-key", "path of the tls private key", func(c *Config) *string { return &c.TLS.KeyFile }),
+		stringOption("tls-client-ca", "path of the ca certificates client certificates are verified with, enables mutual tls if set", func(c *Config) *string { return &c.TLS.ClientCAFile }),
+		intOption("incoming-message-buffer", "number of read messages that may be queued before they are converted", func(c *Config) *int { return &c.Buffers.IncomingMessages }),
+		intOption("accepted-connection-buffer", "number of accepted connections that may be queued before they are handled", func(c *Config) *int { return &c.Buffers.AcceptedConnections }),
+		intOption("max-line-length", "maximum number of bytes of a single line sent by a client", func(c *Config) *int { return &c.Limits.MaxLineLength }),
+		intOption("mailbox-capacity", "number of private messages kept for a user that is not logged in", func(c *Config) *int { return &c.Limits.MailboxCapacity }),
+		intOption("delivery-queue-size", "number of messages that may wait to be written to a single session", func(c *Config) *int { return &c.Delivery.QueueSize }),
+		stringOption("delivery-overflow-policy", "policy applied when the queue of a session is full, one of drop-oldest, disconnect or block", func(c *Config) *string { return &c.Delivery.OverflowPolicy }),
+		durationOption("delivery-block-timeout", "time the block policy waits for room in a full queue before the message is dropped", func(c *Config) *time.Duration { return &c.Delivery.BlockTimeout }),
+		intOption("processing-workers", "number of goroutines handling sessions in parallel", func(c *Config) *int { return &c.Processing.Workers }),
+		intOption("history-capacity", "number of messages kept in the history", func(c *Config) *int { return &c.History.Capacity }),
+		intOption("history-replay-on-login", "number of messages replayed to a session after logging in", func(c *Config) *int { return &c.History.ReplayOnLogin }),
+		stringOption("websocket-address", "host:port the websocket listener listens on, websockets are disabled if empty", func(c *Config) *string { return &c.WebSocket.Address }),
+		stringOption("websocket-path", "http path websocket connections are upgraded on", func(c *Config) *string { return &c.WebSocket.Path }),
+		stringListOption("websocket-allowed-origins", "origins browsers may connect from besides the same origin, * allows every origin", func(c *Config) *[]string { return &c.WebSocket.AllowedOrigins }),
+		stringOption("irc-address", "host:port the irc listener listens on, irc is disabled if empty", func(c *Config) *string { return &c.IRC.Address }),
+		stringOption("irc-server-name", "name the server uses as the prefix of irc messages", func(c *Config) *string { return &c.IRC.ServerName }),
+		stringOption("metrics-address", "host:port the metrics listener listens on, metrics are not exposed if empty", func(c *Config) *string { return &c.Metrics.Address }),
+		stringOption("metrics-path", "http path the metrics are exposed on", func(c *Config) *string { return &c.Metrics.Path }),
+		stringOption("admin-address", "host:port the admin api listens on, the admin api is disabled if empty", func(c *Config) *string { return &c.Admin.Address }),
+		stringOption("admin-token", "bearer token required by the admin api, prefer setting it using the environment", func(c *Config) *string { return &c.Admin.Token }),
+		intOption("password-min-length", "minimum number of characters of a password", func(c *Config) *int { return &c.Passwords.MinLength }),
+		intOption("password-min-character-classes", "how many of lowercase letters, uppercase letters, digits and symbols a password has to contain", func(c *Config) *int { return &c.Passwords.MinCharacterClasses }),
+		boolOption("password-deny-common", "reject a built-in list of commonly used passwords", func(c *Config) *bool { return &c.Passwords.DenyCommon }),
+		stringOption("password-deny-list-file", "path of a file containing further passwords to reject, one per line", func(c *Config) *string { return &c.Passwords.DenyListFile }),
+		intOption("lockout-max-user-failures", "number of consecutive failed logins after which a user is locked out, 0 disables it", func(c *Config) *int { return &c.Lockout.MaxUserFailures }),
+		intOption("lockout-max-host-failures", "number of consecutive failed logins after which a remote host is locked out, 0 disables it", func(c *Config) *int { return &c.Lockout.MaxHostFailures }),
+		durationOption("lockout-base-delay", "time logins are blocked after the second failed login, doubled with every further failure", func(c *Config) *time.Duration { return &c.Lockout.BaseDelay }),
+		durationOption("lockout-duration", "time logins are blocked after too many failed logins", func(c *Config) *time.Duration { return &c.Lockout.Duration }),
+		intOption("sessions-max-per-user", "number of sessions a user may be logged in on at the same time, 0 allows any number", func(c *Config) *int { return &c.Sessions.MaxPerUser }),
+		stringOption("sessions-limit-policy", "policy applied when a user logs in on too many sessions, either reject or replace-oldest", func(c *Config) *string { return &c.Sessions.LimitPolicy }),
+		intOption("flood-session-burst", "number of lines a session may send at once, 0 disables the limit", func(c *Config) *int { return &c.Flood.Session.Burst }),
+		durationOption("flood-session-refill", "time after which a session may send another line", func(c *Config) *time.Duration { return &c.Flood.Session.Refill }),
+		intOption("flood-user-burst", "number of lines all sessions of a user may send at once, 0 disables the limit", func(c *Config) *int { return &c.Flood.User.Burst }),
+		durationOption("flood-user-refill", "time after which the sessions of a user may send another line", func(c *Config) *time.Duration { return &c.Flood.User.Refill }),
+		intOption("flood-host-burst", "number of lines all sessions from a remote host may send at once, 0 disables the limit", func(c *Config) *int { return &c.Flood.Host.Burst }),
+		durationOption("flood-host-refill", "time after which the sessions from a remote host may send another line", func(c *Config) *time.Duration { return &c.Flood.Host.Refill }),
+		intOption("flood-mute-after", "number of lines exceeding the limits after which a session is muted, 0 disables muting", func(c *Config) *int { return &c.Flood.MuteAfter }),
+		durationOption("flood-mute-duration", "time the lines of a muted session are dropped", func(c *Config) *time.Duration { return &c.Flood.MuteDuration }),
+		intOption("flood-disconnect-after", "number of lines exceeding the limits after which a session is closed, 0 disables it", func(c *Config) *int { return &c.Flood.DisconnectAfter }),
+		durationOption("flood-forgive-after", "time a session has to stay within the limits for its violations to be forgotten", func(c *Config) *time.Duration { return &c.Flood.ForgiveAfter }),
+		intOption("connections-max-total", "number of connections accepted on all chat listeners together, 0 allows any number", func(c *Config) *int { return &c.Connections.MaxTotal }),
+		intOption("connections-max-per-host", "number of connections accepted from a single remote host, 0 allows any number", func(c *Config) *int { return &c.Connections.MaxPerHost }),
+		durationOption("connections-idle-timeout", "time after which a connection that did not send anything is closed, 0 disables it", func(c *Config) *time.Duration { return &c.Connections.IdleTimeout }),
+		durationOption("connections-idle-warning", "time before the idle timeout at which the session is warned", func(c *Config) *time.Duration { return &c.Connections.IdleWarning }),
+		durationOption("connections-write-timeout", "time writing a single message to a connection may take", func(c *Config) *time.Duration { return &c.Connections.WriteTimeout }),
+		durationOption("connections-keepalive-idle", "time a connection has to be idle before keepalive probes are sent, 0 disables keepalive", func(c *Config) *time.Duration { return &c.Connections.KeepAlive.Idle }),
+		durationOption("connections-keepalive-interval", "time between two keepalive probes", func(c *Config) *time.Duration { return &c.Connections.KeepAlive.Interval }),
+		intOption("connections-keepalive-count", "number of unanswered keepalive probes after which a connection is closed", func(c *Config) *int { return &c.Connections.KeepAlive.Count }),
+	}
+}
+
+// Load builds the configuration from the command-line arguments (without the program name), the environment
+// and the optional config file and validates it. flag.ErrHelp is returned if the usage was requested.
+func Load(arguments []string, lookupEnv func(string) (string, bool), output io.Writer) (Config, error) {
+	flagSet := flag.NewFlagSet("tcpchat-server-go", flag.ContinueOnError)
+	flagSet.SetOutput(output)
+	configFile := flagSet.String(configFlag, "", fmt.Sprintf("path of an optional YAML config file (env %s)", configEnvName))
+	for _, o := range options() {
+		o.register(flagSet, Default(), fmt.Sprintf("%s (env %s)", o.usage, o.envName()))
+	}
+	if err := flagSet.Parse(arguments); err != nil {
+		return Config{}, err
+	}
+	if flagSet.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments: %v", flagSet.Args())
+	}
+
+	config := Default()
+	if *configFile == "" {
+		*configFile, _ = lookupEnv(configEnvName)
+	}
+	if *configFile != "" {
+		if err := config.loadFile(*configFile); err != nil {
+			return Config{}, err
+		}
+	}
+	for _, o := range options() {
+		if value, isSet := lookupEnv(o.envName()); isSet {
+			if err := o.set(&config, value); err != nil {
+				return Config{}, fmt.Errorf("invalid environment variable %s: %w", o.envName(), err)
+			}
+		}
+	}
+	var flagErr error
+	flagSet.Visit(func(f *flag.Flag) {
+		for _, o := range options() {
+			if o.name == f.Name && flagErr == nil {
+				flagErr = o.set(&config, f.Value.String())
+			}
+		}
+	})
+	if flagErr != nil {
+		return Config{}, fmt.Errorf("invalid flag: %w", flagErr)
+	}
+	return config, config.Validate()
+}
+
+// loadFile overwrites all settings present in the YAML file at path.
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks that all settings have sensible values.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Port < 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 0 and 65535, got %d", c.Port))
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log level must be one of debug, info, warn or error, got %q", c.Log.Level))
+	}
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("log format must be either text or json, got %q", c.Log.Format))
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		errs = append(errs, fmt.Errorf("bcrypt cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.BcryptCost))
+	}
+	if c.TLS.Enabled() != (c.TLS.KeyFile != "") {
+		errs = append(errs, errors.New("tls certificate and key have to be set together"))
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled() {
+		errs = append(errs, errors.New("tls client ca requires a tls certificate and key"))
+	}
+	if c.Buffers.IncomingMessages < 0 {
+		errs = append(errs, fmt.Errorf("incoming message buffer must not be negative, got %d", c.Buffers.IncomingMessages))
+	}
+	if c.Buffers.AcceptedConnections < 0 {
+		errs = append(errs, fmt.Errorf("accepted connection buffer must not be negative, got %d", c.Buffers.AcceptedConnections))
+	}
+	if c.Limits.MaxLineLength <= 0 {
+		errs = append(errs, fmt.Errorf("max line length must be positive, got %d", c.Limits.MaxLineLength))
+	}
+	if c.Limits.MailboxCapacity < 0 {
+		errs = append(errs, fmt.Errorf("mailbox capacity must not be negative, got %d", c.Limits.MailboxCapacity))
+	}
+	if c.Delivery.QueueSize <= 0 {
+		errs = append(errs, fmt.Errorf("delivery queue size must be positive, got %d", c.Delivery.QueueSize))
+	}
+	if _, isKnown := domain.OverflowPolicyFromString(c.Delivery.OverflowPolicy); !isKnown {
+		errs = append(errs, fmt.Errorf("delivery overflow policy must be one of drop-oldest, disconnect or block, got %q", c.Delivery.OverflowPolicy))
+	}
+	if c.Delivery.BlockTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("delivery block timeout must be positive, got %s", c.Delivery.BlockTimeout))
+	}
+	if c.Processing.Workers <= 0 {
+		errs = append(errs, fmt.Errorf("processing workers must be positive, got %d", c.Processing.Workers))
+	}
+	if c.History.Capacity < 0 {
+		errs = append(errs, fmt.Errorf("history capacity must not be negative, got %d", c.History.Capacity))
+	}
+	if c.History.ReplayOnLogin < 0 {
+		errs = append(errs, fmt.Errorf("history replay on login must not be negative, got %d", c.History.ReplayOnLogin))
+	}
+	if c.WebSocket.Enabled() && !strings.HasPrefix(c.WebSocket.Path, "/") {
+		errs = append(errs, fmt.Errorf("websocket path must start with /, got %q", c.WebSocket.Path))
+	}
+	if c.IRC.Enabled() && (c.IRC.ServerName == "" || strings.ContainsAny(c.IRC.ServerName, " \r\n")) {
+		errs = append(errs, fmt.Errorf("irc server name must not be empty or contain spaces, got %q", c.IRC.ServerName))
+	}
+	if c.Metrics.Enabled() && !strings.HasPrefix(c.Metrics.Path, "/") {
+		errs = append(errs, fmt.Errorf("metrics path must start with /, got %q", c.Metrics.Path))
+	}
+	if c.Admin.Enabled() && len(c.Admin.Token) < minAdminTokenLength {
+		errs = append(errs, fmt.Errorf("admin token must be at least %d characters long if the admin api is enabled", minAdminTokenLength))
+	}
+	if c.Passwords.MinLength < 0 || c.Passwords.MinLength > domain.MaxPasswordBytes {
+		errs = append(errs, fmt.Errorf("password min length must be between 0 and %d, got %d", domain.MaxPasswordBytes, c.Passwords.MinLength))
+	}
+	if c.Passwords.MinCharacterClasses < 0 || c.Passwords.MinCharacterClasses > 4 {
+		errs = append(errs, fmt.Errorf("password min character classes must be between 0 and 4, got %d", c.Passwords.MinCharacterClasses))
+	}
+	if c.Lockout.MaxUserFailures < 0 {
+		errs = append(errs, fmt.Errorf("lockout max user failures must not be negative, got %d", c.Lockout.MaxUserFailures))
+	}
+	if c.Lockout.MaxHostFailures < 0 {
+		errs = append(errs, fmt.Errorf("lockout max host failures must not be negative, got %d", c.Lockout.MaxHostFailures))
+	}
+	if c.Lockout.BaseDelay < 0 {
+		errs = append(errs, fmt.Errorf("lockout base delay must not be negative, got %s", c.Lockout.BaseDelay))
+	}
+	if c.Lockout.Duration < c.Lockout.BaseDelay {
+		errs = append(errs, fmt.Errorf("lockout duration must not be shorter than the base delay, got %s", c.Lockout.Duration))
+	}
+	if c.Sessions.MaxPerUser < 0 {
+		errs = append(errs, fmt.Errorf("sessions max per user must not be negative, got %d", c.Sessions.MaxPerUser))
+	}
+	if _, isKnown := domain.SessionLimitPolicyFromString(c.Sessions.LimitPolicy); !isKnown {
+		errs = append(errs, fmt.Errorf("sessions limit policy must be either reject or replace-oldest, got %q", c.Sessions.LimitPolicy))
+	}
+	rateLimits := []struct {
+		name      string
+		rateLimit RateLimitConfig
+	}{{"session", c.Flood.Session}, {"user", c.Flood.User}, {"host", c.Flood.Host}}
+	for _, r := range rateLimits {
+		if r.rateLimit.Burst < 0 {
+			errs = append(errs, fmt.Errorf("flood %s burst must not be negative, got %d", r.name, r.rateLimit.Burst))
+		}
+		if r.rateLimit.Burst > 0 && r.rateLimit.Refill <= 0 {
+			errs = append(errs, fmt.Errorf("flood %s refill must be positive, got %s", r.name, r.rateLimit.Refill))
+		}
+	}
+	if c.Flood.MuteAfter < 0 {
+		errs = append(errs, fmt.Errorf("flood mute after must not be negative, got %d", c.Flood.MuteAfter))
+	}
+	if c.Flood.MuteAfter > 0 && c.Flood.MuteDuration <= 0 {
+		errs = append(errs, fmt.Errorf("flood mute duration must be positive, got %s", c.Flood.MuteDuration))
+	}
+	if c.Flood.DisconnectAfter < 0 {
+		errs = append(errs, fmt.Errorf("flood disconnect after must not be negative, got %d", c.Flood.DisconnectAfter))
+	}
+	if c.Flood.ForgiveAfter <= 0 {
+		errs = append(errs, fmt.Errorf("flood forgive after must be positive, got %s", c.Flood.ForgiveAfter))
+	}
+	if c.Connections.MaxTotal < 0 {
+		errs = append(errs, fmt.Errorf("connections max total must not be negative, got %d", c.Connections.MaxTotal))
+	}
+	if c.Connections.MaxPerHost < 0 {
+		errs = append(errs, fmt.Errorf("connections max per host must not be negative, got %d", c.Connections.MaxPerHost))
+	}
+	if c.Connections.IdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("connections idle timeout must not be negative, got %s", c.Connections.IdleTimeout))
+	}
+	if c.Connections.IdleTimeout > 0 && (c.Connections.IdleWarning < 0 || c.Connections.IdleWarning >= c.Connections.IdleTimeout) {
+		errs = append(errs, fmt.Errorf("connections idle warning must be between 0 and the idle timeout, got %s", c.Connections.IdleWarning))
+	}
+	if c.Connections.WriteTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("connections write timeout must be positive, got %s", c.Connections.WriteTimeout))
+	}
+	if c.Connections.KeepAlive.Idle < 0 {
+		errs = append(errs, fmt.Errorf("connections keepalive idle must not be negative, got %s", c.Connections.KeepAlive.Idle))
+	}
+	if c.Connections.KeepAlive.Idle > 0 && c.Connections.KeepAlive.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("connections keepalive interval must be positive, got %s", c.Connections.KeepAlive.Interval))
+	}
+	if c.Connections.KeepAlive.Idle > 0 && c.Connections.KeepAlive.Count <= 0 {
+		errs = append(errs, fmt.Errorf("connections keepalive count must be positive, got %d", c.Connections.KeepAlive.Count))
+	}
+	return errors.Join(errs...)
+}
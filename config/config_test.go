@@ -0,0 +1,196 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/application"
+	"github.com/benedictweis/tcpchat-server-go/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	Context("#Default", func() {
+		It("should use the defaults of the chat service", func() {
+			cfg := config.Default()
+			options := application.DefaultOptions()
+			Expect(cfg.History.ReplayOnLogin).To(Equal(options.HistoryReplayCount))
+			Expect(cfg.Limits.MailboxCapacity).To(Equal(options.MailboxCapacity))
+			Expect(cfg.Lockout.MaxUserFailures).To(Equal(options.UserLockout.MaxFailures))
+			Expect(cfg.Lockout.MaxHostFailures).To(Equal(options.HostLockout.MaxFailures))
+			Expect(cfg.Flood.Policy()).To(Equal(options.FloodPolicy))
+		})
+	})
+
+	Context("#Load", func() {
+		var (
+			environment map[string]string
+			lookupEnv   func(string) (string, bool)
+			configFile  string
+		)
+
+		BeforeEach(func() {
+			environment = make(map[string]string)
+			lookupEnv = func(key string) (string, bool) {
+				value, isSet := environment[key]
+				return value, isSet
+			}
+			configFile = filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		})
+
+		writeConfigFile := func(content string) {
+			Expect(os.WriteFile(configFile, []byte(content), 0o600)).To(Succeed())
+		}
+
+		Context("when nothing is configured", func() {
+			It("should return the defaults", func() {
+				cfg, err := config.Load(nil, lookupEnv, io.Discard)
+				Expect(err).To(BeNil())
+				Expect(cfg).To(Equal(config.Default()))
+			})
+		})
+
+		Context("when a setting is configured in multiple places", func() {
+			BeforeEach(func() {
+				writeConfigFile("port: 1000\naddress: file\nlog:\n  level: debug\n")
+				environment["TCPCHAT_CONFIG"] = configFile
+				environment["TCPCHAT_PORT"] = "2000"
+				environment["TCPCHAT_ADDRESS"] = "env"
+			})
+
+			It("should prefer flags over environment variables over the config file", func() {
+				cfg, err := config.Load([]string{"-port", "3000"}, lookupEnv, io.Discard)
+				Expect(err).To(BeNil())
+				Expect(cfg.Port).To(Equal(3000))
+				Expect(cfg.Address).To(Equal("env"))
+				Expect(cfg.Log.Level).To(Equal("debug"))
+				Expect(cfg.Log.Format).To(Equal(config.Default().Log.Format))
+			})
+		})
+
+		Context("when the config file is given as a flag", func() {
+			It("should load the config file", func() {
+				writeConfigFile("buffers:\n  incomingMessages: 42\n")
+				cfg, err := config.Load([]string{"-config", configFile}, lookupEnv, io.Discard)
+				Expect(err).To(BeNil())
+				Expect(cfg.Buffers.IncomingMessages).To(Equal(42))
+			})
+		})
+
+		Context("when the config file contains an unknown setting", func() {
+			It("should return an error", func() {
+				writeConfigFile("prot: 1000\n")
+				_, err := config.Load([]string{"-config", configFile}, lookupEnv, io.Discard)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when an integer setting is not a number", func() {
+			It("should return an error", func() {
+				environment["TCPCHAT_BCRYPT_COST"] = "high"
+				_, err := config.Load(nil, lookupEnv, io.Discard)
+				Expect(err).To(MatchError(ContainSubstring("TCPCHAT_BCRYPT_COST")))
+			})
+		})
+
+		Context("when a duration setting is configured", func() {
+			It("should parse durations in the config file and in environment variables", func() {
+				writeConfigFile("delivery:\n  blockTimeout: 250ms\n")
+				cfg, err := config.Load([]string{"-config", configFile}, lookupEnv, io.Discard)
+				Expect(err).To(BeNil())
+				Expect(cfg.Delivery.BlockTimeout).To(Equal(250 * time.Millisecond))
+
+				environment["TCPCHAT_DELIVERY_BLOCK_TIMEOUT"] = "2s"
+				cfg, err = config.Load([]string{"-config", configFile}, lookupEnv, io.Discard)
+				Expect(err).To(BeNil())
+				Expect(cfg.Delivery.BlockTimeout).To(Equal(2 * time.Second))
+			})
+		})
+
+		Context("when the usage is requested", func() {
+			It("should return flag.ErrHelp", func() {
+				_, err := config.Load([]string{"-h"}, lookupEnv, io.Discard)
+				Expect(errors.Is(err, flag.ErrHelp)).To(BeTrue())
+			})
+		})
+	})
+
+	Context("#Validate", func() {
+		DescribeTable("Validating configurations",
+			func(modify func(cfg *config.Config), expectedValid bool) {
+				cfg := config.Default()
+				modify(&cfg)
+				if expectedValid {
+					Expect(cfg.Validate()).To(Succeed())
+				} else {
+					Expect(cfg.Validate()).To(HaveOccurred())
+				}
+			},
+			Entry("When given the defaults", func(cfg *config.Config) {}, true),
+			Entry("When given a port out of range", func(cfg *config.Config) { cfg.Port = 70000 }, false),
+			Entry("When given an unknown log level", func(cfg *config.Config) { cfg.Log.Level = "verbose" }, false),
+			Entry("When given an unknown log format", func(cfg *config.Config) { cfg.Log.Format = "xml" }, false),
+			Entry("When given a bcrypt cost that is too low", func(cfg *config.Config) { cfg.BcryptCost = 1 }, false),
+			Entry("When given a tls certificate without a key", func(cfg *config.Config) { cfg.TLS.CertFile = "server.crt" }, false),
+			Entry("When given a tls client ca without a certificate", func(cfg *config.Config) { cfg.TLS.ClientCAFile = "ca.crt" }, false),
+			Entry("When given a negative buffer size", func(cfg *config.Config) { cfg.Buffers.IncomingMessages = -1 }, false),
+			Entry("When given a max line length of zero", func(cfg *config.Config) { cfg.Limits.MaxLineLength = 0 }, false),
+			Entry("When given a negative history capacity", func(cfg *config.Config) { cfg.History.Capacity = -1 }, false),
+			Entry("When given an unknown overflow policy", func(cfg *config.Config) { cfg.Delivery.OverflowPolicy = "ignore" }, false),
+			Entry("When given zero processing workers", func(cfg *config.Config) { cfg.Processing.Workers = 0 }, false),
+			Entry("When given an irc server name containing a space", func(cfg *config.Config) {
+				cfg.IRC.Address = "localhost:6667"
+				cfg.IRC.ServerName = "tcp chat"
+			}, false),
+			Entry("When given a metrics path without a leading slash", func(cfg *config.Config) {
+				cfg.Metrics.Address = "localhost:9090"
+				cfg.Metrics.Path = "metrics"
+			}, false),
+			Entry("When given an admin address without a token", func(cfg *config.Config) { cfg.Admin.Address = "localhost:9091" }, false),
+			Entry("When given an admin address with a token", func(cfg *config.Config) {
+				cfg.Admin.Address = "localhost:9091"
+				cfg.Admin.Token = "0123456789abcdef"
+			}, true),
+			Entry("When given a password min length above the bcrypt limit", func(cfg *config.Config) { cfg.Passwords.MinLength = 73 }, false),
+			Entry("When given more than four character classes", func(cfg *config.Config) { cfg.Passwords.MinCharacterClasses = 5 }, false),
+			Entry("When given negative lockout failures", func(cfg *config.Config) { cfg.Lockout.MaxUserFailures = -1 }, false),
+			Entry("When given a lockout duration shorter than the base delay", func(cfg *config.Config) { cfg.Lockout.Duration = time.Millisecond }, false),
+			Entry("When given a negative session limit", func(cfg *config.Config) { cfg.Sessions.MaxPerUser = -1 }, false),
+			Entry("When given an unknown session limit policy", func(cfg *config.Config) { cfg.Sessions.LimitPolicy = "kick" }, false),
+			Entry("When given a single session replacing the oldest", func(cfg *config.Config) {
+				cfg.Sessions.MaxPerUser = 1
+				cfg.Sessions.LimitPolicy = "replace-oldest"
+			}, true),
+			Entry("When the lockout is disabled", func(cfg *config.Config) {
+				cfg.Lockout.MaxUserFailures = 0
+				cfg.Lockout.MaxHostFailures = 0
+			}, true),
+			Entry("When given a negative flood burst", func(cfg *config.Config) { cfg.Flood.Host.Burst = -1 }, false),
+			Entry("When given a flood burst without a refill", func(cfg *config.Config) { cfg.Flood.Session.Refill = 0 }, false),
+			Entry("When given a flood mute without a duration", func(cfg *config.Config) { cfg.Flood.MuteDuration = 0 }, false),
+			Entry("When given a negative flood disconnect threshold", func(cfg *config.Config) { cfg.Flood.DisconnectAfter = -1 }, false),
+			Entry("When the flood limits are disabled", func(cfg *config.Config) {
+				cfg.Flood.Session = config.RateLimitConfig{}
+				cfg.Flood.User = config.RateLimitConfig{}
+				cfg.Flood.Host = config.RateLimitConfig{}
+				cfg.Flood.MuteAfter = 0
+				cfg.Flood.DisconnectAfter = 0
+			}, true),
+			Entry("When given a negative connection limit", func(cfg *config.Config) { cfg.Connections.MaxPerHost = -1 }, false),
+			Entry("When given an idle warning longer than the idle timeout", func(cfg *config.Config) { cfg.Connections.IdleWarning = 2 * time.Hour }, false),
+			Entry("When given no write timeout", func(cfg *config.Config) { cfg.Connections.WriteTimeout = 0 }, false),
+			Entry("When given keepalive without probes", func(cfg *config.Config) { cfg.Connections.KeepAlive.Count = 0 }, false),
+			Entry("When the connection limits, idle timeout and keepalive are disabled", func(cfg *config.Config) {
+				cfg.Connections.MaxTotal = 0
+				cfg.Connections.MaxPerHost = 0
+				cfg.Connections.IdleTimeout = 0
+				cfg.Connections.KeepAlive = config.KeepAliveConfig{}
+			}, true),
+		)
+	})
+})
@@ -0,0 +1,99 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrUnterminatedQuote = errors.New("unterminated quote")
+	ErrDanglingEscape    = errors.New("backslash at the end of the arguments")
+)
+
+// SplitCommandLine splits a command as typed after its slash into the name and the arguments that are not parsed yet.
+func SplitCommandLine(line string) (name CommandType, arguments string) {
+	line = strings.TrimLeftFunc(line, unicode.IsSpace)
+	nameEnd := strings.IndexFunc(line, unicode.IsSpace)
+	if nameEnd < 0 {
+		return CommandType(line), ""
+	}
+	return CommandType(line[:nameEnd]), strings.TrimLeftFunc(line[nameEnd:], unicode.IsSpace)
+}
+
+// SplitArguments splits arguments at whitespace. Single quotes keep everything up to the closing quote,
+// double quotes keep whitespace and allow \" and \\, outside of quotes a backslash escapes any character.
+// If limit is positive at most limit arguments are returned, the last one is the rest of the arguments exactly as typed.
+func SplitArguments(arguments string, limit int) ([]string, error) {
+	result := make([]string, 0)
+	rest := strings.TrimLeftFunc(arguments, unicode.IsSpace)
+	for rest != "" {
+		if limit > 0 && len(result) == limit-1 {
+			return append(result, rest), nil
+		}
+		argument, remaining, err := nextArgument(rest)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, argument)
+		rest = strings.TrimLeftFunc(remaining, unicode.IsSpace)
+	}
+	return result, nil
+}
+
+// nextArgument parses the argument at the start of arguments and returns it and everything after it.
+func nextArgument(arguments string) (argument string, rest string, err error) {
+	var builder strings.Builder
+	var quote rune
+	escaped := false
+	for index := 0; index < len(arguments); {
+		r, size := utf8.DecodeRuneInString(arguments[index:])
+		// The original bytes are kept, so that invalid utf-8 is passed on unchanged.
+		raw := arguments[index : index+size]
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' {
+				builder.WriteByte('\\')
+			}
+			builder.WriteString(raw)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			builder.WriteString(raw)
+		case r == '"' || r == '\'':
+			quote = r
+		case unicode.IsSpace(r):
+			return builder.String(), arguments[index:], nil
+		default:
+			builder.WriteString(raw)
+		}
+		index += size
+	}
+	if escaped {
+		return "", "", ErrDanglingEscape
+	}
+	if quote != 0 {
+		return "", "", ErrUnterminatedQuote
+	}
+	return builder.String(), "", nil
+}
+
+// QuoteArgument quotes argument if necessary, so that SplitArguments returns it unchanged.
+func QuoteArgument(argument string) string {
+	needsQuotes := strings.IndexFunc(argument, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '\'' || r == '\\'
+	}) >= 0
+	if argument != "" && !needsQuotes {
+		return argument
+	}
+	return "'" + strings.ReplaceAll(argument, "'", `'\''`) + "'"
+}
@@ -0,0 +1,112 @@
+package domain_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Arguments", func() {
+	Context("#SplitCommandLine", func() {
+		DescribeTable("Splitting off the command name",
+			func(line string, expectedName domain.CommandType, expectedArguments string) {
+				name, arguments := domain.SplitCommandLine(line)
+				Expect(name).To(Equal(expectedName))
+				Expect(arguments).To(Equal(expectedArguments))
+			},
+			Entry("When given an empty line", "", domain.CommandType(""), ""),
+			Entry("When given only a name", "who", domain.Who, ""),
+			Entry("When given a name and arguments", "msg  bob  hi  there", domain.PrivateMessage, "bob  hi  there"),
+			Entry("When given whitespace before the name", " join lobby", domain.Join, "lobby"),
+		)
+	})
+
+	Context("#SplitArguments", func() {
+		DescribeTable("Splitting arguments",
+			func(arguments string, limit int, expectedArguments []string) {
+				Expect(domain.SplitArguments(arguments, limit)).To(Equal(expectedArguments))
+			},
+			Entry("When given nothing", "", 0, []string{}),
+			Entry("When given plain words", "alice  s3cret-pw", 0, []string{"alice", "s3cret-pw"}),
+			Entry("When given double quotes", `alice "pass word"`, 0, []string{"alice", "pass word"}),
+			Entry("When given escapes in double quotes", `"say \"hi\" \\ \n"`, 0, []string{`say "hi" \ \n`}),
+			Entry("When given single quotes", `'it''s' '\"'`, 0, []string{"its", `\"`}),
+			Entry("When given escapes outside of quotes", `pass\ word \'`, 0, []string{"pass word", "'"}),
+			Entry("When given empty quotes", `"" ''`, 0, []string{"", ""}),
+			Entry("When given adjacent quotes", `a"b c"'d'`, 0, []string{"ab cd"}),
+			Entry("When given a limit", `bob  hello   "world" `, 2, []string{"bob", `hello   "world" `}),
+			Entry("When given a limit of one", `  hello   world`, 1, []string{"hello   world"}),
+			Entry("When given fewer arguments than the limit", `bob`, 2, []string{"bob"}),
+		)
+
+		DescribeTable("Rejecting arguments",
+			func(arguments string, expectedErr error) {
+				_, err := domain.SplitArguments(arguments, 0)
+				Expect(err).To(MatchError(expectedErr))
+			},
+			Entry("When given an unterminated double quote", `alice "pass word`, domain.ErrUnterminatedQuote),
+			Entry("When given an unterminated single quote", `'`, domain.ErrUnterminatedQuote),
+			Entry("When given a backslash at the end", `pass\`, domain.ErrDanglingEscape),
+		)
+	})
+
+	Context("#QuoteArgument", func() {
+		DescribeTable("Quoting arguments",
+			func(argument, expectedQuotedArgument string) {
+				Expect(domain.QuoteArgument(argument)).To(Equal(expectedQuotedArgument))
+				Expect(domain.SplitArguments(domain.QuoteArgument(argument), 0)).To(Equal([]string{argument}))
+			},
+			Entry("When given a plain word", "alice", "alice"),
+			Entry("When given an empty argument", "", "''"),
+			Entry("When given whitespace", "pass word", "'pass word'"),
+			Entry("When given a single quote", "it's", `'it'\''s'`),
+			Entry("When given a backslash", `a\b`, `'a\b'`),
+		)
+	})
+})
+
+func FuzzSplitArguments(f *testing.F) {
+	for _, seed := range []string{"", "alice s3cret-pw", `"pass word"`, `'it'\''s'`, `a\ b`, `"\"`, `'`, `\`, "\xff \"\xfe\"", "a b"} {
+		f.Add(seed, 0)
+		f.Add(seed, 2)
+	}
+	f.Fuzz(func(t *testing.T, line string, limit int) {
+		arguments, err := domain.SplitArguments(line, limit)
+		if err != nil {
+			return
+		}
+		if limit > 0 && len(arguments) > limit {
+			t.Fatalf("got %d arguments for limit %d", len(arguments), limit)
+		}
+		if limit > 0 {
+			return
+		}
+		quoted := make([]string, 0, len(arguments))
+		for _, argument := range arguments {
+			quoted = append(quoted, domain.QuoteArgument(argument))
+		}
+		requoted, err := domain.SplitArguments(strings.Join(quoted, " "), 0)
+		if err != nil {
+			t.Fatalf("quoted arguments %q of %q can not be split: %v", quoted, line, err)
+		}
+		if !slices.Equal(requoted, arguments) {
+			t.Fatalf("quoted arguments of %q were split into %q instead of %q", line, requoted, arguments)
+		}
+	})
+}
+
+func FuzzQuoteArgument(f *testing.F) {
+	for _, seed := range []string{"", "alice", "pass word", "it's", `a\b`, `"`, "\xff", " "} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, argument string) {
+		arguments, err := domain.SplitArguments(domain.QuoteArgument(argument), 0)
+		if err != nil || len(arguments) != 1 || arguments[0] != argument {
+			t.Fatalf("argument %q was split into %q, %v", argument, arguments, err)
+		}
+	})
+}
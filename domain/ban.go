@@ -0,0 +1,110 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Ban prevents a user from logging in and clients from the banned hosts from connecting until it expires.
+type Ban struct {
+	UserID    string
+	UserName  string
+	Hosts     []string
+	BannedBy  string
+	CreatedAt time.Time
+	// ExpiresAt is the zero time for bans that never expire.
+	ExpiresAt time.Time
+}
+
+// NewBan creates a ban of user and the given hosts, a duration of zero creates a ban that never expires.
+func NewBan(user *User, hosts []string, bannedBy string, duration time.Duration) *Ban {
+	ban := &Ban{UserID: user.ID, UserName: user.Name, Hosts: hosts, BannedBy: bannedBy, CreatedAt: time.Now()}
+	if duration > 0 {
+		ban.ExpiresAt = ban.CreatedAt.Add(duration)
+	}
+	return ban
+}
+
+func (b *Ban) IsPermanent() bool {
+	return b.ExpiresAt.IsZero()
+}
+
+// IsActive reports whether the ban is still in effect at the given time.
+func (b *Ban) IsActive(now time.Time) bool {
+	return b.IsPermanent() || now.Before(b.ExpiresAt)
+}
+
+type BanRepository interface {
+	Add(*Ban) bool
+	GetAll() []*Ban
+	FindByUserID(string) (ban *Ban, banExists bool)
+	FindByHost(string) (ban *Ban, banExists bool)
+	Delete(string) (ban *Ban, banExists bool)
+}
+
+// InMemoryBanRepository keeps at most one ban per user, it is safe for concurrent use.
+type InMemoryBanRepository struct {
+	mutex sync.RWMutex
+	bans  map[string]*Ban
+}
+
+func NewInMemoryBanRepository() *InMemoryBanRepository {
+	return &InMemoryBanRepository{bans: make(map[string]*Ban)}
+}
+
+func (i *InMemoryBanRepository) Add(ban *Ban) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if _, banExists := i.bans[ban.UserID]; banExists {
+		return false
+	}
+	i.bans[ban.UserID] = ban
+	return true
+}
+
+// GetAll returns all bans, the oldest ban comes first.
+func (i *InMemoryBanRepository) GetAll() []*Ban {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	bans := make([]*Ban, 0, len(i.bans))
+	for _, ban := range i.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(a, b int) bool {
+		return bans[a].CreatedAt.Before(bans[b].CreatedAt)
+	})
+	return bans
+}
+
+func (i *InMemoryBanRepository) FindByUserID(userID string) (ban *Ban, banExists bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	ban, banExists = i.bans[userID]
+	return
+}
+
+func (i *InMemoryBanRepository) FindByHost(host string) (*Ban, bool) {
+	for _, ban := range i.GetAll() {
+		if slices.Contains(ban.Hosts, host) {
+			return ban, true
+		}
+	}
+	return nil, false
+}
+
+func (i *InMemoryBanRepository) Delete(userID string) (ban *Ban, banExists bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if ban, banExists = i.bans[userID]; !banExists {
+		return
+	}
+	delete(i.bans, userID)
+	return
+}
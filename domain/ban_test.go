@@ -0,0 +1,73 @@
+package domain_test
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/test"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ban", func() {
+	var user *domain.User
+
+	BeforeEach(func() {
+		user, _ = domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+	})
+
+	Context("#IsActive", func() {
+		It("should never expire bans without a duration", func() {
+			ban := domain.NewBan(user, nil, test.USER_NAME_B, 0)
+			Expect(ban.IsPermanent()).To(BeTrue())
+			Expect(ban.IsActive(time.Now().Add(24 * 365 * time.Hour))).To(BeTrue())
+		})
+
+		It("should expire bans after their duration", func() {
+			ban := domain.NewBan(user, nil, test.USER_NAME_B, time.Hour)
+			Expect(ban.IsActive(time.Now())).To(BeTrue())
+			Expect(ban.IsActive(time.Now().Add(2 * time.Hour))).To(BeFalse())
+		})
+	})
+
+	Context("InMemoryBanRepository", func() {
+		It("should find bans by user id and by host", func() {
+			banRepository := domain.NewInMemoryBanRepository()
+			ban := domain.NewBan(user, []string{"192.0.2.1"}, test.USER_NAME_B, 0)
+			Expect(banRepository.Add(ban)).To(BeTrue())
+			Expect(banRepository.Add(ban)).To(BeFalse())
+
+			foundBan, banExists := banRepository.FindByUserID(user.ID)
+			Expect(banExists).To(BeTrue())
+			Expect(foundBan).To(Equal(ban))
+			foundBan, banExists = banRepository.FindByHost("192.0.2.1")
+			Expect(banExists).To(BeTrue())
+			Expect(foundBan).To(Equal(ban))
+			_, banExists = banRepository.FindByHost("192.0.2.2")
+			Expect(banExists).To(BeFalse())
+		})
+	})
+
+	Context("FileBanRepository", func() {
+		It("should restore bans after reopening the repository", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "bans.json")
+			banRepository, err := domain.NewFileBanRepository(path)
+			Expect(err).To(BeNil())
+			permanentBan := domain.NewBan(user, []string{"192.0.2.1"}, test.USER_NAME_B, 0)
+			otherUser, _ := domain.NewUser(test.USER_NAME_C, test.USER_PASSWORD_A)
+			temporaryBan := domain.NewBan(otherUser, nil, test.USER_NAME_B, time.Hour)
+			Expect(banRepository.Add(permanentBan)).To(BeTrue())
+			Expect(banRepository.Add(temporaryBan)).To(BeTrue())
+			banRepository.Delete(otherUser.ID)
+
+			reopenedBanRepository, err := domain.NewFileBanRepository(path)
+			Expect(err).To(BeNil())
+			Expect(reopenedBanRepository.GetAll()).To(HaveLen(1))
+			restoredBan, banExists := reopenedBanRepository.FindByHost("192.0.2.1")
+			Expect(banExists).To(BeTrue())
+			Expect(restoredBan.UserName).To(Equal(test.USER_NAME_A))
+			Expect(restoredBan.IsPermanent()).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,132 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// banRecord is a single ban as it is stored in the file of a FileBanRepository.
+type banRecord struct {
+	UserID    string    `json:"userID"`
+	UserName  string    `json:"userName"`
+	Hosts     []string  `json:"hosts,omitempty"`
+	BannedBy  string    `json:"bannedBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// FileBanRepository is a BanRepository that keeps all bans in memory and rewrites the ban list in a JSON file on
+// every change. Ban lists are small and rarely change, so the whole file is replaced atomically every time.
+type FileBanRepository struct {
+	*InMemoryBanRepository
+	// saveMutex serializes changes so that the file always reflects the latest change.
+	saveMutex sync.Mutex
+	path      string
+}
+
+// NewFileBanRepository opens or creates the ban list at path and restores all bans from it.
+func NewFileBanRepository(path string) (*FileBanRepository, error) {
+	f := &FileBanRepository{InMemoryBanRepository: NewInMemoryBanRepository(), path: path}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileBanRepository) Add(ban *Ban) bool {
+	f.saveMutex.Lock()
+	defer f.saveMutex.Unlock()
+	if !f.InMemoryBanRepository.Add(ban) {
+		return false
+	}
+	if err := f.save(); err != nil {
+		slog.Error("failed to persist new ban", "userID", ban.UserID, "err", err)
+		f.InMemoryBanRepository.Delete(ban.UserID)
+		return false
+	}
+	return true
+}
+
+func (f *FileBanRepository) Delete(userID string) (*Ban, bool) {
+	f.saveMutex.Lock()
+	defer f.saveMutex.Unlock()
+	ban, banExists := f.InMemoryBanRepository.Delete(userID)
+	if !banExists {
+		return nil, false
+	}
+	if err := f.save(); err != nil {
+		slog.Error("failed to persist deleted ban", "userID", userID, "err", err)
+	}
+	return ban, true
+}
+
+func (f *FileBanRepository) load() error {
+	content, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var records []banRecord
+	if err := json.Unmarshal(content, &records); err != nil {
+		return fmt.Errorf("corrupt ban list %s: %w", f.path, err)
+	}
+	for _, record := range records {
+		f.InMemoryBanRepository.Add(&Ban{
+			UserID:    record.UserID,
+			UserName:  record.UserName,
+			Hosts:     record.Hosts,
+			BannedBy:  record.BannedBy,
+			CreatedAt: record.CreatedAt,
+			ExpiresAt: record.ExpiresAt,
+		})
+	}
+	return nil
+}
+
+// save writes all bans to a temporary file and atomically replaces the ban list with it.
+func (f *FileBanRepository) save() error {
+	records := make([]banRecord, 0)
+	for _, ban := range f.GetAll() {
+		records = append(records, banRecord{
+			UserID:    ban.UserID,
+			UserName:  ban.UserName,
+			Hosts:     ban.Hosts,
+			BannedBy:  ban.BannedBy,
+			CreatedAt: ban.CreatedAt,
+			ExpiresAt: ban.ExpiresAt,
+		})
+	}
+	content, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := f.path + ".tmp"
+	tempFile, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := tempFile.Write(content); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, f.path)
+}
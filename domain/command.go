@@ -5,39 +5,40 @@
 
 package domain
 
-import "strconv"
-
-type CommandType int
+// CommandType is the name a command is invoked with, without the leading slash.
+type CommandType string
 
+// The names of the built-in commands, the commands a server understands are declared by its command registry.
 const (
-	Unknown CommandType = iota
-	ChangeName
-	PrivateMessage
-	CreateAccount
-	Login
-	ChangePassword
-	Info
-	Who
-	Quit
+	Unknown        CommandType = "unknown"
+	Help           CommandType = "help"
+	ChangeName     CommandType = "name"
+	PrivateMessage CommandType = "msg"
+	CreateAccount  CommandType = "acc"
+	Login          CommandType = "login"
+	Logout         CommandType = "logout"
+	ChangePassword CommandType = "passwd"
+	Info           CommandType = "info"
+	Who            CommandType = "who"
+	Quit           CommandType = "quit"
+	Join           CommandType = "join"
+	Part           CommandType = "part"
+	Rooms          CommandType = "rooms"
+	History        CommandType = "history"
+	Inbox          CommandType = "inbox"
+	KickUser       CommandType = "kick"
+	BanUser        CommandType = "ban"
+	UnbanUser      CommandType = "unban"
+	Op             CommandType = "op"
+	Deop           CommandType = "deop"
+	Away           CommandType = "away"
+	Busy           CommandType = "busy"
+	Back           CommandType = "back"
 )
 
-// CommandTypeFromString is used to mach a received command as a string to the CommandType used to communicate the command.
-func CommandTypeFromString(s string) CommandType {
-	for currentCommandType := Unknown; currentCommandType <= Quit; currentCommandType++ {
-		if currentCommandType.String() == s {
-			return currentCommandType
-		}
-	}
-	return Unknown
-}
-
 // String implements the string variants of CommandType.
 func (c CommandType) String() string {
-	commandTypeToStringMapping := []string{"unknown", "name", "msg", "acc", "login", "passwd", "info", "who", "quit"}
-	if c < 0 || int(c) > len(commandTypeToStringMapping)-1 {
-		return strconv.Itoa(int(c))
-	}
-	return commandTypeToStringMapping[c]
+	return string(c)
 }
 
 // Command represents a command a user wants to be executed.
@@ -45,4 +46,9 @@ type Command struct {
 	SessionID   string
 	CommandType CommandType
 	Arguments   []string
+	// Line contains the arguments exactly as typed if the command was received as text, it is parsed again
+	// according to the command, e.g. to keep the whitespace of a private message.
+	Line string
+	// RequestID is chosen by clients of the json protocol to match the reply to the command, it is empty otherwise.
+	RequestID string
 }
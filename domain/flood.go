@@ -0,0 +1,144 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FloodAction is what happens to a line read from a session, depending on how often it exceeded its rate limits.
+type FloodAction int
+
+const (
+	// FloodAllow handles the line right away.
+	FloodAllow FloodAction = iota
+	// FloodWarn tells the session to slow down and throttles the line.
+	FloodWarn
+	// FloodThrottle handles the line once the rate limits allow it.
+	FloodThrottle
+	// FloodMute drops the line.
+	FloodMute
+	// FloodDisconnect drops the line and closes the session.
+	FloodDisconnect
+)
+
+// String implements the string variants of FloodAction.
+func (f FloodAction) String() string {
+	floodActionToStringMapping := []string{"allow", "warn", "throttle", "mute", "disconnect"}
+	if f < 0 || int(f) > len(floodActionToStringMapping)-1 {
+		return strconv.Itoa(int(f))
+	}
+	return floodActionToStringMapping[f]
+}
+
+// FloodVerdict tells the reader of a session what to do with a line.
+type FloodVerdict struct {
+	Action FloodAction
+	// Wait is how long a warned or throttled line has to be held back.
+	Wait time.Duration
+}
+
+// FloodPolicy decides how lines are rate limited and how sessions that keep exceeding the limits are dealt with.
+type FloodPolicy struct {
+	// Session, User and Host limit the lines of a single session, of all sessions of a user and of all sessions
+	// from a remote host, a line has to be allowed by all of them.
+	Session RateLimit
+	User    RateLimit
+	Host    RateLimit
+	// MuteAfter is the number of violations after which lines exceeding the limits are dropped for MuteDuration,
+	// zero disables muting.
+	MuteAfter    int
+	MuteDuration time.Duration
+	// DisconnectAfter is the number of violations after which the session is closed, zero disables disconnecting.
+	DisconnectAfter int
+	// ForgiveAfter is how long a session has to stay within the limits for its violations to be forgotten.
+	ForgiveAfter time.Duration
+}
+
+// Action returns what happens to a line that exceeds the limits after the given number of violations.
+func (p FloodPolicy) Action(violations int) FloodAction {
+	switch {
+	case p.DisconnectAfter > 0 && violations >= p.DisconnectAfter:
+		return FloodDisconnect
+	case p.MuteAfter > 0 && violations >= p.MuteAfter:
+		return FloodMute
+	case violations <= 1:
+		return FloodWarn
+	default:
+		return FloodThrottle
+	}
+}
+
+// FloodOffense counts how often a session exceeded its rate limits.
+type FloodOffense struct {
+	Violations      int
+	LastViolationAt time.Time
+	// MutedUntil is the time before which lines of the session are dropped.
+	MutedUntil time.Time
+}
+
+// IsMuted reports whether lines are dropped at the given time.
+func (f FloodOffense) IsMuted(now time.Time) bool {
+	return now.Before(f.MutedUntil)
+}
+
+// record adds a violation at the given time, violations are forgotten after policy.ForgiveAfter.
+// Every violation once MuteAfter is reached extends the mute.
+func (f FloodOffense) record(now time.Time, policy FloodPolicy) FloodOffense {
+	if now.Sub(f.LastViolationAt) > policy.ForgiveAfter {
+		f.Violations = 0
+	}
+	f.Violations++
+	f.LastViolationAt = now
+	if policy.Action(f.Violations) == FloodMute {
+		f.MutedUntil = now.Add(policy.MuteDuration)
+	}
+	return f
+}
+
+type FloodOffenseRepository interface {
+	// Record adds a violation of the session at the given time and returns the updated offense.
+	Record(sessionID string, now time.Time, policy FloodPolicy) FloodOffense
+	Find(sessionID string) (offense FloodOffense, offenseExists bool)
+	Delete(sessionID string) (offense FloodOffense, offenseExists bool)
+}
+
+// InMemoryFloodOffenseRepository keeps the offense per session id, it is safe for concurrent use.
+type InMemoryFloodOffenseRepository struct {
+	mutex    sync.Mutex
+	offenses map[string]FloodOffense
+}
+
+func NewInMemoryFloodOffenseRepository() *InMemoryFloodOffenseRepository {
+	return &InMemoryFloodOffenseRepository{offenses: make(map[string]FloodOffense)}
+}
+
+func (i *InMemoryFloodOffenseRepository) Record(sessionID string, now time.Time, policy FloodPolicy) FloodOffense {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	offense := i.offenses[sessionID].record(now, policy)
+	i.offenses[sessionID] = offense
+	return offense
+}
+
+func (i *InMemoryFloodOffenseRepository) Find(sessionID string) (offense FloodOffense, offenseExists bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	offense, offenseExists = i.offenses[sessionID]
+	return
+}
+
+func (i *InMemoryFloodOffenseRepository) Delete(sessionID string) (offense FloodOffense, offenseExists bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if offense, offenseExists = i.offenses[sessionID]; !offenseExists {
+		return
+	}
+	delete(i.offenses, sessionID)
+	return
+}
@@ -0,0 +1,121 @@
+package domain_test
+
+import (
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Flood", func() {
+	policy := domain.FloodPolicy{MuteAfter: 5, MuteDuration: time.Minute, DisconnectAfter: 10, ForgiveAfter: time.Minute}
+
+	Context("#Action", func() {
+		DescribeTable("should escalate with the number of violations",
+			func(policy domain.FloodPolicy, violations int, expectedAction domain.FloodAction) {
+				Expect(policy.Action(violations)).To(Equal(expectedAction))
+			},
+			Entry("When it is the first violation", policy, 1, domain.FloodWarn),
+			Entry("When it is a repeated violation", policy, 4, domain.FloodThrottle),
+			Entry("When muting is reached", policy, 5, domain.FloodMute),
+			Entry("When disconnecting is reached", policy, 10, domain.FloodDisconnect),
+			Entry("When muting and disconnecting are disabled", domain.FloodPolicy{}, 100, domain.FloodThrottle),
+		)
+	})
+
+	Context("#String", func() {
+		DescribeTable("Getting a String from a FloodAction",
+			func(action domain.FloodAction, expectedString string) {
+				Expect(action.String()).To(Equal(expectedString))
+			},
+			Entry("When given FloodAllow", domain.FloodAllow, "allow"),
+			Entry("When given FloodWarn", domain.FloodWarn, "warn"),
+			Entry("When given FloodThrottle", domain.FloodThrottle, "throttle"),
+			Entry("When given FloodMute", domain.FloodMute, "mute"),
+			Entry("When given FloodDisconnect", domain.FloodDisconnect, "disconnect"),
+			Entry("When given an invalid FloodAction", domain.FloodAction(5), "5"),
+		)
+	})
+
+	Context("InMemoryFloodOffenseRepository", func() {
+		var (
+			floodOffenseRepository *domain.InMemoryFloodOffenseRepository
+			now                    time.Time
+		)
+
+		BeforeEach(func() {
+			floodOffenseRepository = domain.NewInMemoryFloodOffenseRepository()
+			now = time.Now()
+		})
+
+		It("should mute sessions after repeated violations and extend the mute", func() {
+			var offense domain.FloodOffense
+			for range 4 {
+				offense = floodOffenseRepository.Record("session", now, policy)
+			}
+			Expect(offense.IsMuted(now)).To(BeFalse())
+
+			offense = floodOffenseRepository.Record("session", now, policy)
+			Expect(offense.Violations).To(Equal(5))
+			Expect(offense.IsMuted(now.Add(59 * time.Second))).To(BeTrue())
+
+			offense = floodOffenseRepository.Record("session", now.Add(30*time.Second), policy)
+			Expect(offense.IsMuted(now.Add(89 * time.Second))).To(BeTrue())
+			Expect(offense.IsMuted(now.Add(90 * time.Second))).To(BeFalse())
+		})
+
+		It("should forget violations after the session stayed within the limits", func() {
+			floodOffenseRepository.Record("session", now, policy)
+			offense := floodOffenseRepository.Record("session", now.Add(time.Minute+time.Second), policy)
+			Expect(offense.Violations).To(Equal(1))
+
+			foundOffense, offenseExists := floodOffenseRepository.Delete("session")
+			Expect(offenseExists).To(BeTrue())
+			Expect(foundOffense).To(Equal(offense))
+			_, offenseExists = floodOffenseRepository.Find("session")
+			Expect(offenseExists).To(BeFalse())
+		})
+	})
+
+	Context("InMemoryRateLimitRepository", func() {
+		var (
+			rateLimitRepository *domain.InMemoryRateLimitRepository
+			now                 time.Time
+		)
+		limit := domain.RateLimit{Burst: 3, RefillInterval: time.Second}
+
+		BeforeEach(func() {
+			rateLimitRepository = domain.NewInMemoryRateLimitRepository()
+			now = time.Now()
+		})
+
+		It("should allow a burst and then one line per refill interval", func() {
+			for range 3 {
+				Expect(rateLimitRepository.Take("session", now, limit)).To(BeZero())
+			}
+			Expect(rateLimitRepository.Take("session", now, limit)).To(Equal(time.Second))
+			Expect(rateLimitRepository.Take("session", now, limit)).To(Equal(2 * time.Second))
+			Expect(rateLimitRepository.Take("other", now, limit)).To(BeZero())
+
+			// Both reserved tokens are refilled after two seconds, the third one is available right away.
+			Expect(rateLimitRepository.Take("session", now.Add(3*time.Second), limit)).To(BeZero())
+		})
+
+		It("should reserve at most a burst of tokens", func() {
+			for range 100 {
+				rateLimitRepository.Take("session", now, limit)
+			}
+			Expect(rateLimitRepository.Take("session", now, limit)).To(Equal(3 * time.Second))
+			Expect(rateLimitRepository.Take("session", now.Add(6*time.Second), limit)).To(BeZero())
+		})
+
+		It("should not limit anything if the limit is disabled", func() {
+			for range 100 {
+				Expect(rateLimitRepository.Take("session", now, domain.RateLimit{})).To(BeZero())
+			}
+			_, bucketExists := rateLimitRepository.Delete("session")
+			Expect(bucketExists).To(BeFalse())
+		})
+	})
+})
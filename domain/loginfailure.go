@@ -0,0 +1,136 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"sync"
+	"time"
+)
+
+// LockoutPolicy decides how long logins are blocked after consecutive failed logins.
+type LockoutPolicy struct {
+	// MaxFailures is the number of failed logins after which logins are blocked for Duration, zero disables blocking.
+	MaxFailures int
+	// BaseDelay is how long logins are blocked after the second failed login, the delay doubles with every further failure.
+	BaseDelay time.Duration
+	// Duration is how long logins are blocked once MaxFailures is reached, failures older than that are forgotten.
+	Duration time.Duration
+}
+
+// Delay returns how long logins are blocked after the given number of consecutive failed logins.
+// The first failure is not delayed, so a single typo does not slow anyone down.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if p.MaxFailures <= 0 || failures < 2 {
+		return 0
+	}
+	if failures >= p.MaxFailures {
+		return p.Duration
+	}
+	delay := p.BaseDelay
+	for i := 2; i < failures && delay < p.Duration; i++ {
+		delay *= 2
+	}
+	return min(delay, p.Duration)
+}
+
+// LoginFailures counts the consecutive failed logins of a user or from a remote host.
+type LoginFailures struct {
+	Count         int
+	LastFailureAt time.Time
+	// BlockedUntil is the time before which further logins are rejected.
+	BlockedUntil time.Time
+}
+
+// IsBlocked reports whether logins are rejected at the given time.
+func (l LoginFailures) IsBlocked(now time.Time) bool {
+	return now.Before(l.BlockedUntil)
+}
+
+// record adds a failed login at the given time, failures older than the lockout duration are forgotten.
+func (l LoginFailures) record(now time.Time, policy LockoutPolicy) LoginFailures {
+	if now.Sub(l.LastFailureAt) > policy.Duration {
+		l.Count = 0
+	}
+	l.Count++
+	l.LastFailureAt = now
+	l.BlockedUntil = now.Add(policy.Delay(l.Count))
+	return l
+}
+
+// release takes back the latest failed login, the block is shortened accordingly.
+func (l LoginFailures) release(policy LockoutPolicy) LoginFailures {
+	l.Count--
+	l.BlockedUntil = l.LastFailureAt.Add(policy.Delay(l.Count))
+	return l
+}
+
+type LoginFailureRepository interface {
+	// Reserve adds a failed login for key at the given time unless logins are blocked, in one step, so that concurrent
+	// logins can not try more passwords than policy allows. A login that succeeds has to be released again.
+	Reserve(key string, now time.Time, policy LockoutPolicy) (failures LoginFailures, reserved bool)
+	// Release takes back a failed login added by Reserve.
+	Release(key string, policy LockoutPolicy)
+	Find(key string) (failures LoginFailures, failuresExist bool)
+	Delete(key string) (failures LoginFailures, failuresExist bool)
+}
+
+// InMemoryLoginFailureRepository keeps the failed logins per key, it is safe for concurrent use.
+type InMemoryLoginFailureRepository struct {
+	mutex    sync.Mutex
+	failures map[string]LoginFailures
+}
+
+func NewInMemoryLoginFailureRepository() *InMemoryLoginFailureRepository {
+	return &InMemoryLoginFailureRepository{failures: make(map[string]LoginFailures)}
+}
+
+// Reserve adds a failed login for key unless it is blocked, failures of other keys that are forgotten by policy are removed.
+func (i *InMemoryLoginFailureRepository) Reserve(key string, now time.Time, policy LockoutPolicy) (failures LoginFailures, reserved bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for otherKey, failures := range i.failures {
+		if !failures.IsBlocked(now) && now.Sub(failures.LastFailureAt) > policy.Duration {
+			delete(i.failures, otherKey)
+		}
+	}
+	if failures = i.failures[key]; failures.IsBlocked(now) {
+		return failures, false
+	}
+	failures = failures.record(now, policy)
+	i.failures[key] = failures
+	return failures, true
+}
+
+func (i *InMemoryLoginFailureRepository) Release(key string, policy LockoutPolicy) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	failures, failuresExist := i.failures[key]
+	if !failuresExist {
+		return
+	}
+	if failures = failures.release(policy); failures.Count <= 0 {
+		delete(i.failures, key)
+		return
+	}
+	i.failures[key] = failures
+}
+
+func (i *InMemoryLoginFailureRepository) Find(key string) (failures LoginFailures, failuresExist bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	failures, failuresExist = i.failures[key]
+	return
+}
+
+func (i *InMemoryLoginFailureRepository) Delete(key string) (failures LoginFailures, failuresExist bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if failures, failuresExist = i.failures[key]; !failuresExist {
+		return
+	}
+	delete(i.failures, key)
+	return
+}
@@ -0,0 +1,117 @@
+package domain_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoginFailure", func() {
+	policy := domain.LockoutPolicy{MaxFailures: 5, BaseDelay: time.Second, Duration: 15 * time.Minute}
+
+	Context("#Delay", func() {
+		DescribeTable("should back off exponentially until the lockout",
+			func(failures int, expectedDelay time.Duration) {
+				Expect(policy.Delay(failures)).To(Equal(expectedDelay))
+			},
+			Entry("When nothing failed", 0, time.Duration(0)),
+			Entry("When the first login failed", 1, time.Duration(0)),
+			Entry("When two logins failed", 2, time.Second),
+			Entry("When four logins failed", 4, 4*time.Second),
+			Entry("When the maximum is reached", 5, 15*time.Minute),
+			Entry("When the maximum is exceeded", 9, 15*time.Minute),
+		)
+
+		It("should never block if the lockout is disabled", func() {
+			Expect(domain.LockoutPolicy{BaseDelay: time.Second, Duration: time.Minute}.Delay(100)).To(BeZero())
+		})
+	})
+
+	Context("InMemoryLoginFailureRepository", func() {
+		var (
+			loginFailureRepository *domain.InMemoryLoginFailureRepository
+			now                    time.Time
+		)
+
+		BeforeEach(func() {
+			loginFailureRepository = domain.NewInMemoryLoginFailureRepository()
+			now = time.Now()
+		})
+
+		It("should block logins after repeated failures", func() {
+			failures, reserved := loginFailureRepository.Reserve("alice", now, policy)
+			Expect(reserved).To(BeTrue())
+			Expect(failures.Count).To(Equal(1))
+			Expect(failures.IsBlocked(now)).To(BeFalse())
+
+			failures, reserved = loginFailureRepository.Reserve("alice", now, policy)
+			Expect(reserved).To(BeTrue())
+			Expect(failures.IsBlocked(now)).To(BeTrue())
+			Expect(failures.IsBlocked(now.Add(time.Second))).To(BeFalse())
+
+			blockedFailures, reserved := loginFailureRepository.Reserve("alice", now, policy)
+			Expect(reserved).To(BeFalse())
+			Expect(blockedFailures).To(Equal(failures))
+
+			foundFailures, failuresExist := loginFailureRepository.Find("alice")
+			Expect(failuresExist).To(BeTrue())
+			Expect(foundFailures).To(Equal(failures))
+			_, failuresExist = loginFailureRepository.Find("bob")
+			Expect(failuresExist).To(BeFalse())
+		})
+
+		It("should forget failures older than the lockout duration", func() {
+			loginFailureRepository.Reserve("alice", now, policy)
+			loginFailureRepository.Reserve("bob", now, policy)
+			later := now.Add(time.Hour)
+			failures, _ := loginFailureRepository.Reserve("alice", later, policy)
+			Expect(failures.Count).To(Equal(1))
+			_, failuresExist := loginFailureRepository.Find("bob")
+			Expect(failuresExist).To(BeFalse())
+		})
+
+		It("should unblock deleted keys", func() {
+			loginFailureRepository.Reserve("alice", now, policy)
+			loginFailureRepository.Reserve("alice", now, policy)
+			failures, failuresExist := loginFailureRepository.Delete("alice")
+			Expect(failuresExist).To(BeTrue())
+			Expect(failures.IsBlocked(now)).To(BeTrue())
+			_, failuresExist = loginFailureRepository.Find("alice")
+			Expect(failuresExist).To(BeFalse())
+		})
+
+		It("should take back released failures", func() {
+			loginFailureRepository.Reserve("alice", now, policy)
+			loginFailureRepository.Reserve("alice", now, policy)
+			loginFailureRepository.Release("alice", policy)
+			failures, failuresExist := loginFailureRepository.Find("alice")
+			Expect(failuresExist).To(BeTrue())
+			Expect(failures.Count).To(Equal(1))
+			Expect(failures.IsBlocked(now)).To(BeFalse())
+
+			loginFailureRepository.Release("alice", policy)
+			_, failuresExist = loginFailureRepository.Find("alice")
+			Expect(failuresExist).To(BeFalse())
+		})
+
+		It("should only reserve as many concurrent attempts as the policy allows", func() {
+			var waitGroup sync.WaitGroup
+			var reservations atomic.Int32
+			for range 50 {
+				waitGroup.Add(1)
+				go func() {
+					defer waitGroup.Done()
+					if _, reserved := loginFailureRepository.Reserve("alice", now, policy); reserved {
+						reservations.Add(1)
+					}
+				}()
+			}
+			waitGroup.Wait()
+			Expect(reservations.Load()).To(BeEquivalentTo(2))
+		})
+	})
+})
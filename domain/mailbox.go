@@ -0,0 +1,98 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"slices"
+	"sync"
+)
+
+// Mailbox holds the private messages sent to a user while it was not logged in.
+// It is safe for concurrent use.
+type Mailbox struct {
+	UserID      string
+	mutex       sync.Mutex
+	messages    []*StoredMessage
+	undelivered int
+	capacity    int
+}
+
+// NewMailbox creates an empty mailbox holding at most capacity messages, the oldest messages are discarded once it is full.
+func NewMailbox(userID string, capacity int) *Mailbox {
+	return &Mailbox{UserID: userID, messages: make([]*StoredMessage, 0), capacity: capacity}
+}
+
+func (m *Mailbox) Add(message *StoredMessage) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.capacity <= 0 {
+		return
+	}
+	if len(m.messages) >= m.capacity {
+		m.messages = m.messages[len(m.messages)-m.capacity+1:]
+	}
+	m.messages = append(m.messages, message)
+	m.undelivered = min(m.undelivered+1, len(m.messages))
+}
+
+// TakeUndelivered returns all messages that were not delivered yet and marks them as delivered.
+func (m *Mailbox) TakeUndelivered() []*StoredMessage {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	undeliveredMessages := slices.Clone(m.messages[len(m.messages)-m.undelivered:])
+	m.undelivered = 0
+	return undeliveredMessages
+}
+
+// Messages returns all messages in the mailbox, the oldest message comes first.
+func (m *Mailbox) Messages() []*StoredMessage {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return slices.Clone(m.messages)
+}
+
+type MailboxRepository interface {
+	Add(*Mailbox) bool
+	FindByUserID(string) (mailbox *Mailbox, mailboxExists bool)
+	Delete(string) (mailbox *Mailbox, mailboxExists bool)
+}
+
+// InMemoryMailboxRepository is safe for concurrent use.
+type InMemoryMailboxRepository struct {
+	mutex     sync.RWMutex
+	mailboxes map[string]*Mailbox
+}
+
+func NewInMemoryMailboxRepository() *InMemoryMailboxRepository {
+	return &InMemoryMailboxRepository{mailboxes: make(map[string]*Mailbox)}
+}
+
+func (i *InMemoryMailboxRepository) Add(mailbox *Mailbox) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if _, mailboxExists := i.mailboxes[mailbox.UserID]; mailboxExists {
+		return false
+	}
+	i.mailboxes[mailbox.UserID] = mailbox
+	return true
+}
+
+func (i *InMemoryMailboxRepository) FindByUserID(userID string) (mailbox *Mailbox, mailboxExists bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	mailbox, mailboxExists = i.mailboxes[userID]
+	return
+}
+
+func (i *InMemoryMailboxRepository) Delete(userID string) (mailbox *Mailbox, mailboxExists bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if mailbox, mailboxExists = i.mailboxes[userID]; !mailboxExists {
+		return
+	}
+	delete(i.mailboxes, userID)
+	return
+}
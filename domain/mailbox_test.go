@@ -0,0 +1,49 @@
+package domain_test
+
+import (
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/test"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mailbox", func() {
+	var (
+		sender    *domain.User
+		recipient *domain.User
+	)
+
+	BeforeEach(func() {
+		sender, _ = domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+		recipient, _ = domain.NewUser(test.USER_NAME_B, test.USER_PASSWORD_B)
+	})
+
+	Context("#TakeUndelivered", func() {
+		It("should only return messages that were not delivered yet", func() {
+			mailbox := domain.NewMailbox(recipient.ID, 10)
+			first := domain.NewPrivateStoredMessage(sender, recipient, "first")
+			second := domain.NewPrivateStoredMessage(sender, recipient, "second")
+
+			mailbox.Add(first)
+			Expect(mailbox.TakeUndelivered()).To(Equal([]*domain.StoredMessage{first}))
+			mailbox.Add(second)
+			Expect(mailbox.TakeUndelivered()).To(Equal([]*domain.StoredMessage{second}))
+			Expect(mailbox.TakeUndelivered()).To(BeEmpty())
+			Expect(mailbox.Messages()).To(Equal([]*domain.StoredMessage{first, second}))
+		})
+	})
+
+	Context("when the mailbox is full", func() {
+		It("should discard the oldest messages", func() {
+			mailbox := domain.NewMailbox(recipient.ID, 2)
+			for _, text := range []string{"first", "second", "third"} {
+				mailbox.Add(domain.NewPrivateStoredMessage(sender, recipient, text))
+			}
+
+			undeliveredMessages := mailbox.TakeUndelivered()
+			Expect(undeliveredMessages).To(HaveLen(2))
+			Expect(undeliveredMessages[0].Message).To(Equal("second"))
+			Expect(undeliveredMessages[1].Message).To(Equal("third"))
+		})
+	})
+})
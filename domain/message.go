@@ -0,0 +1,181 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MessageType int
+
+const (
+	MessageTypeText MessageType = iota
+	MessageTypePrivate
+	MessageTypeServer
+	MessageTypeUserList
+	MessageTypeError
+	MessageTypeReply
+)
+
+// String implements the string variants of MessageType.
+func (m MessageType) String() string {
+	messageTypeToStringMapping := []string{"text", "private", "server", "userlist", "error", "reply"}
+	if m < 0 || int(m) > len(messageTypeToStringMapping)-1 {
+		return strconv.Itoa(int(m))
+	}
+	return messageTypeToStringMapping[m]
+}
+
+// StoredMessage is a text or private message that was sent by a user and recorded in a MessageStore.
+type StoredMessage struct {
+	ID            string
+	Type          MessageType
+	Timestamp     time.Time
+	SenderID      string
+	SenderName    string
+	RoomName      string
+	RecipientID   string
+	RecipientName string
+	Message       string
+}
+
+// NewTextStoredMessage creates a StoredMessage for a text message sent to a room.
+func NewTextStoredMessage(sender *User, roomName, message string) *StoredMessage {
+	return &StoredMessage{
+		ID:         uuid.New().String(),
+		Type:       MessageTypeText,
+		Timestamp:  time.Now(),
+		SenderID:   sender.ID,
+		SenderName: sender.Name,
+		RoomName:   roomName,
+		Message:    message,
+	}
+}
+
+// NewPrivateStoredMessage creates a StoredMessage for a private message sent to a single user.
+func NewPrivateStoredMessage(sender *User, recipient *User, message string) *StoredMessage {
+	return &StoredMessage{
+		ID:            uuid.New().String(),
+		Type:          MessageTypePrivate,
+		Timestamp:     time.Now(),
+		SenderID:      sender.ID,
+		SenderName:    sender.Name,
+		RecipientID:   recipient.ID,
+		RecipientName: recipient.Name,
+		Message:       message,
+	}
+}
+
+// IsVisibleTo reports whether a user currently in the room with the given name may see the message.
+func (m *StoredMessage) IsVisibleTo(userID, roomName string) bool {
+	if m.Type == MessageTypePrivate {
+		return m.SenderID == userID || m.RecipientID == userID
+	}
+	return m.RoomName == roomName
+}
+
+type MessageStore interface {
+	Add(*StoredMessage)
+	FindLastVisibleTo(userID, roomName string, count int) []*StoredMessage
+}
+
+// InMemoryMessageStore keeps the most recent messages up to a fixed capacity, older messages are discarded.
+// It is safe for concurrent use.
+type InMemoryMessageStore struct {
+	mutex    sync.RWMutex
+	messages []*StoredMessage
+	capacity int
+}
+
+func NewInMemoryMessageStore(capacity int) *InMemoryMessageStore {
+	return &InMemoryMessageStore{messages: make([]*StoredMessage, 0), capacity: capacity}
+}
+
+func (i *InMemoryMessageStore) Add(message *StoredMessage) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.capacity <= 0 {
+		return
+	}
+	if len(i.messages) >= i.capacity {
+		i.messages = i.messages[len(i.messages)-i.capacity+1:]
+	}
+	i.messages = append(i.messages, message)
+}
+
+// FindLastVisibleTo returns up to count of the most recent messages visible to the user, the oldest message comes first.
+func (i *InMemoryMessageStore) FindLastVisibleTo(userID, roomName string, count int) []*StoredMessage {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	visibleMessages := make([]*StoredMessage, 0)
+	for index := len(i.messages) - 1; index >= 0 && len(visibleMessages) < count; index-- {
+		if i.messages[index].IsVisibleTo(userID, roomName) {
+			visibleMessages = append(visibleMessages, i.messages[index])
+		}
+	}
+	slices.Reverse(visibleMessages)
+	return visibleMessages
+}
+
+// OutgoingMessage is a message delivered to a session, it is rendered according to the protocol of the session.
+type OutgoingMessage struct {
+	ID            string
+	Type          MessageType
+	Timestamp     time.Time
+	SenderName    string
+	RoomName      string
+	RecipientName string
+	Message       string
+	// Users is only set for messages of type MessageTypeUserList.
+	Users []UserPresence
+	// Replayed is set for messages from the history or a mailbox that are delivered after they were sent.
+	Replayed bool
+	// RequestID is set for replies and user lists answering a command that has a request id.
+	RequestID string
+	// Error is only set for replies to commands that failed.
+	Error string
+}
+
+// NewServerOutgoingMessage creates an OutgoingMessage containing a notice from the server.
+func NewServerOutgoingMessage(message string) OutgoingMessage {
+	return OutgoingMessage{ID: uuid.New().String(), Type: MessageTypeServer, Timestamp: time.Now(), Message: message}
+}
+
+// NewErrorOutgoingMessage creates an OutgoingMessage telling a session why its last message or command failed.
+func NewErrorOutgoingMessage(message string) OutgoingMessage {
+	return OutgoingMessage{ID: uuid.New().String(), Type: MessageTypeError, Timestamp: time.Now(), Message: message}
+}
+
+// NewUserListOutgoingMessage creates an OutgoingMessage containing the presence of users, requestID is the request id
+// of the command that listed them.
+func NewUserListOutgoingMessage(requestID string, users []UserPresence) OutgoingMessage {
+	return OutgoingMessage{ID: uuid.New().String(), Type: MessageTypeUserList, Timestamp: time.Now(), Users: users, RequestID: requestID}
+}
+
+// NewReplyOutgoingMessage creates an OutgoingMessage telling that the command with the request id was handled,
+// errorMessage is empty if it succeeded.
+func NewReplyOutgoingMessage(requestID, errorMessage string) OutgoingMessage {
+	return OutgoingMessage{ID: uuid.New().String(), Type: MessageTypeReply, Timestamp: time.Now(), RequestID: requestID, Error: errorMessage}
+}
+
+// NewOutgoingMessageFromStored creates an OutgoingMessage delivering a text or private message.
+func NewOutgoingMessageFromStored(message *StoredMessage, replayed bool) OutgoingMessage {
+	return OutgoingMessage{
+		ID:            message.ID,
+		Type:          message.Type,
+		Timestamp:     message.Timestamp,
+		SenderName:    message.SenderName,
+		RoomName:      message.RoomName,
+		RecipientName: message.RecipientName,
+		Message:       message.Message,
+		Replayed:      replayed,
+	}
+}
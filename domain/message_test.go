@@ -0,0 +1,65 @@
+package domain_test
+
+import (
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/test"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Message", func() {
+	var (
+		userA *domain.User
+		userB *domain.User
+		userC *domain.User
+	)
+
+	BeforeEach(func() {
+		userA, _ = domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+		userB, _ = domain.NewUser(test.USER_NAME_B, test.USER_PASSWORD_B)
+		userC, _ = domain.NewUser(test.USER_NAME_C, test.USER_PASSWORD_A)
+	})
+
+	Context("#StoredMessage", func() {
+		It("should only make private messages visible to sender and recipient", func() {
+			message := domain.NewPrivateStoredMessage(userA, userB, test.TEXT_MESSAGE_A)
+			Expect(message.IsVisibleTo(userA.ID, domain.DefaultRoomName)).To(BeTrue())
+			Expect(message.IsVisibleTo(userB.ID, test.ROOM_NAME_A)).To(BeTrue())
+			Expect(message.IsVisibleTo(userC.ID, domain.DefaultRoomName)).To(BeFalse())
+		})
+
+		It("should only make text messages visible in their room", func() {
+			message := domain.NewTextStoredMessage(userA, test.ROOM_NAME_A, test.TEXT_MESSAGE_A)
+			Expect(message.IsVisibleTo(userB.ID, test.ROOM_NAME_A)).To(BeTrue())
+			Expect(message.IsVisibleTo(userB.ID, domain.DefaultRoomName)).To(BeFalse())
+		})
+	})
+
+	Context("#InMemoryMessageStore", func() {
+		It("should return the most recent visible messages oldest first", func() {
+			messageStore := domain.NewInMemoryMessageStore(10)
+			first := domain.NewTextStoredMessage(userA, test.ROOM_NAME_A, "first")
+			hidden := domain.NewTextStoredMessage(userA, domain.DefaultRoomName, "hidden")
+			second := domain.NewPrivateStoredMessage(userA, userB, "second")
+			third := domain.NewTextStoredMessage(userC, test.ROOM_NAME_A, "third")
+			for _, message := range []*domain.StoredMessage{first, hidden, second, third} {
+				messageStore.Add(message)
+			}
+
+			Expect(messageStore.FindLastVisibleTo(userB.ID, test.ROOM_NAME_A, 10)).To(Equal([]*domain.StoredMessage{first, second, third}))
+			Expect(messageStore.FindLastVisibleTo(userB.ID, test.ROOM_NAME_A, 2)).To(Equal([]*domain.StoredMessage{second, third}))
+		})
+
+		It("should discard the oldest messages once the capacity is reached", func() {
+			messageStore := domain.NewInMemoryMessageStore(2)
+			for _, text := range []string{"first", "second", "third"} {
+				messageStore.Add(domain.NewTextStoredMessage(userA, test.ROOM_NAME_A, text))
+			}
+
+			messages := messageStore.FindLastVisibleTo(userA.ID, test.ROOM_NAME_A, 10)
+			Expect(messages).To(HaveLen(2))
+			Expect(messages[0].Message).To(Equal("second"))
+			Expect(messages[1].Message).To(Equal("third"))
+		})
+	})
+})
@@ -0,0 +1,119 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"strconv"
+	"time"
+)
+
+// OverflowPolicy determines what happens to a message sent to a session whose outgoing queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest drops the oldest queued message to make room for the new one.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowDisconnect drops the new message and disconnects the session.
+	OverflowDisconnect
+	// OverflowBlock waits for room in the queue until a timeout and drops the new message afterwards.
+	OverflowBlock
+)
+
+// OverflowPolicyFromString is used to match the string variant of a policy, the second result is false if the policy is unknown.
+func OverflowPolicyFromString(s string) (OverflowPolicy, bool) {
+	for policy := OverflowDropOldest; policy <= OverflowBlock; policy++ {
+		if policy.String() == s {
+			return policy, true
+		}
+	}
+	return OverflowDropOldest, false
+}
+
+// String implements the string variants of OverflowPolicy.
+func (o OverflowPolicy) String() string {
+	overflowPolicyToStringMapping := []string{"drop-oldest", "disconnect", "block"}
+	if o < 0 || int(o) > len(overflowPolicyToStringMapping)-1 {
+		return strconv.Itoa(int(o))
+	}
+	return overflowPolicyToStringMapping[o]
+}
+
+// PushResult tells the sender of a message what happened to it.
+type PushResult int
+
+const (
+	// PushQueued means the message was queued without dropping any message.
+	PushQueued PushResult = iota
+	// PushDroppedOldest means the message was queued after dropping the oldest queued message.
+	PushDroppedOldest
+	// PushDropped means the message was dropped because the queue stayed full.
+	PushDropped
+	// PushOverflowed means the message was dropped and the session has to be disconnected.
+	PushOverflowed
+)
+
+// OutgoingQueue is a bounded queue of messages waiting to be written to a session. Messages are pushed by the
+// chat service and taken by the goroutine writing to the connection, so a slow connection can not block the sender.
+type OutgoingQueue struct {
+	messages     chan OutgoingMessage
+	policy       OverflowPolicy
+	blockTimeout time.Duration
+}
+
+// NewOutgoingQueue creates a queue holding at most capacity messages, blockTimeout is only used by OverflowBlock.
+func NewOutgoingQueue(capacity int, policy OverflowPolicy, blockTimeout time.Duration) *OutgoingQueue {
+	return &OutgoingQueue{messages: make(chan OutgoingMessage, max(capacity, 1)), policy: policy, blockTimeout: blockTimeout}
+}
+
+// Push adds a message to the queue applying the overflow policy if the queue is full.
+func (q *OutgoingQueue) Push(message OutgoingMessage) PushResult {
+	select {
+	case q.messages <- message:
+		return PushQueued
+	default:
+	}
+	switch q.policy {
+	case OverflowDisconnect:
+		return PushOverflowed
+	case OverflowBlock:
+		timer := time.NewTimer(q.blockTimeout)
+		defer timer.Stop()
+		select {
+		case q.messages <- message:
+			return PushQueued
+		case <-timer.C:
+			return PushDropped
+		}
+	default:
+		// The writer may take messages concurrently, so room is made until the message fits.
+		droppedOldest := false
+		for {
+			select {
+			case <-q.messages:
+				droppedOldest = true
+			default:
+			}
+			select {
+			case q.messages <- message:
+				if droppedOldest {
+					return PushDroppedOldest
+				}
+				return PushQueued
+			default:
+			}
+		}
+	}
+}
+
+// Messages returns the channel the queued messages are taken from.
+func (q *OutgoingQueue) Messages() <-chan OutgoingMessage {
+	return q.messages
+}
+
+// Len returns the number of queued messages.
+func (q *OutgoingQueue) Len() int {
+	return len(q.messages)
+}
@@ -0,0 +1,74 @@
+package domain_test
+
+import (
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OutgoingQueue", func() {
+	first := domain.NewServerOutgoingMessage("first")
+	second := domain.NewServerOutgoingMessage("second")
+	third := domain.NewServerOutgoingMessage("third")
+
+	Context("when the queue has room", func() {
+		It("should queue messages in order", func() {
+			queue := domain.NewOutgoingQueue(2, domain.OverflowDisconnect, time.Second)
+			Expect(queue.Push(first)).To(Equal(domain.PushQueued))
+			Expect(queue.Push(second)).To(Equal(domain.PushQueued))
+			Expect(queue.Len()).To(Equal(2))
+			Expect(<-queue.Messages()).To(Equal(first))
+			Expect(<-queue.Messages()).To(Equal(second))
+		})
+	})
+
+	Context("when the queue is full", func() {
+		It("should drop the oldest message using the drop-oldest policy", func() {
+			queue := domain.NewOutgoingQueue(2, domain.OverflowDropOldest, time.Second)
+			queue.Push(first)
+			queue.Push(second)
+			Expect(queue.Push(third)).To(Equal(domain.PushDroppedOldest))
+			Expect(<-queue.Messages()).To(Equal(second))
+			Expect(<-queue.Messages()).To(Equal(third))
+		})
+
+		It("should request a disconnect using the disconnect policy", func() {
+			queue := domain.NewOutgoingQueue(1, domain.OverflowDisconnect, time.Second)
+			queue.Push(first)
+			Expect(queue.Push(second)).To(Equal(domain.PushOverflowed))
+			Expect(queue.Len()).To(Equal(1))
+		})
+
+		It("should wait for room using the block policy", func() {
+			queue := domain.NewOutgoingQueue(1, domain.OverflowBlock, time.Second)
+			queue.Push(first)
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				<-queue.Messages()
+			}()
+			Expect(queue.Push(second)).To(Equal(domain.PushQueued))
+			Expect(<-queue.Messages()).To(Equal(second))
+		})
+
+		It("should drop the message after the timeout using the block policy", func() {
+			queue := domain.NewOutgoingQueue(1, domain.OverflowBlock, 10*time.Millisecond)
+			queue.Push(first)
+			Expect(queue.Push(second)).To(Equal(domain.PushDropped))
+			Expect(<-queue.Messages()).To(Equal(first))
+		})
+	})
+
+	DescribeTable("Getting an OverflowPolicy from a string",
+		func(policyString string, expectedPolicy domain.OverflowPolicy, expectedKnown bool) {
+			policy, isKnown := domain.OverflowPolicyFromString(policyString)
+			Expect(isKnown).To(Equal(expectedKnown))
+			Expect(policy).To(Equal(expectedPolicy))
+		},
+		Entry("When given drop-oldest", "drop-oldest", domain.OverflowDropOldest, true),
+		Entry("When given disconnect", "disconnect", domain.OverflowDisconnect, true),
+		Entry("When given block", "block", domain.OverflowBlock, true),
+		Entry("When given an unknown policy", "ignore", domain.OverflowDropOldest, false),
+	)
+})
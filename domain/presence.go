@@ -0,0 +1,104 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PresenceStatus tells other users whether a logged in user is around.
+type PresenceStatus int
+
+const (
+	PresenceOnline PresenceStatus = iota
+	PresenceAway
+	PresenceBusy
+)
+
+// String implements the string variants of PresenceStatus.
+func (p PresenceStatus) String() string {
+	presenceStatusToStringMapping := []string{"online", "away", "busy"}
+	if p < 0 || int(p) > len(presenceStatusToStringMapping)-1 {
+		return strconv.Itoa(int(p))
+	}
+	return presenceStatusToStringMapping[p]
+}
+
+// Presence is the status of a logged in user and the time of its last activity on any of its sessions.
+type Presence struct {
+	Status PresenceStatus
+	// Reason is an optional explanation of the status given by the user.
+	Reason         string
+	LastActivityAt time.Time
+}
+
+// Idle returns how long the user has not been active at the given time.
+func (p Presence) Idle(now time.Time) time.Duration {
+	return max(now.Sub(p.LastActivityAt), 0)
+}
+
+// UserPresence is the presence of a named user at the time it was listed.
+type UserPresence struct {
+	Name   string
+	Status PresenceStatus
+	Reason string
+	Idle   time.Duration
+}
+
+type PresenceRepository interface {
+	// Touch records activity of the user at the given time, users without a presence become online.
+	Touch(userID string, now time.Time) Presence
+	// SetStatus changes the status of the user, which also counts as activity at the given time.
+	SetStatus(userID string, status PresenceStatus, reason string, now time.Time) Presence
+	Find(userID string) (presence Presence, presenceExists bool)
+	Delete(userID string) (presence Presence, presenceExists bool)
+}
+
+// InMemoryPresenceRepository keeps the presence per user id, it is safe for concurrent use.
+type InMemoryPresenceRepository struct {
+	mutex     sync.Mutex
+	presences map[string]Presence
+}
+
+func NewInMemoryPresenceRepository() *InMemoryPresenceRepository {
+	return &InMemoryPresenceRepository{presences: make(map[string]Presence)}
+}
+
+func (i *InMemoryPresenceRepository) Touch(userID string, now time.Time) Presence {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	presence := i.presences[userID]
+	presence.LastActivityAt = now
+	i.presences[userID] = presence
+	return presence
+}
+
+func (i *InMemoryPresenceRepository) SetStatus(userID string, status PresenceStatus, reason string, now time.Time) Presence {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	presence := Presence{Status: status, Reason: reason, LastActivityAt: now}
+	i.presences[userID] = presence
+	return presence
+}
+
+func (i *InMemoryPresenceRepository) Find(userID string) (presence Presence, presenceExists bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	presence, presenceExists = i.presences[userID]
+	return
+}
+
+func (i *InMemoryPresenceRepository) Delete(userID string) (presence Presence, presenceExists bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if presence, presenceExists = i.presences[userID]; !presenceExists {
+		return
+	}
+	delete(i.presences, userID)
+	return
+}
@@ -0,0 +1,47 @@
+package domain_test
+
+import (
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Presence", func() {
+	var (
+		presenceRepository *domain.InMemoryPresenceRepository
+		now                time.Time
+	)
+
+	BeforeEach(func() {
+		presenceRepository = domain.NewInMemoryPresenceRepository()
+		now = time.Now()
+	})
+
+	It("should make users online on their first activity", func() {
+		presenceRepository.Touch("alice", now)
+		presence, presenceExists := presenceRepository.Find("alice")
+		Expect(presenceExists).To(BeTrue())
+		Expect(presence.Status).To(Equal(domain.PresenceOnline))
+		Expect(presence.Idle(now.Add(time.Minute))).To(Equal(time.Minute))
+	})
+
+	It("should keep the status when the user is active", func() {
+		presenceRepository.SetStatus("alice", domain.PresenceAway, "lunch", now)
+		presence := presenceRepository.Touch("alice", now.Add(time.Minute))
+		Expect(presence).To(Equal(domain.Presence{Status: domain.PresenceAway, Reason: "lunch", LastActivityAt: now.Add(time.Minute)}))
+	})
+
+	It("should forget deleted presences", func() {
+		presenceRepository.Touch("alice", now)
+		_, presenceExisted := presenceRepository.Delete("alice")
+		Expect(presenceExisted).To(BeTrue())
+		_, presenceExists := presenceRepository.Find("alice")
+		Expect(presenceExists).To(BeFalse())
+	})
+
+	It("should never report a negative idle time", func() {
+		Expect(domain.Presence{LastActivityAt: now}.Idle(now.Add(-time.Second))).To(BeZero())
+	})
+})
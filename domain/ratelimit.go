@@ -0,0 +1,99 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimitPruneInterval is how often buckets that are full again are removed from an InMemoryRateLimitRepository.
+const rateLimitPruneInterval = time.Minute
+
+// RateLimit is a token bucket, Burst lines may be sent at once and one more line every RefillInterval.
+type RateLimit struct {
+	// Burst is the size of the bucket, zero disables the limit.
+	Burst          int
+	RefillInterval time.Duration
+}
+
+// Enabled reports whether the rate limit restricts anything.
+func (r RateLimit) Enabled() bool {
+	return r.Burst > 0 && r.RefillInterval > 0
+}
+
+// TokenBucket holds the tokens left for a rate limited key.
+type TokenBucket struct {
+	// Tokens may become negative, tokens taken from an empty bucket are reserved for the time they are refilled.
+	Tokens    float64
+	UpdatedAt time.Time
+	// FullAt is the time at which the bucket is full again if no further tokens are taken.
+	FullAt time.Time
+}
+
+// take refills the bucket up to the given time and takes a token, it returns how long the caller has to wait for the token.
+// At most Burst tokens are reserved, so that callers that keep taking tokens do not wait forever once they stop.
+func (b TokenBucket) take(now time.Time, limit RateLimit) (TokenBucket, time.Duration) {
+	refilled := float64(now.Sub(b.UpdatedAt)) / float64(limit.RefillInterval)
+	b.Tokens = max(min(b.Tokens+max(refilled, 0), float64(limit.Burst))-1, -float64(limit.Burst))
+	b.UpdatedAt = now
+	b.FullAt = now.Add(time.Duration((float64(limit.Burst) - b.Tokens) * float64(limit.RefillInterval)))
+	if b.Tokens >= 0 {
+		return b, 0
+	}
+	return b, time.Duration(-b.Tokens * float64(limit.RefillInterval))
+}
+
+type RateLimitRepository interface {
+	// Take takes a token for key and returns how long to wait for it, it is zero if the token was available right away.
+	Take(key string, now time.Time, limit RateLimit) time.Duration
+	Delete(key string) (bucket TokenBucket, bucketExists bool)
+}
+
+// InMemoryRateLimitRepository keeps a token bucket per key, it is safe for concurrent use.
+type InMemoryRateLimitRepository struct {
+	mutex    sync.Mutex
+	buckets  map[string]TokenBucket
+	prunedAt time.Time
+}
+
+func NewInMemoryRateLimitRepository() *InMemoryRateLimitRepository {
+	return &InMemoryRateLimitRepository{buckets: make(map[string]TokenBucket)}
+}
+
+// Take takes a token for key, buckets of other keys that are full again are removed from time to time.
+func (i *InMemoryRateLimitRepository) Take(key string, now time.Time, limit RateLimit) time.Duration {
+	if !limit.Enabled() {
+		return 0
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if now.Sub(i.prunedAt) > rateLimitPruneInterval {
+		for otherKey, bucket := range i.buckets {
+			if !now.Before(bucket.FullAt) {
+				delete(i.buckets, otherKey)
+			}
+		}
+		i.prunedAt = now
+	}
+	bucket, bucketExists := i.buckets[key]
+	if !bucketExists {
+		bucket = TokenBucket{Tokens: float64(limit.Burst), UpdatedAt: now}
+	}
+	bucket, wait := bucket.take(now, limit)
+	i.buckets[key] = bucket
+	return wait
+}
+
+func (i *InMemoryRateLimitRepository) Delete(key string) (bucket TokenBucket, bucketExists bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if bucket, bucketExists = i.buckets[key]; !bucketExists {
+		return
+	}
+	delete(i.buckets, key)
+	return
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultRoomName is the name of the room every new session joins and returns to when leaving a room.
+const DefaultRoomName = "lobby"
+
+var roomNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// Room represents a chat room, text messages are only delivered to the members of the senders room.
+// Its members may be changed and read concurrently.
+type Room struct {
+	Name       string
+	mutex      sync.RWMutex
+	sessionIDs map[string]struct{}
+}
+
+func NewRoom(name string) *Room {
+	return &Room{Name: name, sessionIDs: make(map[string]struct{})}
+}
+
+// NormalizeRoomName removes an optional leading '#' from a room name.
+func NormalizeRoomName(name string) string {
+	return strings.TrimPrefix(name, "#")
+}
+
+// RoomNameIsValid checks whether a (normalized) room name only consists of letters, digits, '-' and '_'.
+func RoomNameIsValid(name string) bool {
+	return roomNamePattern.MatchString(name)
+}
+
+func (r *Room) AddMember(sessionID string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, isMember := r.sessionIDs[sessionID]; isMember {
+		return false
+	}
+	r.sessionIDs[sessionID] = struct{}{}
+	return true
+}
+
+func (r *Room) RemoveMember(sessionID string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, isMember := r.sessionIDs[sessionID]; !isMember {
+		return false
+	}
+	delete(r.sessionIDs, sessionID)
+	return true
+}
+
+func (r *Room) HasMember(sessionID string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	_, isMember := r.sessionIDs[sessionID]
+	return isMember
+}
+
+// Members returns the session ids of all members of the room.
+func (r *Room) Members() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	members := make([]string, 0, len(r.sessionIDs))
+	for sessionID := range r.sessionIDs {
+		members = append(members, sessionID)
+	}
+	return members
+}
+
+func (r *Room) IsEmpty() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.sessionIDs) == 0
+}
+
+type RoomRepository interface {
+	Add(*Room) bool
+	GetAll() []*Room
+	FindByName(string) (room *Room, roomExists bool)
+	FindBySessionID(string) (room *Room, roomExists bool)
+	Delete(string) (room *Room, roomExists bool)
+}
+
+// InMemoryRoomRepository is safe for concurrent use.
+type InMemoryRoomRepository struct {
+	mutex sync.RWMutex
+	rooms map[string]*Room
+}
+
+func NewInMemoryRoomRepository() *InMemoryRoomRepository {
+	return &InMemoryRoomRepository{rooms: make(map[string]*Room)}
+}
+
+func (i *InMemoryRoomRepository) Add(room *Room) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if _, roomExists := i.rooms[room.Name]; roomExists {
+		return false
+	}
+	i.rooms[room.Name] = room
+	return true
+}
+
+// GetAll returns all rooms sorted by their name.
+func (i *InMemoryRoomRepository) GetAll() []*Room {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	rooms := make([]*Room, 0, len(i.rooms))
+	for _, room := range i.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(a, b int) bool { return rooms[a].Name < rooms[b].Name })
+	return rooms
+}
+
+func (i *InMemoryRoomRepository) FindByName(name string) (room *Room, roomExists bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	room, roomExists = i.rooms[name]
+	return
+}
+
+func (i *InMemoryRoomRepository) FindBySessionID(sessionID string) (*Room, bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	for _, room := range i.rooms {
+		if room.HasMember(sessionID) {
+			return room, true
+		}
+	}
+	return nil, false
+}
+
+func (i *InMemoryRoomRepository) Delete(name string) (room *Room, roomExists bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if room, roomExists = i.rooms[name]; !roomExists {
+		return
+	}
+	delete(i.rooms, name)
+	return
+}
@@ -0,0 +1,91 @@
+package domain_test
+
+import (
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/test"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Room", func() {
+	Context("#Room", func() {
+		var room *domain.Room
+
+		BeforeEach(func() {
+			room = domain.NewRoom(test.ROOM_NAME_A)
+		})
+
+		Context("when adding members", func() {
+			It("should contain the members exactly once", func() {
+				Expect(room.IsEmpty()).To(BeTrue())
+				Expect(room.AddMember(test.SESSION_ID_A)).To(BeTrue())
+				Expect(room.AddMember(test.SESSION_ID_A)).To(BeFalse())
+				Expect(room.AddMember(test.SESSION_ID_B)).To(BeTrue())
+				Expect(room.Members()).To(ConsistOf(test.SESSION_ID_A, test.SESSION_ID_B))
+			})
+		})
+
+		Context("when removing members", func() {
+			It("should no longer contain the member", func() {
+				room.AddMember(test.SESSION_ID_A)
+				Expect(room.RemoveMember(test.SESSION_ID_A)).To(BeTrue())
+				Expect(room.RemoveMember(test.SESSION_ID_A)).To(BeFalse())
+				Expect(room.HasMember(test.SESSION_ID_A)).To(BeFalse())
+				Expect(room.IsEmpty()).To(BeTrue())
+			})
+		})
+
+		DescribeTable("Validating room names",
+			func(roomName string, expectedValid bool) {
+				Expect(domain.RoomNameIsValid(domain.NormalizeRoomName(roomName))).To(Equal(expectedValid))
+			},
+			Entry("When given a plain room name", test.ROOM_NAME_A, true),
+			Entry("When given a room name prefixed with #", test.ROOM_NAME_A_PREFIXED, true),
+			Entry("When given a room name with spaces", test.ROOM_NAME_INVALID, false),
+			Entry("When given an empty room name", "", false),
+		)
+	})
+
+	Context("#InMemoryRoomRepository", func() {
+		var roomRepository *domain.InMemoryRoomRepository
+
+		BeforeEach(func() {
+			roomRepository = domain.NewInMemoryRoomRepository()
+		})
+
+		Context("when adding rooms", func() {
+			It("should not add a room with the same name twice", func() {
+				Expect(roomRepository.Add(domain.NewRoom(test.ROOM_NAME_A))).To(BeTrue())
+				Expect(roomRepository.Add(domain.NewRoom(test.ROOM_NAME_A))).To(BeFalse())
+				Expect(roomRepository.GetAll()).To(HaveLen(1))
+			})
+		})
+
+		Context("when looking up the room of a session", func() {
+			It("should find the room the session is a member of", func() {
+				lobby := domain.NewRoom(domain.DefaultRoomName)
+				room := domain.NewRoom(test.ROOM_NAME_A)
+				roomRepository.Add(lobby)
+				roomRepository.Add(room)
+				room.AddMember(test.SESSION_ID_A)
+
+				foundRoom, roomExists := roomRepository.FindBySessionID(test.SESSION_ID_A)
+				Expect(roomExists).To(BeTrue())
+				Expect(foundRoom.Name).To(Equal(test.ROOM_NAME_A))
+
+				_, roomExists = roomRepository.FindBySessionID(test.SESSION_ID_B)
+				Expect(roomExists).To(BeFalse())
+			})
+		})
+
+		Context("when deleting rooms", func() {
+			It("should no longer find the room", func() {
+				roomRepository.Add(domain.NewRoom(test.ROOM_NAME_A))
+				_, roomExisted := roomRepository.Delete(test.ROOM_NAME_A)
+				Expect(roomExisted).To(BeTrue())
+				_, roomExists := roomRepository.FindByName(test.ROOM_NAME_A)
+				Expect(roomExists).To(BeFalse())
+			})
+		})
+	})
+})
@@ -5,27 +5,46 @@
 
 package domain
 
-import "github.com/google/uuid"
+import (
+	"net"
+	"sync"
+
+	"github.com/google/uuid"
+)
 
 // Session represents a newly created session.
 type Session struct {
-	ID                string
-	MessagesToSession chan<- string
-	Close             chan<- interface{}
+	ID string
+	// RemoteAddr is the network address of the client, it is used to enforce bans.
+	RemoteAddr string
+	// Outgoing holds the messages waiting to be written to the session.
+	Outgoing *OutgoingQueue
+	Close    chan<- interface{}
+}
+
+func NewSession(remoteAddr string, outgoing *OutgoingQueue, close chan<- interface{}) *Session {
+	return &Session{uuid.New().String(), remoteAddr, outgoing, close}
 }
 
-func NewSession(messagesToSession chan<- string, close chan<- interface{}) *Session {
-	return &Session{uuid.New().String(), messagesToSession, close}
+// RemoteHost returns the host part of RemoteAddr, or RemoteAddr itself if it has no port.
+func (s Session) RemoteHost() string {
+	host, _, err := net.SplitHostPort(s.RemoteAddr)
+	if err != nil {
+		return s.RemoteAddr
+	}
+	return host
 }
 
 type SessionRepository interface {
 	Add(Session) bool
 	FindByID(string) (session Session, sessionExists bool)
+	GetAll() []Session
 	FindAllExceptBySessionID(string) []Session
 	Delete(string) (session Session, sessionExists bool)
 }
 
 type InMemorySessionRepository struct {
+	mutex    sync.RWMutex
 	sessions map[string]Session
 }
 
@@ -34,6 +53,8 @@ func NewInMemorySessionRepository() *InMemorySessionRepository {
 }
 
 func (i *InMemorySessionRepository) Add(session Session) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
 	if _, sessionExists := i.sessions[session.ID]; sessionExists {
 		return false
 	}
@@ -42,6 +63,8 @@ func (i *InMemorySessionRepository) Add(session Session) bool {
 }
 
 func (i *InMemorySessionRepository) Delete(sessionID string) (session Session, ok bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
 	if session, ok = i.sessions[sessionID]; !ok {
 		return
 	}
@@ -50,11 +73,19 @@ func (i *InMemorySessionRepository) Delete(sessionID string) (session Session, o
 }
 
 func (i *InMemorySessionRepository) FindByID(id string) (session Session, ok bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
 	session, ok = i.sessions[id]
 	return
 }
 
+func (i *InMemorySessionRepository) GetAll() []Session {
+	return i.FindAllExceptBySessionID("")
+}
+
 func (i *InMemorySessionRepository) FindAllExceptBySessionID(id string) []Session {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
 	sessions := make([]Session, 0)
 	for _, session := range i.sessions {
 		if session.ID != id {
@@ -6,18 +6,87 @@
 package domain
 
 import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// MaxPasswordBytes is the maximum length of a password, bcrypt can not hash longer passwords.
+const MaxPasswordBytes = 72
+
+// MaxUserNameLength is the maximum length of a user name.
+const MaxUserNameLength = 32
+
+var userNamePattern = regexp.MustCompile(fmt.Sprintf(`^[a-zA-Z0-9_-]{1,%d}$`, MaxUserNameLength))
+
+// reservedUserNames may not be chosen by users because clients use them for the server or the user itself.
+var reservedUserNames = []string{"server", "system", "tcpchat", "you"}
+
+// UserNameIsValid checks whether a user name only consists of letters, digits, '-' and '_' and is not too long.
+func UserNameIsValid(name string) bool {
+	return userNamePattern.MatchString(name)
+}
+
+// UserNameIsReserved checks whether a user name is reserved, regardless of its case.
+func UserNameIsReserved(name string) bool {
+	return slices.Contains(reservedUserNames, strings.ToLower(name))
+}
+
+// passwordCost is the bcrypt cost used when hashing passwords.
+var passwordCost = bcrypt.MinCost
+
+// SetPasswordCost sets the bcrypt cost used when hashing new passwords.
+func SetPasswordCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cost)
+	}
+	passwordCost = cost
+	return nil
+}
+
+// Role determines which moderation commands a user may use, every role includes the permissions of the roles before it.
+type Role int
+
+const (
+	RoleUser Role = iota
+	RoleModerator
+	RoleAdmin
+)
+
+// RoleFromString is used to match the string variant of a role, the second result is false if the role is unknown.
+func RoleFromString(s string) (Role, bool) {
+	for role := RoleUser; role <= RoleAdmin; role++ {
+		if role.String() == s {
+			return role, true
+		}
+	}
+	return RoleUser, false
+}
+
+// String implements the string variants of Role.
+func (r Role) String() string {
+	roleToStringMapping := []string{"user", "moderator", "admin"}
+	if r < 0 || int(r) > len(roleToStringMapping)-1 {
+		return strconv.Itoa(int(r))
+	}
+	return roleToStringMapping[r]
+}
+
 type User struct {
 	ID             string
 	Name           string
+	Role           Role
 	hashedPassword string
 }
 
 func NewUser(name, password string) (*User, error) {
-	user := User{uuid.New().String(), name, ""}
+	user := User{ID: uuid.New().String(), Name: name, Role: RoleUser}
 	err := user.SetPassword(password)
 	if err != nil {
 		return nil, err
@@ -25,9 +94,10 @@ func NewUser(name, password string) (*User, error) {
 	return &user, nil
 }
 
+// SetPassword hashes and stores password, it only fails for passwords longer than MaxPasswordBytes.
+// Whether a password is strong enough is decided by the PasswordPolicy of the application.
 func (u *User) SetPassword(password string) error {
-	// TODO add password validation
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
 	if err != nil {
 		return err
 	}
@@ -35,6 +105,21 @@ func (u *User) SetPassword(password string) error {
 	return nil
 }
 
+// PasswordHash returns the hash stored by SetPassword, it can be passed to UserRepository.SetPasswordHash.
+func (u *User) PasswordHash() string {
+	return u.hashedPassword
+}
+
+func (u *User) clone() *User {
+	clone := *u
+	return &clone
+}
+
+// HasRole reports whether the user has at least the given role.
+func (u *User) HasRole(role Role) bool {
+	return u.Role >= role
+}
+
 func (u *User) PasswordIsValid(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.hashedPassword), []byte(password))
 	return err == nil
@@ -45,10 +130,22 @@ type UserRepository interface {
 	GetAll() []*User
 	FindByID(string) (user *User, userExists bool)
 	FindByName(string) (user *User, userExists bool)
+	// SetPasswordHash replaces the password hash of the user with the given ID, it fails if the user does not exist.
+	SetPasswordHash(userID, passwordHash string) bool
+	// SetRole changes the role of the user with the given ID, it fails if the user does not exist.
+	SetRole(userID string, role Role) bool
+	// Rename changes the name of the user with the given ID, it fails if the user does not exist or the name is taken
+	// by another user, names are compared regardless of their case.
+	Rename(userID, newName string) bool
 	Delete(string) (user *User, userExists bool)
 }
 
+// InMemoryUserRepository is safe for concurrent use, it returns copies of the stored users so that changes
+// only take effect through the methods of the repository, which change a single field of the stored user.
+// User names are unique regardless of their case, so that users can not pose as each other.
 type InMemoryUserRepository struct {
+	mutex sync.RWMutex
+	// users maps the names of the users in lower case to the users.
 	users map[string]*User
 }
 
@@ -57,25 +154,43 @@ func NewInMemoryUserRepository() *InMemoryUserRepository {
 }
 
 func (i *InMemoryUserRepository) Add(user *User) bool {
-	if _, userExists := i.users[user.Name]; userExists {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if _, userExists := i.users[userNameKey(user.Name)]; userExists {
 		return false
 	}
-	if _, userExists := i.FindByID(user.ID); userExists {
+	if _, userExists := i.findByID(user.ID); userExists {
 		return false
 	}
-	i.users[user.Name] = user
+	i.users[userNameKey(user.Name)] = user.clone()
 	return true
 }
 
+func userNameKey(name string) string {
+	return strings.ToLower(name)
+}
+
 func (i *InMemoryUserRepository) GetAll() []*User {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
 	users := make([]*User, 0)
 	for _, user := range i.users {
-		users = append(users, user)
+		users = append(users, user.clone())
 	}
 	return users
 }
 
 func (i *InMemoryUserRepository) FindByID(userID string) (*User, bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	user, userExists := i.findByID(userID)
+	if !userExists {
+		return nil, false
+	}
+	return user.clone(), true
+}
+
+func (i *InMemoryUserRepository) findByID(userID string) (*User, bool) {
 	for _, user := range i.users {
 		if user.ID == userID {
 			return user, true
@@ -84,15 +199,60 @@ func (i *InMemoryUserRepository) FindByID(userID string) (*User, bool) {
 	return nil, false
 }
 
-func (i *InMemoryUserRepository) FindByName(name string) (user *User, userExists bool) {
-	user, userExists = i.users[name]
-	return
+func (i *InMemoryUserRepository) FindByName(name string) (*User, bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	user, userExists := i.users[userNameKey(name)]
+	if !userExists {
+		return nil, false
+	}
+	return user.clone(), true
+}
+
+func (i *InMemoryUserRepository) SetPasswordHash(userID, passwordHash string) bool {
+	return i.change(userID, func(user *User) { user.hashedPassword = passwordHash })
+}
+
+func (i *InMemoryUserRepository) SetRole(userID string, role Role) bool {
+	return i.change(userID, func(user *User) { user.Role = role })
+}
+
+// change applies apply to the stored user with the given ID while holding the lock, so concurrent changes of
+// different fields do not overwrite each other.
+func (i *InMemoryUserRepository) change(userID string, apply func(*User)) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	user, userExists := i.findByID(userID)
+	if !userExists {
+		return false
+	}
+	apply(user)
+	return true
+}
+
+func (i *InMemoryUserRepository) Rename(userID, newName string) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	user, userExists := i.findByID(userID)
+	if !userExists {
+		return false
+	}
+	if otherUser, nameTaken := i.users[userNameKey(newName)]; nameTaken && otherUser != user {
+		return false
+	}
+	delete(i.users, userNameKey(user.Name))
+	user.Name = newName
+	i.users[userNameKey(newName)] = user
+	return true
 }
 
-func (i *InMemoryUserRepository) Delete(name string) (user *User, userExists bool) {
-	if user, userExists = i.users[name]; !userExists {
-		return
+func (i *InMemoryUserRepository) Delete(name string) (*User, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	user, userExists := i.users[userNameKey(name)]
+	if !userExists {
+		return nil, false
 	}
-	delete(i.users, name)
-	return
+	delete(i.users, userNameKey(name))
+	return user, true
 }
@@ -1,6 +1,9 @@
 package domain_test
 
 import (
+	"strings"
+	"sync"
+
 	"github.com/benedictweis/tcpchat-server-go/domain"
 	"github.com/benedictweis/tcpchat-server-go/test"
 	. "github.com/onsi/ginkgo/v2"
@@ -54,4 +57,126 @@ var _ = Describe("User", func() {
 			})
 		})
 	})
+
+	Context("#UserNameIsValid", func() {
+		DescribeTable("should only accept short names of letters, digits, '-' and '_'",
+			func(name string, expectedValid bool) {
+				Expect(domain.UserNameIsValid(name)).To(Equal(expectedValid))
+			},
+			Entry("When given a simple name", "alice", true),
+			Entry("When given a name with digits, '-' and '_'", "bob-smith_2", true),
+			Entry("When given an empty name", "", false),
+			Entry("When given a name with spaces", "bob smith", false),
+			Entry("When given a name with symbols", "[server]", false),
+			Entry("When given a name with non ascii letters", "jürgen", false),
+			Entry("When given a name of the maximum length", strings.Repeat("a", domain.MaxUserNameLength), true),
+			Entry("When given a name that is too long", strings.Repeat("a", domain.MaxUserNameLength+1), false),
+		)
+
+		It("should reserve the name of the server regardless of its case", func() {
+			Expect(domain.UserNameIsReserved("Server")).To(BeTrue())
+			Expect(domain.UserNameIsReserved(userNameA)).To(BeFalse())
+		})
+	})
+
+	Context("InMemoryUserRepository", func() {
+		var (
+			userRepository *domain.InMemoryUserRepository
+			userA          *domain.User
+		)
+
+		BeforeEach(func() {
+			userRepository = domain.NewInMemoryUserRepository()
+			userA, _ = domain.NewUser(userNameA, userPasswordA)
+			userB, _ := domain.NewUser(test.USER_NAME_B, userPasswordB)
+			Expect(userRepository.Add(userA)).To(BeTrue())
+			Expect(userRepository.Add(userB)).To(BeTrue())
+		})
+
+		Context("when names differ only in their case", func() {
+			It("should treat them as the same name", func() {
+				impostor, _ := domain.NewUser(strings.ToUpper(userNameA), userPasswordB)
+				Expect(userRepository.Add(impostor)).To(BeFalse())
+				user, userExists := userRepository.FindByName(strings.ToUpper(userNameA))
+				Expect(userExists).To(BeTrue())
+				Expect(user.ID).To(Equal(userA.ID))
+				Expect(userRepository.Rename(userA.ID, strings.ToUpper(test.USER_NAME_B))).To(BeFalse())
+			})
+
+			It("should let users change the case of their own name", func() {
+				Expect(userRepository.Rename(userA.ID, strings.ToUpper(userNameA))).To(BeTrue())
+				user, userExists := userRepository.FindByName(userNameA)
+				Expect(userExists).To(BeTrue())
+				Expect(user.Name).To(Equal(strings.ToUpper(userNameA)))
+				_, userExisted := userRepository.Delete(userNameA)
+				Expect(userExisted).To(BeTrue())
+				Expect(userRepository.GetAll()).To(HaveLen(1))
+			})
+		})
+
+		Context("#Rename", func() {
+			It("should only find the user by its new name", func() {
+				Expect(userRepository.Rename(userA.ID, test.USER_NAME_C)).To(BeTrue())
+				renamedUser, userExists := userRepository.FindByName(test.USER_NAME_C)
+				Expect(userExists).To(BeTrue())
+				Expect(renamedUser.ID).To(Equal(userA.ID))
+				_, userExists = userRepository.FindByName(userNameA)
+				Expect(userExists).To(BeFalse())
+			})
+
+			It("should not take the name of another user", func() {
+				Expect(userRepository.Rename(userA.ID, test.USER_NAME_B)).To(BeFalse())
+				user, _ := userRepository.FindByID(userA.ID)
+				Expect(user.Name).To(Equal(userNameA))
+			})
+
+			It("should not rename unknown users", func() {
+				Expect(userRepository.Rename("unknown", test.USER_NAME_C)).To(BeFalse())
+			})
+		})
+
+		Context("#SetRole", func() {
+			It("should not change unknown users", func() {
+				Expect(userRepository.SetRole("unknown", domain.RoleAdmin)).To(BeFalse())
+			})
+		})
+
+		Context("#SetPasswordHash", func() {
+			It("should not change the other fields of the user", func() {
+				Expect(userRepository.SetRole(userA.ID, domain.RoleModerator)).To(BeTrue())
+				Expect(userA.SetPassword(userPasswordB)).To(Succeed())
+				Expect(userRepository.SetPasswordHash(userA.ID, userA.PasswordHash())).To(BeTrue())
+				user, _ := userRepository.FindByID(userA.ID)
+				Expect(user.PasswordIsValid(userPasswordB)).To(BeTrue())
+				Expect(user.Role).To(Equal(domain.RoleModerator))
+			})
+		})
+
+		Context("when changing different fields concurrently", func() {
+			It("should keep all changes", func() {
+				Expect(userA.SetPassword(userPasswordB)).To(Succeed())
+				var waitGroup sync.WaitGroup
+				for range 50 {
+					waitGroup.Add(3)
+					go func() {
+						defer waitGroup.Done()
+						userRepository.SetRole(userA.ID, domain.RoleModerator)
+					}()
+					go func() {
+						defer waitGroup.Done()
+						userRepository.SetPasswordHash(userA.ID, userA.PasswordHash())
+					}()
+					go func() {
+						defer waitGroup.Done()
+						userRepository.Rename(userA.ID, test.USER_NAME_C)
+					}()
+				}
+				waitGroup.Wait()
+				user, _ := userRepository.FindByID(userA.ID)
+				Expect(user.Name).To(Equal(test.USER_NAME_C))
+				Expect(user.Role).To(Equal(domain.RoleModerator))
+				Expect(user.PasswordIsValid(userPasswordB)).To(BeTrue())
+			})
+		})
+	})
 })
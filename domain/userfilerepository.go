@@ -0,0 +1,338 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package domain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+const (
+	userRecordPut    = "put"
+	userRecordDelete = "delete"
+
+	// minRecordsBeforeCompaction is the minimum number of records in the log before it is compacted.
+	minRecordsBeforeCompaction = 64
+)
+
+// userRecord is a single entry of the append-only log of a FileUserRepository.
+type userRecord struct {
+	Operation      string `json:"op"`
+	ID             string `json:"id"`
+	Name           string `json:"name,omitempty"`
+	HashedPassword string `json:"hashedPassword,omitempty"`
+	Role           string `json:"role,omitempty"`
+}
+
+// userLog is the file the records of a FileUserRepository are appended to.
+type userLog interface {
+	io.Writer
+	io.Seeker
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// FileUserRepository is a UserRepository that keeps all users in memory and persists every change
+// to an append-only log of JSON records, the log is compacted once it contains mostly stale records.
+// It is safe for concurrent use, changes are written to the log in the order they are applied.
+type FileUserRepository struct {
+	*InMemoryUserRepository
+	// logMutex serializes changes so that the log and the in memory state stay in the same order.
+	logMutex sync.Mutex
+	path     string
+	file     userLog
+	records  int
+}
+
+// NewFileUserRepository opens or creates the user log at path and restores all users from it.
+func NewFileUserRepository(path string) (*FileUserRepository, error) {
+	f := &FileUserRepository{InMemoryUserRepository: NewInMemoryUserRepository(), path: path}
+	if err := f.replay(); err != nil {
+		return nil, err
+	}
+	if f.needsCompaction() {
+		if err := f.compact(); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.openForAppend(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileUserRepository) Add(user *User) bool {
+	f.logMutex.Lock()
+	defer f.logMutex.Unlock()
+	if !f.InMemoryUserRepository.Add(user) {
+		return false
+	}
+	if err := f.append(newPutUserRecord(user)); err != nil {
+		slog.Error("failed to persist new user", "userID", user.ID, "err", err)
+		f.InMemoryUserRepository.Delete(user.Name)
+		return false
+	}
+	return true
+}
+
+func (f *FileUserRepository) SetPasswordHash(userID, passwordHash string) bool {
+	return f.change(userID, func(user *User) { user.hashedPassword = passwordHash })
+}
+
+func (f *FileUserRepository) SetRole(userID string, role Role) bool {
+	return f.change(userID, func(user *User) { user.Role = role })
+}
+
+// change applies apply to the stored user and persists it, the user is restored if it can not be persisted.
+func (f *FileUserRepository) change(userID string, apply func(*User)) bool {
+	f.logMutex.Lock()
+	defer f.logMutex.Unlock()
+	oldUser, userExists := f.InMemoryUserRepository.FindByID(userID)
+	if !userExists || !f.InMemoryUserRepository.change(userID, apply) {
+		return false
+	}
+	user, _ := f.InMemoryUserRepository.FindByID(userID)
+	if err := f.append(newPutUserRecord(user)); err != nil {
+		slog.Error("failed to persist changed user", "userID", userID, "err", err)
+		f.InMemoryUserRepository.change(userID, func(user *User) { *user = *oldUser })
+		return false
+	}
+	return true
+}
+
+func (f *FileUserRepository) Rename(userID, newName string) bool {
+	f.logMutex.Lock()
+	defer f.logMutex.Unlock()
+	user, userExists := f.InMemoryUserRepository.FindByID(userID)
+	if !userExists || !f.InMemoryUserRepository.Rename(userID, newName) {
+		return false
+	}
+	oldName := user.Name
+	user.Name = newName
+	if err := f.append(newPutUserRecord(user)); err != nil {
+		slog.Error("failed to persist renamed user", "userID", user.ID, "err", err)
+		f.InMemoryUserRepository.Rename(userID, oldName)
+		return false
+	}
+	return true
+}
+
+func (f *FileUserRepository) Delete(name string) (*User, bool) {
+	f.logMutex.Lock()
+	defer f.logMutex.Unlock()
+	user, userExists := f.InMemoryUserRepository.Delete(name)
+	if !userExists {
+		return nil, false
+	}
+	if err := f.append(userRecord{Operation: userRecordDelete, ID: user.ID}); err != nil {
+		slog.Error("failed to persist deleted user", "userID", user.ID, "err", err)
+		f.InMemoryUserRepository.Add(user)
+		return nil, false
+	}
+	return user, true
+}
+
+// Compact rewrites the log so that it only contains a single record per existing user.
+func (f *FileUserRepository) Compact() error {
+	f.logMutex.Lock()
+	defer f.logMutex.Unlock()
+	return f.compactAndReopen()
+}
+
+// compactAndReopen compacts the log and reopens it for appending. The current log stays open if compacting fails,
+// if reopening fails the log is closed so that further changes fail instead of being written to the replaced file.
+func (f *FileUserRepository) compactAndReopen() error {
+	if err := f.compact(); err != nil {
+		return err
+	}
+	if err := f.close(); err != nil {
+		slog.Warn("failed to close the replaced user log", "path", f.path, "err", err)
+	}
+	return f.openForAppend()
+}
+
+// Close closes the underlying log file.
+func (f *FileUserRepository) Close() error {
+	f.logMutex.Lock()
+	defer f.logMutex.Unlock()
+	return f.close()
+}
+
+func (f *FileUserRepository) close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func newPutUserRecord(user *User) userRecord {
+	return userRecord{Operation: userRecordPut, ID: user.ID, Name: user.Name, HashedPassword: user.hashedPassword, Role: user.Role.String()}
+}
+
+// replay restores the in memory state from all records in the log. A torn record at the end of the log, left by a
+// write that was interrupted, is removed from the log, while a corrupt record before other records is an error.
+func (f *FileUserRepository) replay() error {
+	file, err := os.Open(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	usersByID := make(map[string]*User)
+	reader := bufio.NewReader(file)
+	var validLength int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		var record userRecord
+		if len(bytes.TrimSpace(line)) == 0 {
+			validLength += int64(len(line))
+			continue
+		}
+		if decodeErr := json.Unmarshal(line, &record); decodeErr != nil || errors.Is(err, io.EOF) {
+			if _, peekErr := reader.Peek(1); !errors.Is(peekErr, io.EOF) {
+				return fmt.Errorf("corrupt user log %s after %d records: %w", f.path, f.records, decodeErr)
+			}
+			slog.Warn("removing a torn record at the end of the user log", "path", f.path, "records", f.records)
+			if err := os.Truncate(f.path, validLength); err != nil {
+				return err
+			}
+			break
+		}
+		validLength += int64(len(line))
+		f.records++
+		switch record.Operation {
+		case userRecordPut:
+			// Records written before roles were introduced have no role and belong to regular users.
+			role, _ := RoleFromString(record.Role)
+			usersByID[record.ID] = &User{ID: record.ID, Name: record.Name, Role: role, hashedPassword: record.HashedPassword}
+		case userRecordDelete:
+			delete(usersByID, record.ID)
+		default:
+			return fmt.Errorf("unknown operation %q in user log %s", record.Operation, f.path)
+		}
+	}
+	for _, user := range usersByID {
+		f.InMemoryUserRepository.Add(user)
+	}
+	return nil
+}
+
+func (f *FileUserRepository) needsCompaction() bool {
+	return f.records >= minRecordsBeforeCompaction && f.records > 2*len(f.GetAll())
+}
+
+// compact writes all current users to a temporary file and atomically replaces the log with it.
+func (f *FileUserRepository) compact() error {
+	tempPath := f.path + ".tmp"
+	users := f.GetAll()
+	if err := writeUserRecords(tempPath, users); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err := os.Rename(tempPath, f.path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	f.records = len(users)
+	return nil
+}
+
+// writeUserRecords writes a record for every user to a new file at path.
+func writeUserRecords(path string, users []*User) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, user := range users {
+		if err := encoder.Encode(newPutUserRecord(user)); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (f *FileUserRepository) openForAppend() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	return nil
+}
+
+// append writes a single record to the log and compacts the log if necessary. A record that could not be written
+// completely is removed again. Once the record is written the change is persisted, so a failed compaction is only logged.
+func (f *FileUserRepository) append(record userRecord) error {
+	if f.file == nil {
+		return errors.New("user log is closed")
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	offset, err := f.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if err := f.writeLine(append(line, '\n')); err != nil {
+		f.truncate(offset)
+		return err
+	}
+	f.records++
+	if f.needsCompaction() {
+		if err := f.compactAndReopen(); err != nil {
+			slog.Error("failed to compact user log", "path", f.path, "err", err)
+		}
+	}
+	return nil
+}
+
+func (f *FileUserRepository) writeLine(line []byte) error {
+	if _, err := f.file.Write(line); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// truncate cuts the log off at offset. If that fails the log is closed, so that further changes fail instead of
+// following a partly written record that would make the log unreadable.
+func (f *FileUserRepository) truncate(offset int64) {
+	err := f.file.Truncate(offset)
+	if err == nil {
+		_, err = f.file.Seek(offset, io.SeekStart)
+	}
+	if err == nil {
+		return
+	}
+	slog.Error("failed to remove a partly written record from the user log, closing it", "path", f.path, "err", err)
+	if err := f.close(); err != nil {
+		slog.Warn("failed to close the user log", "path", f.path, "err", err)
+	}
+}
@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/benedictweis/tcpchat-server-go/test"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// failingUserLog writes only the first half of every line to the wrapped log and fails afterwards,
+// as a full disk does, or fails when syncing.
+type failingUserLog struct {
+	userLog
+	failSync     bool
+	failTruncate bool
+}
+
+func (l *failingUserLog) Write(line []byte) (int, error) {
+	if l.failSync {
+		return l.userLog.Write(line)
+	}
+	written, _ := l.userLog.Write(line[:len(line)/2])
+	return written, errors.New("no space left on device")
+}
+
+func (l *failingUserLog) Sync() error {
+	if l.failSync {
+		return errors.New("sync failed")
+	}
+	return l.userLog.Sync()
+}
+
+func (l *failingUserLog) Truncate(size int64) error {
+	if l.failTruncate {
+		return errors.New("truncate failed")
+	}
+	return l.userLog.Truncate(size)
+}
+
+var _ = Describe("FileUserRepository#append", func() {
+	var (
+		path           string
+		userRepository *FileUserRepository
+		failingLog     *failingUserLog
+		user           *User
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "users.log")
+		var err error
+		userRepository, err = NewFileUserRepository(path)
+		Expect(err).To(BeNil())
+		DeferCleanup(func() {
+			_ = userRepository.Close()
+		})
+		user, _ = NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+		Expect(userRepository.Add(user)).To(BeTrue())
+		failingLog = &failingUserLog{userLog: userRepository.file}
+		userRepository.file = failingLog
+	})
+
+	reopen := func() *FileUserRepository {
+		Expect(userRepository.Close()).To(Succeed())
+		reopenedUserRepository, err := NewFileUserRepository(path)
+		Expect(err).To(BeNil())
+		userRepository = reopenedUserRepository
+		return reopenedUserRepository
+	}
+
+	It("should remove a partly written record", func() {
+		otherUser, _ := NewUser(test.USER_NAME_B, test.USER_PASSWORD_B)
+		Expect(userRepository.Add(otherUser)).To(BeFalse())
+		userRepository.file = failingLog.userLog
+		Expect(userRepository.SetRole(user.ID, RoleAdmin)).To(BeTrue())
+
+		reopenedRepository := reopen()
+		Expect(reopenedRepository.GetAll()).To(HaveLen(1))
+		storedUser, _ := reopenedRepository.FindByID(user.ID)
+		Expect(storedUser.Role).To(Equal(RoleAdmin))
+	})
+
+	It("should remove a record that could not be synced", func() {
+		failingLog.failSync = true
+		otherUser, _ := NewUser(test.USER_NAME_B, test.USER_PASSWORD_B)
+		Expect(userRepository.Add(otherUser)).To(BeFalse())
+
+		reopenedRepository := reopen()
+		_, userExists := reopenedRepository.FindByID(otherUser.ID)
+		Expect(userExists).To(BeFalse())
+	})
+
+	It("should refuse further changes if the partly written record can not be removed", func() {
+		failingLog.failTruncate = true
+		otherUser, _ := NewUser(test.USER_NAME_B, test.USER_PASSWORD_B)
+		Expect(userRepository.Add(otherUser)).To(BeFalse())
+		Expect(userRepository.SetRole(user.ID, RoleAdmin)).To(BeFalse())
+		Expect(userRepository.file).To(BeNil())
+
+		reopenedRepository := reopen()
+		Expect(reopenedRepository.GetAll()).To(HaveLen(1))
+	})
+})
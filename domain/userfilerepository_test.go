@@ -0,0 +1,190 @@
+package domain_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/test"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileUserRepository", func() {
+	var (
+		path           string
+		userRepository *domain.FileUserRepository
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "users.log")
+		var err error
+		userRepository, err = domain.NewFileUserRepository(path)
+		Expect(err).To(BeNil())
+		DeferCleanup(func() {
+			_ = userRepository.Close()
+		})
+	})
+
+	reopen := func() *domain.FileUserRepository {
+		Expect(userRepository.Close()).To(Succeed())
+		reopenedUserRepository, err := domain.NewFileUserRepository(path)
+		Expect(err).To(BeNil())
+		userRepository = reopenedUserRepository
+		return reopenedUserRepository
+	}
+
+	Context("when adding a user and reopening the repository", func() {
+		It("should restore the user including its password", func() {
+			user, err := domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+			Expect(err).To(BeNil())
+			Expect(userRepository.Add(user)).To(BeTrue())
+
+			restoredUser, userExists := reopen().FindByName(test.USER_NAME_A)
+			Expect(userExists).To(BeTrue())
+			Expect(restoredUser.ID).To(Equal(user.ID))
+			Expect(restoredUser.PasswordIsValid(test.USER_PASSWORD_A)).To(BeTrue())
+		})
+	})
+
+	Context("when updating a user and reopening the repository", func() {
+		It("should restore the updated password", func() {
+			user, _ := domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+			userRepository.Add(user)
+			Expect(user.SetPassword(test.USER_PASSWORD_B)).To(Succeed())
+			Expect(userRepository.SetPasswordHash(user.ID, user.PasswordHash())).To(BeTrue())
+
+			restoredUser, userExists := reopen().FindByID(user.ID)
+			Expect(userExists).To(BeTrue())
+			Expect(restoredUser.PasswordIsValid(test.USER_PASSWORD_B)).To(BeTrue())
+		})
+	})
+
+	Context("when changing the role of a user and reopening the repository", func() {
+		It("should restore the role", func() {
+			user, _ := domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+			userRepository.Add(user)
+			Expect(userRepository.SetRole(user.ID, domain.RoleModerator)).To(BeTrue())
+
+			restoredUser, userExists := reopen().FindByID(user.ID)
+			Expect(userExists).To(BeTrue())
+			Expect(restoredUser.Role).To(Equal(domain.RoleModerator))
+		})
+	})
+
+	Context("when renaming a user and reopening the repository", func() {
+		It("should restore the user under the new name only", func() {
+			user, _ := domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+			userRepository.Add(user)
+			Expect(userRepository.Rename(user.ID, test.USER_NAME_B)).To(BeTrue())
+
+			reopenedRepository := reopen()
+			restoredUser, userExists := reopenedRepository.FindByName(test.USER_NAME_B)
+			Expect(userExists).To(BeTrue())
+			Expect(restoredUser.ID).To(Equal(user.ID))
+			_, userExists = reopenedRepository.FindByName(test.USER_NAME_A)
+			Expect(userExists).To(BeFalse())
+		})
+	})
+
+	Context("when deleting a user and reopening the repository", func() {
+		It("should not restore the user", func() {
+			user, _ := domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+			userRepository.Add(user)
+			_, userExisted := userRepository.Delete(test.USER_NAME_A)
+			Expect(userExisted).To(BeTrue())
+
+			_, userExists := reopen().FindByName(test.USER_NAME_A)
+			Expect(userExists).To(BeFalse())
+		})
+	})
+
+	Context("when the log contains mostly stale records", func() {
+		It("should compact the log", func() {
+			user, _ := domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+			userRepository.Add(user)
+			for range 100 {
+				Expect(userRepository.SetRole(user.ID, domain.RoleUser)).To(BeTrue())
+			}
+
+			content, err := os.ReadFile(path)
+			Expect(err).To(BeNil())
+			Expect(len(strings.Split(strings.TrimSpace(string(content)), "\n"))).To(BeNumerically("<", 64))
+			_, userExists := reopen().FindByID(user.ID)
+			Expect(userExists).To(BeTrue())
+		})
+	})
+
+	Context("when the log can not be compacted", func() {
+		It("should keep the changes that were written", func() {
+			Expect(os.Mkdir(path+".tmp", 0o700)).To(Succeed())
+			user, _ := domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+			Expect(userRepository.Add(user)).To(BeTrue())
+			for range 100 {
+				Expect(userRepository.SetRole(user.ID, domain.RoleUser)).To(BeTrue())
+			}
+			Expect(userRepository.SetRole(user.ID, domain.RoleModerator)).To(BeTrue())
+
+			restoredUser, userExists := reopen().FindByID(user.ID)
+			Expect(userExists).To(BeTrue())
+			Expect(restoredUser.Role).To(Equal(domain.RoleModerator))
+		})
+	})
+
+	Context("when the log is corrupt", func() {
+		It("should return an error", func() {
+			Expect(os.WriteFile(path, []byte("not json\n{\"op\":\"delete\",\"id\":\"1\"}\n"), 0o600)).To(Succeed())
+			_, err := domain.NewFileUserRepository(path)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when the last record of the log was cut off", func() {
+		It("should restore all other users and remove the torn record", func() {
+			user, _ := domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+			userRepository.Add(user)
+			Expect(userRepository.Close()).To(Succeed())
+			logFile, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+			Expect(err).To(BeNil())
+			_, err = logFile.WriteString(`{"op":"put","id":"torn","na`)
+			Expect(err).To(BeNil())
+			Expect(logFile.Close()).To(Succeed())
+
+			userRepository, err = domain.NewFileUserRepository(path)
+			Expect(err).To(BeNil())
+			_, userExists := userRepository.FindByID(user.ID)
+			Expect(userExists).To(BeTrue())
+			otherUser, _ := domain.NewUser(test.USER_NAME_B, test.USER_PASSWORD_B)
+			Expect(userRepository.Add(otherUser)).To(BeTrue())
+
+			reopenedRepository := reopen()
+			Expect(reopenedRepository.GetAll()).To(HaveLen(2))
+		})
+	})
+
+	Context("when a change can not be written to the log", func() {
+		var user *domain.User
+
+		BeforeEach(func() {
+			user, _ = domain.NewUser(test.USER_NAME_A, test.USER_PASSWORD_A)
+			userRepository.Add(user)
+			Expect(userRepository.Close()).To(Succeed())
+		})
+
+		It("should keep the stored user when changing it", func() {
+			Expect(userRepository.SetRole(user.ID, domain.RoleAdmin)).To(BeFalse())
+			Expect(userRepository.SetPasswordHash(user.ID, "")).To(BeFalse())
+			storedUser, _ := userRepository.FindByID(user.ID)
+			Expect(storedUser.Role).To(Equal(domain.RoleUser))
+			Expect(storedUser.PasswordIsValid(test.USER_PASSWORD_A)).To(BeTrue())
+		})
+
+		It("should keep the stored user when deleting", func() {
+			_, userExisted := userRepository.Delete(test.USER_NAME_A)
+			Expect(userExisted).To(BeFalse())
+			_, userExists := userRepository.FindByName(test.USER_NAME_A)
+			Expect(userExists).To(BeTrue())
+		})
+	})
+})
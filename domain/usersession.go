@@ -5,13 +5,57 @@
 
 package domain
 
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SessionLimitPolicy determines what happens when a user logs in on more sessions than allowed.
+type SessionLimitPolicy int
+
+const (
+	// SessionLimitReject rejects the new login.
+	SessionLimitReject SessionLimitPolicy = iota
+	// SessionLimitReplaceOldest closes the sessions the user logged in on first to make room for the new one.
+	SessionLimitReplaceOldest
+)
+
+// SessionLimitPolicyFromString is used to match the string variant of a policy, the second result is false if the policy is unknown.
+func SessionLimitPolicyFromString(s string) (SessionLimitPolicy, bool) {
+	for policy := SessionLimitReject; policy <= SessionLimitReplaceOldest; policy++ {
+		if policy.String() == s {
+			return policy, true
+		}
+	}
+	return SessionLimitReject, false
+}
+
+// String implements the string variants of SessionLimitPolicy.
+func (s SessionLimitPolicy) String() string {
+	sessionLimitPolicyToStringMapping := []string{"reject", "replace-oldest"}
+	if s < 0 || int(s) > len(sessionLimitPolicyToStringMapping)-1 {
+		return strconv.Itoa(int(s))
+	}
+	return sessionLimitPolicyToStringMapping[s]
+}
+
 type UserSession struct {
-	UserID    string
-	SessionID string
+	UserID     string
+	SessionID  string
+	LoggedInAt time.Time
 }
 
 func NewUserSession(userID string, sessionID string) *UserSession {
-	return &UserSession{userID, sessionID}
+	return &UserSession{UserID: userID, SessionID: sessionID, LoggedInAt: time.Now()}
+}
+
+// OldestUserSessions returns the count user sessions that were logged in first.
+func OldestUserSessions(userSessions []*UserSession, count int) []*UserSession {
+	oldest := append([]*UserSession(nil), userSessions...)
+	sort.SliceStable(oldest, func(a, b int) bool { return oldest[a].LoggedInAt.Before(oldest[b].LoggedInAt) })
+	return oldest[:min(max(count, 0), len(oldest))]
 }
 
 type UserSessionRepository interface {
@@ -24,6 +68,7 @@ type UserSessionRepository interface {
 }
 
 type InMemoryUserSessionRepository struct {
+	mutex        sync.RWMutex
 	userSessions map[string]*UserSession
 }
 
@@ -32,10 +77,14 @@ func NewInMemoryUserSessionRepository() *InMemoryUserSessionRepository {
 }
 
 func (i *InMemoryUserSessionRepository) Add(session *UserSession) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
 	i.userSessions[session.SessionID] = session
 }
 
 func (i *InMemoryUserSessionRepository) GetAll() []*UserSession {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
 	allUserSessions := make([]*UserSession, 0, len(i.userSessions))
 	for _, userSession := range i.userSessions {
 		allUserSessions = append(allUserSessions, userSession)
@@ -44,11 +93,19 @@ func (i *InMemoryUserSessionRepository) GetAll() []*UserSession {
 }
 
 func (i *InMemoryUserSessionRepository) FindBySessionID(sessionID string) (userSession *UserSession, ok bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
 	userSession, ok = i.userSessions[sessionID]
 	return
 }
 
 func (i *InMemoryUserSessionRepository) FindByUserID(userID string) []*UserSession {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.findByUserID(userID)
+}
+
+func (i *InMemoryUserSessionRepository) findByUserID(userID string) []*UserSession {
 	userSessions := make([]*UserSession, 0)
 	for _, userSession := range i.userSessions {
 		if userSession.UserID == userID {
@@ -59,6 +116,8 @@ func (i *InMemoryUserSessionRepository) FindByUserID(userID string) []*UserSessi
 }
 
 func (i *InMemoryUserSessionRepository) DeleteBySessionID(sessionID string) (userSession *UserSession, ok bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
 	if userSession, ok = i.userSessions[sessionID]; !ok {
 		return
 	}
@@ -67,9 +126,11 @@ func (i *InMemoryUserSessionRepository) DeleteBySessionID(sessionID string) (use
 }
 
 func (i *InMemoryUserSessionRepository) DeleteByUserID(userID string) []*UserSession {
-	userSessions := i.FindByUserID(userID)
-	for _, userSession := range i.userSessions {
-		_, _ = i.DeleteBySessionID(userSession.SessionID)
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	userSessions := i.findByUserID(userID)
+	for _, userSession := range userSessions {
+		delete(i.userSessions, userSession.SessionID)
 	}
 	return userSessions
 }
@@ -7,17 +7,46 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 
+	"github.com/benedictweis/tcpchat-server-go/config"
+	"github.com/benedictweis/tcpchat-server-go/domain"
 	"github.com/benedictweis/tcpchat-server-go/plugin"
 )
 
 func main() {
-	setupLogging()
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %s\n", err)
+		os.Exit(2)
+	}
+	setupLogging(cfg.Log)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	tcpChatServer, err := plugin.NewTCPChatServer("localhost", 8080)
+	err = domain.SetPasswordCost(cfg.BcryptCost)
+	if err != nil {
+		slog.Error("failed to set password cost", "err", err)
+		return
+	}
+	userRepository, closeUserRepository, err := setupUserRepository(cfg.UsersFile)
+	if err != nil {
+		slog.Error("failed to initialize user repository", "err", err)
+		return
+	}
+	defer closeUserRepository()
+	banRepository, err := setupBanRepository(cfg.BansFile)
+	if err != nil {
+		slog.Error("failed to initialize ban repository", "err", err)
+		return
+	}
+	tcpChatServer, err := plugin.NewTCPChatServer(cfg, userRepository, banRepository)
 	if err != nil {
 		slog.Error("failed to initialize tcp chat plugin", "err", err)
 		return
@@ -29,7 +58,44 @@ func main() {
 	}
 }
 
-func setupLogging() {
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	slog.SetDefault(logger)
+func setupLogging(logConfig config.LogConfig) {
+	var level slog.Level
+	// The level was already validated when loading the config.
+	_ = level.UnmarshalText([]byte(logConfig.Level))
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stdout, options)
+	if logConfig.Format == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// setupUserRepository creates a file backed user repository if a path is given and an in memory one otherwise.
+func setupUserRepository(usersFile string) (domain.UserRepository, func(), error) {
+	if usersFile == "" {
+		return domain.NewInMemoryUserRepository(), func() {}, nil
+	}
+	fileUserRepository, err := domain.NewFileUserRepository(usersFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.Info("persisting users", "usersFile", usersFile)
+	return fileUserRepository, func() {
+		if err := fileUserRepository.Close(); err != nil {
+			slog.Error("failed to close user repository", "err", err)
+		}
+	}, nil
+}
+
+// setupBanRepository creates a file backed ban repository if a path is given and an in memory one otherwise.
+func setupBanRepository(bansFile string) (domain.BanRepository, error) {
+	if bansFile == "" {
+		return domain.NewInMemoryBanRepository(), nil
+	}
+	fileBanRepository, err := domain.NewFileBanRepository(bansFile)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("persisting bans", "bansFile", bansFile)
+	return fileBanRepository, nil
 }
@@ -0,0 +1,174 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package plugin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/application"
+)
+
+// maxAdminRequestSize is the maximum size of a request body sent to the admin api.
+const maxAdminRequestSize = 64 * 1024
+
+type adminSession struct {
+	ID         string `json:"id"`
+	RemoteAddr string `json:"remoteAddr"`
+	UserName   string `json:"userName,omitempty"`
+	Room       string `json:"room"`
+}
+
+type adminUser struct {
+	Name        string     `json:"name"`
+	Role        string     `json:"role"`
+	LoggedIn    bool       `json:"loggedIn"`
+	LockedUntil *time.Time `json:"lockedUntil,omitempty"`
+}
+
+type adminPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+type adminAnnouncementRequest struct {
+	Message string `json:"message"`
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// serveAdminAPI serves the admin api on listener until ctx is Done, every request has to carry token as a bearer token.
+func serveAdminAPI(ctx context.Context, listener net.Listener, token string, chatService *application.BasicChatService) {
+	server := &http.Server{Handler: newAdminHandler(token, chatService), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	err := server.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("admin api stopped", "err", err)
+	}
+}
+
+func newAdminHandler(token string, chatService *application.BasicChatService) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		sessions := make([]adminSession, 0)
+		for _, session := range chatService.ListSessions() {
+			sessions = append(sessions, adminSession{ID: session.ID, RemoteAddr: session.RemoteAddr, UserName: session.UserName, Room: session.RoomName})
+		}
+		writeAdminResponse(w, http.StatusOK, sessions)
+	})
+	mux.HandleFunc("DELETE /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminResult(w, chatService.DisconnectSession(r.PathValue("id")))
+	})
+	mux.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {
+		users := make([]adminUser, 0)
+		for _, user := range chatService.ListUsers() {
+			adminUser := adminUser{Name: user.Name, Role: user.Role.String(), LoggedIn: user.LoggedIn}
+			if !user.LockedUntil.IsZero() {
+				adminUser.LockedUntil = &user.LockedUntil
+			}
+			users = append(users, adminUser)
+		}
+		writeAdminResponse(w, http.StatusOK, users)
+	})
+	mux.HandleFunc("DELETE /users/{name}", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminResult(w, chatService.DeleteUser(r.PathValue("name")))
+	})
+	mux.HandleFunc("DELETE /users/{name}/lockout", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminResult(w, chatService.UnlockUser(r.PathValue("name")))
+	})
+	mux.HandleFunc("DELETE /hosts/{host}/lockout", func(w http.ResponseWriter, r *http.Request) {
+		chatService.UnlockHost(r.PathValue("host"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("PUT /users/{name}/password", func(w http.ResponseWriter, r *http.Request) {
+		var request adminPasswordRequest
+		if !readAdminRequest(w, r, &request) {
+			return
+		}
+		if request.Password == "" {
+			writeAdminResponse(w, http.StatusBadRequest, adminError{"password must not be empty"})
+			return
+		}
+		writeAdminResult(w, chatService.ResetPassword(r.PathValue("name"), request.Password))
+	})
+	mux.HandleFunc("POST /announcements", func(w http.ResponseWriter, r *http.Request) {
+		var request adminAnnouncementRequest
+		if !readAdminRequest(w, r, &request) {
+			return
+		}
+		if strings.TrimSpace(request.Message) == "" {
+			writeAdminResponse(w, http.StatusBadRequest, adminError{"message must not be empty"})
+			return
+		}
+		chatService.Broadcast(request.Message)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return requireAdminToken(token, mux)
+}
+
+// requireAdminToken rejects all requests that do not carry token as a bearer token.
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestToken, isBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !isBearer || subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) != 1 {
+			slog.Warn("rejected admin api request", "remoteAddr", r.RemoteAddr, "method", r.Method, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAdminResponse(w, http.StatusUnauthorized, adminError{"invalid or missing token"})
+			return
+		}
+		slog.Info("admin api request", "remoteAddr", r.RemoteAddr, "method", r.Method, "path", r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readAdminRequest decodes the json body of r into request, a bad request is answered if it can not be decoded.
+func readAdminRequest(w http.ResponseWriter, r *http.Request, request any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		writeAdminResponse(w, http.StatusBadRequest, adminError{"invalid request body: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// writeAdminResult answers with no content if err is nil and with the matching error status otherwise.
+func writeAdminResult(w http.ResponseWriter, err error) {
+	if err == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var userFriendlyError application.UserFriendlyError
+	if !errors.As(err, &userFriendlyError) {
+		slog.Error("admin api request failed", "err", err)
+		writeAdminResponse(w, http.StatusInternalServerError, adminError{"internal error"})
+		return
+	}
+	status := http.StatusBadRequest
+	if errors.As(err, new(*application.ErrUserDoesNotExist)) || errors.As(err, new(*application.ErrSessionDoesNotExist)) {
+		status = http.StatusNotFound
+	}
+	writeAdminResponse(w, status, adminError{userFriendlyError.UserFriendlyError()})
+}
+
+func writeAdminResponse(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Warn("failed to write admin api response", "err", err)
+	}
+}
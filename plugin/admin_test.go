@@ -0,0 +1,136 @@
+package plugin_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin API", func() {
+	const token = "0123456789abcdef"
+
+	var (
+		port      int
+		adminPort int
+	)
+
+	BeforeEach(func() {
+		port = freePort()
+		adminPort = freePort()
+		cfg := serverConfig(port)
+		cfg.Admin.Address = fmt.Sprintf("127.0.0.1:%d", adminPort)
+		cfg.Admin.Token = token
+		server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+		waitUntilListening(adminPort)
+	})
+
+	request := func(method, path, requestToken, body string) (int, string) {
+		httpRequest, err := http.NewRequest(method, fmt.Sprintf("http://127.0.0.1:%d%s", adminPort, path), strings.NewReader(body))
+		Expect(err).To(BeNil())
+		httpRequest.Header.Set("Authorization", "Bearer "+requestToken)
+		response, err := http.DefaultClient.Do(httpRequest)
+		Expect(err).To(BeNil())
+		defer response.Body.Close()
+		responseBody, err := io.ReadAll(response.Body)
+		Expect(err).To(BeNil())
+		return response.StatusCode, string(responseBody)
+	}
+
+	It("should reject requests without the token", func() {
+		status, body := request(http.MethodGet, "/users", "wrong", "")
+		Expect(status).To(Equal(http.StatusUnauthorized))
+		Expect(body).To(ContainSubstring("invalid or missing token"))
+	})
+
+	It("should list sessions and users", func() {
+		login(port, "alice")
+
+		status, body := request(http.MethodGet, "/users", token, "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(MatchJSON(`[{"name":"alice","role":"user","loggedIn":true}]`))
+
+		status, body = request(http.MethodGet, "/sessions", token, "")
+		Expect(status).To(Equal(http.StatusOK))
+		var sessions []map[string]string
+		Expect(json.Unmarshal([]byte(body), &sessions)).To(Succeed())
+		Expect(sessions).To(ContainElement(And(HaveKeyWithValue("userName", "alice"), HaveKeyWithValue("room", "lobby"), HaveKeyWithValue("remoteAddr", HavePrefix("127.0.0.1:")))))
+	})
+
+	It("should broadcast announcements and disconnect sessions", func() {
+		_, reader := login(port, "alice")
+
+		status, _ := request(http.MethodPost, "/announcements", token, `{"message":"maintenance at noon"}`)
+		Expect(status).To(Equal(http.StatusNoContent))
+		Expect(readLineContaining(reader, "maintenance")).To(Equal("[server] Announcement: maintenance at noon\n"))
+
+		_, body := request(http.MethodGet, "/sessions", token, "")
+		var sessions []map[string]string
+		Expect(json.Unmarshal([]byte(body), &sessions)).To(Succeed())
+		for _, session := range sessions {
+			if session["userName"] == "alice" {
+				status, _ = request(http.MethodDelete, "/sessions/"+session["id"], token, "")
+				Expect(status).To(Equal(http.StatusNoContent))
+			}
+		}
+		Expect(readLineContaining(reader, "disconnected")).To(Equal("[server] You were disconnected by an administrator\n"))
+
+		status, _ = request(http.MethodDelete, "/sessions/unknown", token, "")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+
+	It("should reset passwords and delete accounts", func() {
+		connection, reader := login(port, "alice")
+
+		status, _ := request(http.MethodPut, "/users/alice/password", token, `{"password":"changed-pw1"}`)
+		Expect(status).To(Equal(http.StatusNoContent))
+		send(connection, "/logout", "/login alice "+testPassword)
+		Expect(readLineContaining(reader, "password")).To(ContainSubstring("wrong password"))
+		send(connection, "/login alice changed-pw1")
+		readLineContaining(reader, "Logged in")
+
+		status, _ = request(http.MethodDelete, "/users/alice", token, "")
+		Expect(status).To(Equal(http.StatusNoContent))
+		Expect(readLineContaining(reader, "deleted")).To(Equal("[server] Your account was deleted by an administrator\n"))
+		status, body := request(http.MethodGet, "/users", token, "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(MatchJSON(`[]`))
+
+		status, _ = request(http.MethodPut, "/users/alice/password", token, `{"password":"changed-pw1"}`)
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+
+	It("should lock out repeated failed logins until they are unlocked", func() {
+		connection, reader := login(port, "alice")
+		send(connection, "/logout")
+		for range 2 {
+			send(connection, "/login alice wrong")
+			readLineContaining(reader, "wrong password")
+		}
+		send(connection, "/login alice "+testPassword)
+		Expect(readLineContaining(reader, "failed logins")).To(HavePrefix("[server] too many failed logins, try again in "))
+
+		_, body := request(http.MethodGet, "/users", token, "")
+		var users []map[string]any
+		Expect(json.Unmarshal([]byte(body), &users)).To(Succeed())
+		Expect(users).To(ConsistOf(HaveKey("lockedUntil")))
+
+		status, _ := request(http.MethodDelete, "/users/alice/lockout", token, "")
+		Expect(status).To(Equal(http.StatusNoContent))
+		status, _ = request(http.MethodDelete, "/hosts/127.0.0.1/lockout", token, "")
+		Expect(status).To(Equal(http.StatusNoContent))
+		send(connection, "/login alice "+testPassword)
+		readLineContaining(reader, "Logged in")
+
+		status, _ = request(http.MethodDelete, "/users/bob/lockout", token, "")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,44 @@
+package plugin_test
+
+import (
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Command arguments", func() {
+	var port int
+
+	BeforeEach(func() {
+		port = freePort()
+		server, err := plugin.NewTCPChatServer(serverConfig(port), domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+	})
+
+	It("should accept quoted passwords containing spaces", func() {
+		_, reader := connect(port, `/acc alice "correct horse battery"`, `/login alice 'correct horse battery'`)
+		readLineContaining(reader, "Logged in")
+	})
+
+	It("should keep the whitespace of private messages", func() {
+		_, aliceReader := login(port, "alice")
+		_, bobReader := connect(port, "/acc bob "+testPassword, "/login bob "+testPassword, `/msg alice  two  spaces "and quotes"`)
+		readLineContaining(bobReader, "Logged in")
+		Expect(readLineContaining(aliceReader, "[p bob]")).To(Equal(`[p bob] two  spaces "and quotes"` + "\n"))
+	})
+
+	DescribeTable("Rejecting commands that can not be parsed",
+		func(line, expectedReply string) {
+			connection, reader := connect(port, line)
+			Expect(readLineContaining(reader, expectedReply)).To(HavePrefix("[server] "))
+			send(connection, "/info")
+			readLineContaining(reader, "sessionID")
+		},
+		Entry("When given an unterminated quote", `/login alice "s3cret`, "Invalid arguments, unterminated quote, usage: /login <username> <password>"),
+		Entry("When given a dangling backslash", `/acc alice s3cret\`, "Invalid arguments, backslash at the end of the arguments"),
+		Entry("When given only a slash", "/", "Unknown command"),
+		Entry("When given a slash followed by whitespace", "/   ", "Unknown command"),
+	)
+})
@@ -7,23 +7,36 @@ package plugin
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/benedictweis/tcpchat-server-go/application"
+	"github.com/benedictweis/tcpchat-server-go/config"
 	"github.com/benedictweis/tcpchat-server-go/domain"
 )
 
+// flushTimeout is the time waited for the queued messages of a closed session to be written.
+const flushTimeout = time.Second
+
 // ConnectionResult is used to couple a possible error when accepting a connection with its result.
 type ConnectionResult struct {
 	connection net.Conn
 	err        error
 }
 
-// handleConnections is used to couple a possible error when accepting a connection with its result.
-func handleConnections(ctx context.Context, listener net.Listener, activeConnections *sync.WaitGroup, messagesRead chan<- application.MessageResult, sessions chan<- domain.Session) {
-	connections := generateConnections(ctx, listener)
+// handleConnections accepts connections on listener and handles every connection using the plain text protocol.
+func handleConnections(ctx context.Context, listener net.Listener, cfg config.Config, activeConnections *sync.WaitGroup, metrics *serverMetrics, floodControl floodControl, messagesRead chan<- application.MessageResult, sessions chan<- domain.Session, textMessages chan<- domain.TextMessage, commands chan<- domain.Command) {
+	acceptConnections(ctx, listener, cfg.Buffers.AcceptedConnections, func(connection net.Conn) {
+		handleConnection(ctx, connection, cfg, activeConnections, metrics, floodControl, sessions, messagesRead, textMessages, commands)
+	})
+}
+
+// acceptConnections accepts connections on listener until ctx is Done, every connection is handled in its own goroutine.
+func acceptConnections(ctx context.Context, listener net.Listener, bufferSize int, handle func(net.Conn)) {
+	connections := generateConnections(ctx, listener, bufferSize)
 	for {
 		select {
 		case <-ctx.Done():
@@ -33,14 +46,14 @@ func handleConnections(ctx context.Context, listener net.Listener, activeConnect
 				slog.Error("error accepting connection", "err", connectionResult.err)
 				continue
 			}
-			go handleConnection(ctx, connectionResult.connection, activeConnections, sessions, messagesRead)
+			go handle(connectionResult.connection)
 		}
 	}
 }
 
 // generateConnections is used to accept incoming connections and send them on to a channel.
-func generateConnections(ctx context.Context, listener net.Listener) <-chan ConnectionResult {
-	connections := make(chan ConnectionResult, 5) // Buffer of 5 to allow minor burst handling
+func generateConnections(ctx context.Context, listener net.Listener, bufferSize int) <-chan ConnectionResult {
+	connections := make(chan ConnectionResult, bufferSize) // Buffer to allow minor burst handling
 
 	go func() {
 		defer close(connections)
@@ -57,11 +70,30 @@ func generateConnections(ctx context.Context, listener net.Listener) <-chan Conn
 	return connections
 }
 
-// handleConnection handles a single connection along with reading to and writing from the connection.
-func handleConnection(ctx context.Context, connection net.Conn, activeConnections *sync.WaitGroup, sessions chan<- domain.Session, readMessages chan<- application.MessageResult) {
-	messagesToSession := make(chan string)
-	closeSession := make(chan interface{})
-	session := domain.NewSession(messagesToSession, closeSession)
+// handleConnection handles a single connection using the plain text protocol, unless the client requests the json
+// protocol with its first line.
+func handleConnection(ctx context.Context, connection net.Conn, cfg config.Config, activeConnections *sync.WaitGroup, metrics *serverMetrics, floodControl floodControl, sessions chan<- domain.Session, readMessages chan<- application.MessageResult, textMessages chan<- domain.TextMessage, commands chan<- domain.Command) {
+	serveConnection(ctx, connection, cfg, activeConnections, metrics, sessions, func(ctx context.Context, session domain.Session, connection net.Conn) (io.Writer, func(domain.OutgoingMessage) string) {
+		protocol := &negotiatedProtocol{}
+		go handleRead(ctx, connection, cfg.Limits.MaxLineLength, session, protocol, floodControl, readMessages, textMessages, commands)
+		return connection, protocol.render
+	})
+}
+
+// serveConnection creates a session for connection and calls serve to start reading from the connection, messages to
+// the session are written to the writer returned by serve using its render function. Reads and writes passed to serve
+// are subject to the idle and write timeouts of cfg. The connection is closed once ctx is Done or the session is
+// closed, in the latter case the messages still queued for the session are written first.
+func serveConnection(ctx context.Context, connection net.Conn, cfg config.Config, activeConnections *sync.WaitGroup, metrics *serverMetrics, sessions chan<- domain.Session, serve func(ctx context.Context, session domain.Session, connection net.Conn) (io.Writer, func(domain.OutgoingMessage) string)) {
+	// The policy was already validated when loading the config.
+	overflowPolicy, _ := domain.OverflowPolicyFromString(cfg.Delivery.OverflowPolicy)
+	outgoing := domain.NewOutgoingQueue(cfg.Delivery.QueueSize, overflowPolicy, cfg.Delivery.BlockTimeout)
+	// Closing the session must not block the chat service if the connection is already being closed.
+	closeSession := make(chan interface{}, 1)
+	session := domain.NewSession(connection.RemoteAddr().String(), outgoing, closeSession)
+	connection = newTimeoutConnection(connection, cfg.Connections, metrics, func(message string) {
+		outgoing.Push(domain.NewServerOutgoingMessage(message))
+	})
 	slog.Info("new connection established", "sessionID", session.ID, "remoteAddr", connection.RemoteAddr())
 	defer func() {
 		slog.Info("closing session", "sessionID", session.ID, "remoteAddr", connection.RemoteAddr())
@@ -75,11 +107,21 @@ func handleConnection(ctx context.Context, connection net.Conn, activeConnection
 	localCtx, closeLocalCtx := context.WithCancel(ctx)
 	defer closeLocalCtx()
 
-	go handleRead(localCtx, connection, readMessages, session.ID)
-	go handleWrite(localCtx, connection, messagesToSession)
+	writer, render := serve(localCtx, *session, connection)
+	flush := make(chan struct{})
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		handleWrite(localCtx, writer, outgoing.Messages(), render, metrics, flush)
+	}()
 
 	select {
 	case <-ctx.Done():
 	case <-closeSession:
+		close(flush)
+		select {
+		case <-written:
+		case <-time.After(flushTimeout):
+		}
 	}
 }
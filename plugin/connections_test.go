@@ -0,0 +1,102 @@
+package plugin_test
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/config"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connections", func() {
+	var port int
+
+	BeforeEach(func() {
+		port = freePort()
+	})
+
+	start := func(cfg config.Config) {
+		server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+	}
+
+	It("should close connections exceeding the connections per host", func() {
+		cfg := serverConfig(port)
+		cfg.Connections.MaxPerHost = 2
+		start(cfg)
+		first, firstReader := connect(port)
+		readLineContaining(firstReader, "Welcome")
+		_, secondReader := connect(port)
+		readLineContaining(secondReader, "Welcome")
+
+		_, rejectedReader := connect(port)
+		_, err := rejectedReader.ReadString('\n')
+		Expect(err).To(MatchError(io.EOF))
+
+		Expect(first.Close()).To(Succeed())
+		Eventually(func() string {
+			_, reader := connect(port)
+			line, _ := reader.ReadString('\n')
+			return line
+		}).Should(ContainSubstring("Welcome"))
+	})
+
+	It("should warn and disconnect idle connections", func() {
+		cfg := serverConfig(port)
+		cfg.Connections.IdleTimeout = 400 * time.Millisecond
+		cfg.Connections.IdleWarning = 200 * time.Millisecond
+		start(cfg)
+		_, reader := connect(port)
+		readLineContaining(reader, "[server] You will be disconnected in 200ms for being idle")
+		readLineContaining(reader, "[server] You were disconnected for being idle")
+		_, err := io.ReadAll(reader)
+		Expect(err).To(BeNil())
+	})
+
+	It("should not disconnect connections that keep sending", func() {
+		cfg := serverConfig(port)
+		cfg.Connections.IdleTimeout = 400 * time.Millisecond
+		cfg.Connections.IdleWarning = 200 * time.Millisecond
+		start(cfg)
+		connection, reader := connect(port)
+		for range 8 {
+			time.Sleep(100 * time.Millisecond)
+			send(connection, "/help")
+		}
+		Expect(connection.SetReadDeadline(time.Now().Add(50 * time.Millisecond))).To(Succeed())
+		output, _ := io.ReadAll(reader)
+		Expect(string(output)).To(ContainSubstring("/help"))
+		Expect(string(output)).NotTo(ContainSubstring("for being idle"))
+	})
+
+	It("should disconnect idle websocket connections", func() {
+		webSocketPort := freePort()
+		cfg := serverConfig(port)
+		cfg.WebSocket.Address = fmt.Sprintf("127.0.0.1:%d", webSocketPort)
+		cfg.Connections.IdleTimeout = 400 * time.Millisecond
+		cfg.Connections.IdleWarning = 200 * time.Millisecond
+		start(cfg)
+		waitUntilListening(webSocketPort)
+		connection, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://127.0.0.1:%d/", webSocketPort), nil)
+		Expect(err).To(BeNil())
+		DeferCleanup(connection.Close)
+		Expect(connection.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+		messages := make([]string, 0)
+		for {
+			_, message, err := connection.ReadMessage()
+			if err != nil {
+				Expect(websocket.IsCloseError(err, websocket.CloseNormalClosure)).To(BeTrue())
+				break
+			}
+			messages = append(messages, string(message))
+		}
+		Expect(strings.Join(messages, "\n")).To(ContainSubstring("[server] You will be disconnected in 200ms for being idle\n[server] You were disconnected for being idle"))
+	})
+})
@@ -0,0 +1,84 @@
+package plugin_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/config"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Flood control", func() {
+	var port int
+	var cfg config.Config
+
+	BeforeEach(func() {
+		port = freePort()
+		cfg = serverConfig(port)
+		cfg.Flood = config.FloodConfig{
+			Session:         config.RateLimitConfig{Burst: 3, Refill: 100 * time.Millisecond},
+			MuteAfter:       3,
+			MuteDuration:    time.Minute,
+			DisconnectAfter: 6,
+			ForgiveAfter:    time.Minute,
+		}
+	})
+
+	start := func() {
+		server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+	}
+
+	// loginWithFullBucket logs in and waits for the bucket to be full again.
+	loginWithFullBucket := func(name string) (net.Conn, *bufio.Reader) {
+		connection, reader := login(port, name)
+		time.Sleep(300 * time.Millisecond)
+		return connection, reader
+	}
+
+	flood := func(connection net.Conn, lines int) {
+		messages := make([]string, 0, lines)
+		for index := range lines {
+			messages = append(messages, fmt.Sprintf("flood %d", index))
+		}
+		send(connection, messages...)
+	}
+
+	It("should warn, mute and disconnect a flooding session without affecting others", func() {
+		start()
+		_, bobReader := loginWithFullBucket("bob")
+		alice, aliceReader := loginWithFullBucket("alice")
+
+		flood(alice, 20)
+		readLineContaining(aliceReader, "[server] You are sending messages too fast, your messages are slowed down")
+		readLineContaining(aliceReader, "[server] You are muted for 1m0s for flooding, your messages are dropped")
+		readLineContaining(aliceReader, "[server] You were disconnected for flooding")
+		_, err := io.ReadAll(aliceReader)
+		Expect(err).To(BeNil())
+
+		Expect(readLineContaining(bobReader, "[alice]")).To(HaveSuffix("flood 0\n"))
+		Expect(readLineContaining(bobReader, "[alice]")).To(HaveSuffix("flood 1\n"))
+		Expect(readLineContaining(bobReader, "[alice]")).To(HaveSuffix("flood 2\n"))
+		readLineContaining(bobReader, "alice left")
+	})
+
+	It("should share the limit of a user across its sessions", func() {
+		cfg.Flood.Session = config.RateLimitConfig{}
+		cfg.Flood.User = config.RateLimitConfig{Burst: 3, Refill: 100 * time.Millisecond}
+		start()
+		first, _ := loginWithFullBucket("alice")
+		second, secondReader := loginWithFullBucket("alice")
+
+		flood(first, 3)
+		time.Sleep(50 * time.Millisecond)
+		flood(second, 1)
+		readLineContaining(secondReader, "[server] You are sending messages too fast, your messages are slowed down")
+	})
+})
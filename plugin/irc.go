@@ -0,0 +1,449 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/application"
+	"github.com/benedictweis/tcpchat-server-go/config"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
+
+// ircMinimumParams is the number of parameters an irc command needs at least.
+var ircMinimumParams = map[string]int{
+	"PASS":    1,
+	"NICK":    1,
+	"USER":    1,
+	"PRIVMSG": 2,
+	"JOIN":    1,
+	"PART":    1,
+}
+
+// handleIRCConnections accepts irc connections on listener, messages of irc clients are translated to commands and
+// text messages that are sent directly to the chat service.
+func handleIRCConnections(ctx context.Context, listener net.Listener, cfg config.Config, activeConnections *sync.WaitGroup, metrics *serverMetrics, floodControl floodControl, sessions chan<- domain.Session, textMessages chan<- domain.TextMessage, commands chan<- domain.Command) {
+	acceptConnections(ctx, listener, cfg.Buffers.AcceptedConnections, func(connection net.Conn) {
+		serveConnection(ctx, connection, cfg, activeConnections, metrics, sessions, func(ctx context.Context, session domain.Session, connection net.Conn) (io.Writer, func(domain.OutgoingMessage) string) {
+			client := newIRCClient(session.ID, cfg.IRC.ServerName, connection, textMessages, commands)
+			go client.handleRead(ctx, connection, cfg.Limits.MaxLineLength, floodControl)
+			return client.writer, client.render
+		})
+	})
+}
+
+// ircMessage is a single message sent by an irc client, a trailing parameter is the last of params.
+type ircMessage struct {
+	command string
+	params  []string
+}
+
+// parseIRCMessage parses a single irc line, the prefix of the line is ignored.
+func parseIRCMessage(line string) (message ircMessage, ok bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, ":") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+	line, trailing, hasTrailing := strings.Cut(line, " :")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ircMessage{}, false
+	}
+	params := fields[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+	return ircMessage{command: strings.ToUpper(fields[0]), params: params}, true
+}
+
+// ircClient holds the state of a single irc connection. The nick of the client is used as the user name when logging in
+// using PASS and the current channel is the room the session is in.
+type ircClient struct {
+	sessionID    string
+	serverName   string
+	writer       *lockedWriter
+	textMessages chan<- domain.TextMessage
+	commands     chan<- domain.Command
+
+	mutex        sync.Mutex
+	nick         string
+	password     string
+	userReceived bool
+	registered   bool
+	channel      string
+	// pendingNicks holds the nicks requested by NICK until the server replied to the request with the id.
+	pendingNicks map[string]string
+	requestIDs   uint64
+}
+
+func newIRCClient(sessionID, serverName string, writer io.Writer, textMessages chan<- domain.TextMessage, commands chan<- domain.Command) *ircClient {
+	return &ircClient{
+		sessionID:    sessionID,
+		serverName:   serverName,
+		writer:       &lockedWriter{writer: writer},
+		textMessages: textMessages,
+		commands:     commands,
+		pendingNicks: make(map[string]string),
+	}
+}
+
+// handleRead reads irc lines from reader and handles them until the client quits or reading fails,
+// lines exceeding the rate limits are held back or dropped by floodControl.
+func (c *ircClient) handleRead(ctx context.Context, reader io.Reader, maxLineLength int, floodControl floodControl) {
+	bufioReader := bufio.NewReader(reader)
+	for {
+		line, err := readLine(bufioReader, maxLineLength)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, errIdleTimeout) {
+				slog.Warn("irc read error", "sessionID", c.sessionID, "err", err)
+			}
+			c.sendCommand(ctx, domain.Quit)
+			return
+		}
+		if !admitLine(ctx, floodControl, c.sessionID) {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		message, ok := parseIRCMessage(line)
+		if !ok {
+			continue
+		}
+		slog.Debug("incoming irc message", "sessionID", c.sessionID, "command", message.command, "params", message.params)
+		if quit := c.handleMessage(ctx, message); quit {
+			return
+		}
+	}
+}
+
+// handleMessage translates a single irc message, it reports whether the client quit.
+func (c *ircClient) handleMessage(ctx context.Context, message ircMessage) (quit bool) {
+	if len(message.params) < ircMinimumParams[message.command] {
+		c.reply("461", message.command+" :Not enough parameters")
+		return false
+	}
+	switch message.command {
+	case "CAP":
+		if len(message.params) > 0 && strings.ToUpper(message.params[0]) == "LS" {
+			c.write(":%s CAP * LS :", c.serverName)
+		}
+	case "PING":
+		token := c.serverName
+		if len(message.params) > 0 {
+			token = message.params[0]
+		}
+		c.write(":%s PONG %s :%s", c.serverName, c.serverName, token)
+	case "PONG":
+	case "QUIT":
+		c.sendCommand(ctx, domain.Quit)
+		return true
+	case "PASS":
+		c.mutex.Lock()
+		c.password = message.params[0]
+		c.mutex.Unlock()
+	case "NICK":
+		c.changeNick(ctx, message.params[0])
+	case "USER":
+		c.mutex.Lock()
+		c.userReceived = true
+		c.mutex.Unlock()
+		c.register(ctx)
+	default:
+		if !c.isRegistered() {
+			c.reply("451", ":You have not registered")
+			return false
+		}
+		c.handleRegisteredMessage(ctx, message)
+	}
+	return false
+}
+
+// handleRegisteredMessage translates messages that are only allowed after the client registered.
+func (c *ircClient) handleRegisteredMessage(ctx context.Context, message ircMessage) {
+	switch message.command {
+	case "PRIVMSG":
+		c.privateMessage(ctx, message.params[0], message.params[1])
+	case "JOIN":
+		c.join(ctx, strings.Split(message.params[0], ",")[0])
+	case "PART":
+		c.part(ctx, strings.Split(message.params[0], ",")[0])
+	case "WHO":
+		c.sendCommand(ctx, domain.Who)
+	case "LIST":
+		c.sendCommand(ctx, domain.Rooms)
+	case "AWAY":
+		if len(message.params) == 0 || message.params[0] == "" {
+			c.sendCommand(ctx, domain.Back)
+			return
+		}
+		c.sendCommand(ctx, domain.Away, strings.Fields(message.params[0])...)
+	case "NOTICE", "MODE":
+		// Notices must never be answered automatically and modes are not supported, both are ignored silently.
+	default:
+		c.reply("421", message.command+" :Unknown command")
+	}
+}
+
+// register completes the registration once NICK and USER were received, the client is logged in if it sent PASS.
+func (c *ircClient) register(ctx context.Context) {
+	c.mutex.Lock()
+	if c.registered || c.nick == "" || !c.userReceived {
+		c.mutex.Unlock()
+		return
+	}
+	c.registered = true
+	c.channel = "#" + domain.DefaultRoomName
+	nick, password, channel := c.nick, c.password, c.channel
+	c.mutex.Unlock()
+
+	c.reply("001", fmt.Sprintf(":Welcome to the tcpchat IRC gateway %s", nick))
+	c.reply("002", fmt.Sprintf(":Your host is %s", c.serverName))
+	c.reply("422", ":MOTD File is missing")
+	c.write(":%s JOIN %s", c.hostmask(nick), channel)
+	c.reply("366", channel+" :End of /NAMES list")
+	if password != "" {
+		c.sendCommand(ctx, domain.Login, nick, password)
+	}
+}
+
+// changeNick sets the nick before the registration and asks the server to change the user name afterwards,
+// the nick is only changed once the server accepted the new user name.
+func (c *ircClient) changeNick(ctx context.Context, nick string) {
+	c.mutex.Lock()
+	if !c.registered {
+		c.nick = nick
+		c.mutex.Unlock()
+		c.register(ctx)
+		return
+	}
+	if nick == c.nick {
+		c.mutex.Unlock()
+		return
+	}
+	if !domain.UserNameIsValid(nick) || domain.UserNameIsReserved(nick) {
+		c.mutex.Unlock()
+		c.reply("432", nick+" :Erroneous nickname")
+		return
+	}
+	c.requestIDs++
+	requestID := strconv.FormatUint(c.requestIDs, 10)
+	c.pendingNicks[requestID] = nick
+	c.mutex.Unlock()
+	c.forwardCommand(ctx, domain.Command{SessionID: c.sessionID, CommandType: domain.ChangeName, Arguments: []string{nick}, RequestID: requestID})
+}
+
+// completeNickChange writes the result of the request changing the nick, reply is ignored if it answers no such request.
+func (c *ircClient) completeNickChange(lines *strings.Builder, reply domain.OutgoingMessage) {
+	c.mutex.Lock()
+	nick, pending := c.pendingNicks[reply.RequestID]
+	delete(c.pendingNicks, reply.RequestID)
+	oldNick := c.nick
+	if pending && reply.Error == "" {
+		c.nick = nick
+	}
+	c.mutex.Unlock()
+	switch {
+	case !pending:
+	case reply.Error == "":
+		fmt.Fprintf(lines, ":%s NICK :%s\r\n", c.hostmask(oldNick), nick)
+	default:
+		fmt.Fprintf(lines, ":%s 433 %s %s :%s\r\n", c.serverName, oldNick, nick, reply.Error)
+	}
+}
+
+// privateMessage sends text to the current channel, to the user named target or,
+// if target is the server, interprets text as a command of the plain text protocol.
+func (c *ircClient) privateMessage(ctx context.Context, target, text string) {
+	text = strings.TrimSpace(text)
+	if action, isAction := strings.CutPrefix(text, "\x01ACTION "); isAction {
+		text = fmt.Sprintf("* %s %s", c.currentNick(), strings.TrimSuffix(action, "\x01"))
+	}
+	if text == "" || strings.HasPrefix(text, "\x01") {
+		return
+	}
+	switch {
+	case strings.HasPrefix(target, "#"):
+		if target != c.currentChannel() {
+			c.reply("404", target+" :Cannot send to channel")
+			return
+		}
+		c.sendTextMessage(ctx, text)
+	case strings.EqualFold(target, c.serverName):
+		command := strings.TrimPrefix(text, "/")
+		if strings.TrimSpace(command) == "" {
+			c.reply("412", ":No text to send")
+			return
+		}
+		_, convertedCommand := application.ConvertMessage(c.sessionID, "/"+command)
+		// Switching rooms has to go through the channel handling to keep the channel of the client in sync.
+		switch {
+		case convertedCommand.CommandType == domain.Join && len(convertedCommand.Arguments) == 1:
+			c.join(ctx, convertedCommand.Arguments[0])
+		case convertedCommand.CommandType == domain.Part:
+			c.part(ctx, c.currentChannel())
+		default:
+			c.forwardCommand(ctx, *convertedCommand)
+		}
+	default:
+		c.sendCommand(ctx, domain.PrivateMessage, target, text)
+	}
+}
+
+// join moves the session to the room of channel, a session is always in exactly one channel.
+func (c *ircClient) join(ctx context.Context, channel string) {
+	roomName := domain.NormalizeRoomName(channel)
+	if !domain.RoomNameIsValid(roomName) {
+		c.reply("403", channel+" :No such channel")
+		return
+	}
+	c.switchChannel(ctx, "#"+roomName, domain.Join, roomName)
+}
+
+// part moves the session back to the default room, the default room itself can not be left.
+func (c *ircClient) part(ctx context.Context, channel string) {
+	if "#"+domain.NormalizeRoomName(channel) != c.currentChannel() {
+		c.reply("442", channel+" :You're not on that channel")
+		return
+	}
+	c.switchChannel(ctx, "#"+domain.DefaultRoomName, domain.Part)
+}
+
+// switchChannel sends the command switching rooms and tells the client it left its current channel and joined channel.
+func (c *ircClient) switchChannel(ctx context.Context, channel string, commandType domain.CommandType, arguments ...string) {
+	c.mutex.Lock()
+	oldChannel, nick := c.channel, c.nick
+	c.channel = channel
+	c.mutex.Unlock()
+	c.sendCommand(ctx, commandType, arguments...)
+	if oldChannel == channel {
+		return
+	}
+	c.write(":%s PART %s", c.hostmask(nick), oldChannel)
+	c.write(":%s JOIN %s", c.hostmask(nick), channel)
+	c.reply("366", channel+" :End of /NAMES list")
+}
+
+// render renders a message as irc lines, every line ends with CRLF.
+func (c *ircClient) render(message domain.OutgoingMessage) string {
+	nick := c.currentNick()
+	var lines strings.Builder
+	switch message.Type {
+	case domain.MessageTypeServer, domain.MessageTypeError:
+		for _, line := range strings.Split(message.Message, "\n") {
+			fmt.Fprintf(&lines, ":%s NOTICE %s :%s\r\n", c.serverName, nick, line)
+		}
+	case domain.MessageTypeUserList:
+		for _, user := range message.Users {
+			// H marks users that are here, G users that are gone, i.e. away or busy.
+			flag := "H"
+			if user.Status != domain.PresenceOnline {
+				flag = "G"
+			}
+			fmt.Fprintf(&lines, ":%s 352 %s * %s %s %s %s %s :0 %s\r\n", c.serverName, nick, user.Name, c.serverName, c.serverName, user.Name, flag, describePresence(user))
+		}
+		fmt.Fprintf(&lines, ":%s 315 %s * :End of /WHO list\r\n", c.serverName, nick)
+	case domain.MessageTypeReply:
+		c.completeNickChange(&lines, message)
+	case domain.MessageTypePrivate:
+		target := nick
+		if strings.EqualFold(message.SenderName, nick) {
+			target = message.RecipientName
+		}
+		writeIRCPrivateMessages(&lines, c.hostmask(message.SenderName), target, message)
+	default:
+		writeIRCPrivateMessages(&lines, c.hostmask(message.SenderName), "#"+message.RoomName, message)
+	}
+	return lines.String()
+}
+
+// writeIRCPrivateMessages writes one PRIVMSG per line of message, replayed messages are prefixed with their timestamp.
+func writeIRCPrivateMessages(lines *strings.Builder, prefix, target string, message domain.OutgoingMessage) {
+	for _, line := range strings.Split(message.Message, "\n") {
+		if message.Replayed {
+			line = fmt.Sprintf("[%s] %s", message.Timestamp.Format(time.DateTime), line)
+		}
+		fmt.Fprintf(lines, ":%s PRIVMSG %s :%s\r\n", prefix, target, line)
+	}
+}
+
+func (c *ircClient) sendCommand(ctx context.Context, commandType domain.CommandType, arguments ...string) {
+	c.forwardCommand(ctx, domain.Command{SessionID: c.sessionID, CommandType: commandType, Arguments: arguments})
+}
+
+func (c *ircClient) forwardCommand(ctx context.Context, command domain.Command) {
+	select {
+	case <-ctx.Done():
+	case c.commands <- command:
+	}
+}
+
+func (c *ircClient) sendTextMessage(ctx context.Context, text string) {
+	select {
+	case <-ctx.Done():
+	case c.textMessages <- *domain.NewTextMessage(c.sessionID, text):
+	}
+}
+
+// reply sends a numeric reply addressed to the nick of the client.
+func (c *ircClient) reply(numeric, params string) {
+	c.write(":%s %s %s %s", c.serverName, numeric, c.currentNick(), params)
+}
+
+func (c *ircClient) write(format string, args ...any) {
+	_, err := fmt.Fprintf(c.writer, format+"\r\n", args...)
+	if err != nil {
+		slog.Warn("irc write error", "sessionID", c.sessionID, "err", err)
+	}
+}
+
+func (c *ircClient) hostmask(nick string) string {
+	return fmt.Sprintf("%s!%s@%s", nick, nick, c.serverName)
+}
+
+// currentNick returns the nick of the client or "*" if it did not send one yet.
+func (c *ircClient) currentNick() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.nick == "" {
+		return "*"
+	}
+	return c.nick
+}
+
+func (c *ircClient) currentChannel() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.channel
+}
+
+func (c *ircClient) isRegistered() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.registered
+}
+
+// lockedWriter serializes writes from multiple goroutines to the same writer.
+type lockedWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.writer.Write(p)
+}
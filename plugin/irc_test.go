@@ -0,0 +1,134 @@
+package plugin_test
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IRC", func() {
+	var (
+		port    int
+		ircPort int
+	)
+
+	BeforeEach(func() {
+		port = freePort()
+		ircPort = freePort()
+		cfg := serverConfig(port)
+		cfg.IRC.Address = fmt.Sprintf("127.0.0.1:%d", ircPort)
+		server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+		waitUntilListening(ircPort)
+	})
+
+	// sendIRC writes every line followed by CRLF, as irc clients do.
+	sendIRC := func(connection net.Conn, lines ...string) {
+		for _, line := range lines {
+			_, err := fmt.Fprintf(connection, "%s\r\n", line)
+			Expect(err).To(BeNil())
+		}
+	}
+
+	It("should register irc clients and answer pings", func() {
+		connection, reader := connect(ircPort)
+		sendIRC(connection, "CAP LS 302", "NICK alice", "USER alice 0 * :Alice")
+		Expect(readLineContaining(reader, " 001 ")).To(HavePrefix(":tcpchat 001 alice :Welcome"))
+		Expect(readLineContaining(reader, "JOIN")).To(Equal(":alice!alice@tcpchat JOIN #lobby\r\n"))
+
+		sendIRC(connection, "PING :12345")
+		Expect(readLineContaining(reader, "PONG")).To(Equal(":tcpchat PONG tcpchat :12345\r\n"))
+	})
+
+	It("should reject commands before the registration", func() {
+		connection, reader := connect(ircPort)
+		sendIRC(connection, "JOIN #golang")
+		Expect(readLineContaining(reader, " 451 ")).To(Equal(":tcpchat 451 * :You have not registered\r\n"))
+	})
+
+	It("should let irc and tcp clients chat with each other", func() {
+		tcpConnection, tcpReader := login(port, "bob")
+		ircConnection, ircReader := connect(ircPort)
+		sendIRC(ircConnection, "NICK alice", "USER alice 0 * :Alice", "PRIVMSG tcpchat :/acc alice "+testPassword, "PRIVMSG tcpchat :/login alice "+testPassword)
+		Expect(readLineContaining(ircReader, "Logged in")).To(Equal(":tcpchat NOTICE alice :Logged in\r\n"))
+
+		send(tcpConnection, "hello from tcp")
+		Expect(readLineContaining(ircReader, "PRIVMSG")).To(Equal(":bob!bob@tcpchat PRIVMSG #lobby :hello from tcp\r\n"))
+
+		sendIRC(ircConnection, "PRIVMSG #lobby :hello from irc")
+		Expect(readLineContaining(tcpReader, "hello")).To(Equal("[alice] hello from irc\n"))
+
+		sendIRC(ircConnection, "PRIVMSG bob :psst")
+		Expect(readLineContaining(tcpReader, "psst")).To(Equal("[p alice] psst\n"))
+
+		send(tcpConnection, "/msg alice hi alice")
+		Expect(readLineContaining(ircReader, "hi alice")).To(Equal(":bob!bob@tcpchat PRIVMSG alice :hi alice\r\n"))
+	})
+
+	It("should log in using PASS and list users with WHO", func() {
+		tcpConnection, tcpReader := connect(port)
+		send(tcpConnection, "/acc alice "+testPassword)
+		readLineContaining(tcpReader, "Created new account")
+		ircConnection, ircReader := connect(ircPort)
+		sendIRC(ircConnection, "PASS "+testPassword, "NICK alice", "USER alice 0 * :Alice")
+		Expect(readLineContaining(ircReader, "Logged in")).To(Equal(":tcpchat NOTICE alice :Logged in\r\n"))
+
+		sendIRC(ircConnection, "WHO *")
+		Expect(readLineContaining(ircReader, " 352 ")).To(MatchRegexp(`^:tcpchat 352 alice \* alice tcpchat tcpchat alice H :0 alice online, idle \d+s\r\n$`))
+		Expect(readLineContaining(ircReader, " 315 ")).To(Equal(":tcpchat 315 alice * :End of /WHO list\r\n"))
+
+		sendIRC(ircConnection, "AWAY :at lunch", "WHO *")
+		Expect(readLineContaining(ircReader, " 352 ")).To(MatchRegexp(`^:tcpchat 352 alice \* alice tcpchat tcpchat alice G :0 alice away \(at lunch\), idle \d+s\r\n$`))
+		sendIRC(ircConnection, "AWAY")
+		readLineContaining(ircReader, "You are no longer marked as away")
+	})
+
+	It("should switch rooms on JOIN and PART", func() {
+		tcpConnection, tcpReader := login(port, "bob")
+		send(tcpConnection, "/join golang")
+		readLineContaining(tcpReader, "#golang")
+		ircConnection, ircReader := connect(ircPort)
+		sendIRC(ircConnection, "NICK alice", "USER alice 0 * :Alice", "PRIVMSG tcpchat :/acc alice "+testPassword, "PRIVMSG tcpchat :/login alice "+testPassword)
+		readLineContaining(ircReader, "Logged in")
+
+		sendIRC(ircConnection, "JOIN #golang")
+		Expect(readLineContaining(ircReader, "PART")).To(Equal(":alice!alice@tcpchat PART #lobby\r\n"))
+		Expect(readLineContaining(ircReader, "JOIN")).To(Equal(":alice!alice@tcpchat JOIN #golang\r\n"))
+		Expect(readLineContaining(tcpReader, "joined")).To(Equal("[server] alice joined #golang\n"))
+
+		sendIRC(ircConnection, "PRIVMSG #lobby :wrong channel")
+		Expect(readLineContaining(ircReader, " 404 ")).To(Equal(":tcpchat 404 alice #lobby :Cannot send to channel\r\n"))
+
+		sendIRC(ircConnection, "PART #golang")
+		Expect(readLineContaining(ircReader, "PART")).To(Equal(":alice!alice@tcpchat PART #golang\r\n"))
+		Expect(readLineContaining(ircReader, "JOIN")).To(Equal(":alice!alice@tcpchat JOIN #lobby\r\n"))
+		Expect(readLineContaining(tcpReader, "left")).To(Equal("[server] alice left #golang\n"))
+	})
+
+	It("should only change the nick once the server accepted the new user name", func() {
+		tcpConnection, tcpReader := login(port, "bob")
+		ircConnection, ircReader := connect(ircPort)
+		sendIRC(ircConnection, "NICK alice", "USER alice 0 * :Alice", "PRIVMSG tcpchat :/acc alice "+testPassword, "PRIVMSG tcpchat :/login alice "+testPassword)
+		readLineContaining(ircReader, "Logged in")
+
+		sendIRC(ircConnection, "NICK server")
+		Expect(readLineContaining(ircReader, " 432 ")).To(Equal(":tcpchat 432 alice server :Erroneous nickname\r\n"))
+		sendIRC(ircConnection, "NICK bob")
+		Expect(readLineContaining(ircReader, " 433 ")).To(HavePrefix(":tcpchat 433 alice bob :"))
+
+		send(tcpConnection, "/msg alice still alice")
+		Expect(readLineContaining(ircReader, "still alice")).To(Equal(":bob!bob@tcpchat PRIVMSG alice :still alice\r\n"))
+		sendIRC(ircConnection, "PRIVMSG bob :from alice")
+		Expect(readLineContaining(tcpReader, "from alice")).To(Equal("[p alice] from alice\n"))
+
+		sendIRC(ircConnection, "NICK carol")
+		Expect(readLineContaining(ircReader, " NICK ")).To(Equal(":alice!alice@tcpchat NICK :carol\r\n"))
+		send(tcpConnection, "/msg carol hi carol")
+		Expect(readLineContaining(ircReader, "hi carol")).To(Equal(":bob!bob@tcpchat PRIVMSG carol :hi carol\r\n"))
+	})
+})
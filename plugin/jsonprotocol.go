@@ -0,0 +1,181 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
+
+// jsonProtocolName is the protocol a client has to request in its hello frame to use the json protocol.
+const jsonProtocolName = "json"
+
+// jsonIncomingFrame is a single line sent by a client using the json protocol.
+type jsonIncomingFrame struct {
+	// Type is one of hello, message, private or command.
+	Type     string   `json:"type"`
+	Protocol string   `json:"protocol,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	Command  string   `json:"command,omitempty"`
+	Args     []string `json:"args,omitempty"`
+	// RequestID is echoed in the reply frame sent once a hello frame, a command or a private message was handled.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// jsonOutgoingFrame is a single line sent to a client using the json protocol.
+type jsonOutgoingFrame struct {
+	// Type is one of text, private, server, userlist, error or reply.
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Sender    string    `json:"sender,omitempty"`
+	Room      string    `json:"room,omitempty"`
+	Recipient string    `json:"recipient,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	// Users are the names of the listed users, Presence describes them in the same order.
+	Users    []string       `json:"users,omitempty"`
+	Presence []jsonPresence `json:"presence,omitempty"`
+	Replayed bool           `json:"replayed,omitempty"`
+	// RequestID is the request id of the command a reply or user list answers.
+	RequestID string `json:"requestId,omitempty"`
+	// Error is only set for replies to commands that failed.
+	Error string `json:"error,omitempty"`
+}
+
+// jsonPresence describes a user listed by /who.
+type jsonPresence struct {
+	Name string `json:"name"`
+	// Status is one of online, away or busy.
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	IdleSeconds int64  `json:"idleSeconds"`
+}
+
+// negotiatedProtocol renders messages using the plain text protocol until the client switched to the json protocol.
+type negotiatedProtocol struct {
+	json atomic.Bool
+}
+
+func (n *negotiatedProtocol) render(message domain.OutgoingMessage) string {
+	if n.json.Load() {
+		return renderJSON(message)
+	}
+	return renderText(message)
+}
+
+// parseJSONHello reports whether line is a hello frame requesting the json protocol and returns its request id.
+func parseJSONHello(line string) (requestID string, isHello bool) {
+	var frame jsonIncomingFrame
+	if err := json.Unmarshal([]byte(line), &frame); err != nil {
+		return "", false
+	}
+	return frame.RequestID, frame.Type == "hello" && frame.Protocol == jsonProtocolName
+}
+
+// handleJSONRead reads json frames from reader and sends them on as text messages and commands until reading fails,
+// then the session is quit.
+func handleJSONRead(ctx context.Context, reader *bufio.Reader, maxLineLength int, sessionID string, floodControl floodControl, textMessages chan<- domain.TextMessage, commands chan<- domain.Command) {
+	for {
+		line, err := readLine(reader, maxLineLength)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+			case commands <- domain.Command{SessionID: sessionID, CommandType: domain.Quit}:
+			}
+			return
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !admitLine(ctx, floodControl, sessionID) {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		textMessage, command := parseJSONFrame(sessionID, line)
+		if textMessage != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case textMessages <- *textMessage:
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case commands <- *command:
+		}
+	}
+}
+
+// parseJSONFrame converts a single json frame into either a text message or a command, exactly one of both is returned.
+// Frames that can not be parsed are converted to unknown commands.
+func parseJSONFrame(sessionID, line string) (*domain.TextMessage, *domain.Command) {
+	var frame jsonIncomingFrame
+	if err := json.Unmarshal([]byte(line), &frame); err != nil {
+		slog.Info("received invalid json frame", "sessionID", sessionID, "err", err)
+		return nil, &domain.Command{SessionID: sessionID, CommandType: domain.Unknown}
+	}
+	switch frame.Type {
+	case "message":
+		return domain.NewTextMessage(sessionID, singleLine(frame.Message)), nil
+	case "private":
+		return nil, &domain.Command{SessionID: sessionID, CommandType: domain.PrivateMessage, Arguments: []string{frame.To, singleLine(frame.Message)}, RequestID: frame.RequestID}
+	case "command":
+		arguments := make([]string, 0, len(frame.Args))
+		for _, argument := range frame.Args {
+			arguments = append(arguments, singleLine(argument))
+		}
+		return nil, &domain.Command{SessionID: sessionID, CommandType: domain.CommandType(frame.Command), Arguments: arguments, RequestID: frame.RequestID}
+	default:
+		return nil, &domain.Command{SessionID: sessionID, CommandType: domain.Unknown, RequestID: frame.RequestID}
+	}
+}
+
+// singleLine replaces line breaks, so that the text can not be mistaken for several lines by plain text clients.
+func singleLine(text string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(text)
+}
+
+// renderJSON renders a message as a single json frame ending with a newline.
+func renderJSON(message domain.OutgoingMessage) string {
+	var userNames []string
+	var presence []jsonPresence
+	for _, user := range message.Users {
+		userNames = append(userNames, user.Name)
+		presence = append(presence, jsonPresence{Name: user.Name, Status: user.Status.String(), Reason: user.Reason, IdleSeconds: int64(user.Idle / time.Second)})
+	}
+	frame, err := json.Marshal(jsonOutgoingFrame{
+		Type:      message.Type.String(),
+		ID:        message.ID,
+		Timestamp: message.Timestamp,
+		Sender:    message.SenderName,
+		Room:      message.RoomName,
+		Recipient: message.RecipientName,
+		Message:   message.Message,
+		Users:     userNames,
+		Presence:  presence,
+		Replayed:  message.Replayed,
+		RequestID: message.RequestID,
+		Error:     message.Error,
+	})
+	if err != nil {
+		slog.Error("failed to render json frame", "messageID", message.ID, "err", err)
+		return ""
+	}
+	return fmt.Sprintf("%s\n", frame)
+}
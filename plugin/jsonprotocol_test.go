@@ -0,0 +1,104 @@
+package plugin_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSON protocol", func() {
+	var port int
+
+	BeforeEach(func() {
+		port = freePort()
+		server, err := plugin.NewTCPChatServer(serverConfig(port), domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+	})
+
+	// readFrame reads json frames until a frame with the given type contains substring in its message.
+	readFrame := func(reader *bufio.Reader, frameType, substring string) map[string]any {
+		for {
+			line, err := reader.ReadString('\n')
+			Expect(err).To(BeNil())
+			var frame map[string]any
+			if json.Unmarshal([]byte(line), &frame) != nil {
+				continue
+			}
+			if frame["type"] == frameType && strings.Contains(fmt.Sprint(frame["message"]), substring) {
+				return frame
+			}
+		}
+	}
+
+	connectJSON := func(name string) (net.Conn, *bufio.Reader) {
+		connection, reader := connect(port,
+			`{"type":"hello","protocol":"json"}`,
+			fmt.Sprintf(`{"type":"command","command":"acc","args":["%s","%s"]}`, name, testPassword),
+			fmt.Sprintf(`{"type":"command","command":"login","args":["%s","%s"]}`, name, testPassword),
+		)
+		readFrame(reader, "server", "Logged in")
+		return connection, reader
+	}
+
+	It("should switch to json frames after the hello frame", func() {
+		_, reader := connect(port, `{"type":"hello","protocol":"json"}`, `{"type":"command","command":"info"}`)
+		Expect(readFrame(reader, "server", "json protocol")).To(HaveKey("timestamp"))
+		frame := readFrame(reader, "server", "sessionID")
+		Expect(frame["id"]).NotTo(BeEmpty())
+	})
+
+	It("should deliver typed frames between json and text clients", func() {
+		jsonConnection, jsonReader := connectJSON("alice")
+		textConnection, textReader := login(port, "bob")
+
+		send(textConnection, "hello alice")
+		frame := readFrame(jsonReader, "text", "hello alice")
+		Expect(frame).To(HaveKeyWithValue("sender", "bob"))
+		Expect(frame).To(HaveKeyWithValue("room", "lobby"))
+		Expect(frame).To(HaveKey("id"))
+
+		send(jsonConnection, `{"type":"private","to":"bob","message":"hi\nbob"}`)
+		Expect(readLineContaining(textReader, "[p alice]")).To(Equal("[p alice] hi bob\n"))
+
+		send(jsonConnection, `{"type":"message","message":"hello bob"}`)
+		Expect(readLineContaining(textReader, "hello bob")).To(Equal("[alice] hello bob\n"))
+
+		send(textConnection, "/msg alice psst")
+		frame = readFrame(jsonReader, "private", "psst")
+		Expect(frame).To(HaveKeyWithValue("sender", "bob"))
+		Expect(frame).To(HaveKeyWithValue("recipient", "alice"))
+	})
+
+	It("should answer invalid frames with an unknown command", func() {
+		connection, reader := connectJSON("alice")
+		send(connection, "not json")
+		readFrame(reader, "error", "Unknown command")
+	})
+
+	It("should reply to commands with a request id", func() {
+		connection, reader := connectJSON("alice")
+		send(connection, `{"type":"command","command":"who","requestId":"1"}`)
+		Expect(readFrame(reader, "userlist", "")).To(HaveKeyWithValue("requestId", "1"))
+		frame := readFrame(reader, "reply", "")
+		Expect(frame).To(HaveKeyWithValue("requestId", "1"))
+		Expect(frame).NotTo(HaveKey("error"))
+
+		send(connection, `{"type":"command","command":"join","args":["#"],"requestId":"2"}`)
+		frame = readFrame(reader, "reply", "")
+		Expect(frame).To(HaveKeyWithValue("requestId", "2"))
+		Expect(frame).To(HaveKey("error"))
+	})
+
+	It("should keep using the text protocol if the first line is not a hello frame", func() {
+		_, reader := connect(port, "/info")
+		Expect(readLineContaining(reader, "sessionID")).To(HavePrefix("[server] sessionID: "))
+	})
+})
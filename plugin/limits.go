@@ -0,0 +1,179 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/config"
+)
+
+// errIdleTimeout is returned when reading from a connection that did not send anything for too long.
+var errIdleTimeout = errors.New("connection was idle for too long")
+
+// connectionLimiter counts the open connections in total and per remote host, it is safe for concurrent use.
+type connectionLimiter struct {
+	maxTotal   int
+	maxPerHost int
+	metrics    *serverMetrics
+
+	mutex   sync.Mutex
+	total   int
+	perHost map[string]int
+}
+
+// newConnectionLimiter creates a connectionLimiter, a limit of zero allows any number of connections.
+func newConnectionLimiter(maxTotal, maxPerHost int, metrics *serverMetrics) *connectionLimiter {
+	return &connectionLimiter{maxTotal: maxTotal, maxPerHost: maxPerHost, metrics: metrics, perHost: make(map[string]int)}
+}
+
+// acquire counts a new connection from host unless it exceeds a limit, in which case the exceeded limit is returned.
+func (l *connectionLimiter) acquire(host string) (exceededLimit string, ok bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		return "total", false
+	}
+	if l.maxPerHost > 0 && l.perHost[host] >= l.maxPerHost {
+		return "host", false
+	}
+	l.total++
+	l.perHost[host]++
+	return "", true
+}
+
+// release stops counting a connection from host.
+func (l *connectionLimiter) release(host string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.total--
+	if l.perHost[host]--; l.perHost[host] <= 0 {
+		delete(l.perHost, host)
+	}
+}
+
+// open returns the number of open connections.
+func (l *connectionLimiter) open() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.total
+}
+
+// limitedListener closes accepted connections right away if they exceed the limits of limiter.
+type limitedListener struct {
+	net.Listener
+	limiter *connectionLimiter
+}
+
+func (l *limitedListener) Accept() (net.Conn, error) {
+	for {
+		connection, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		host := remoteHost(connection.RemoteAddr())
+		if exceededLimit, ok := l.limiter.acquire(host); !ok {
+			slog.Warn("rejected connection exceeding the connection limits", "remoteAddr", connection.RemoteAddr(), "limit", exceededLimit)
+			l.limiter.metrics.ConnectionRejected(exceededLimit)
+			connection.Close()
+			continue
+		}
+		return &limitedConnection{Conn: connection, release: sync.OnceFunc(func() { l.limiter.release(host) })}, nil
+	}
+}
+
+// limitedConnection is counted by a connectionLimiter until it is closed.
+type limitedConnection struct {
+	net.Conn
+	release func()
+}
+
+func (l *limitedConnection) Close() error {
+	defer l.release()
+	return l.Conn.Close()
+}
+
+// remoteHost returns the host part of address, or address itself if it has no port.
+func remoteHost(address net.Addr) string {
+	host, _, err := net.SplitHostPort(address.String())
+	if err != nil {
+		return address.String()
+	}
+	return host
+}
+
+// timeoutConnection sets a deadline before every read and write. Reading fails with errIdleTimeout once the remote
+// side did not send anything for the idle timeout, the session is warned before and told why it is disconnected
+// using notify. A connection that can not be written to in time is closed.
+type timeoutConnection struct {
+	net.Conn
+	idleTimeout  time.Duration
+	idleWarning  time.Duration
+	writeTimeout time.Duration
+	notify       func(message string)
+	metrics      *serverMetrics
+	warning      *time.Timer
+}
+
+func newTimeoutConnection(connection net.Conn, cfg config.ConnectionsConfig, metrics *serverMetrics, notify func(message string)) *timeoutConnection {
+	t := &timeoutConnection{Conn: connection, idleTimeout: cfg.IdleTimeout, idleWarning: cfg.IdleWarning, writeTimeout: cfg.WriteTimeout, notify: notify, metrics: metrics}
+	if t.idleTimeout > 0 && t.idleWarning > 0 {
+		t.warning = time.AfterFunc(t.idleTimeout-t.idleWarning, func() {
+			notify(fmt.Sprintf("You will be disconnected in %s for being idle", t.idleWarning))
+		})
+	}
+	return t
+}
+
+func (t *timeoutConnection) Read(p []byte) (int, error) {
+	if t.idleTimeout > 0 {
+		if err := t.Conn.SetReadDeadline(time.Now().Add(t.idleTimeout)); err != nil {
+			return 0, err
+		}
+		if t.warning != nil {
+			t.warning.Reset(t.idleTimeout - t.idleWarning)
+		}
+	}
+	n, err := t.Conn.Read(p)
+	if isTimeout(err) {
+		slog.Info("disconnecting idle connection", "remoteAddr", t.RemoteAddr(), "idleTimeout", t.idleTimeout)
+		t.metrics.IdleConnectionClosed()
+		t.notify("You were disconnected for being idle")
+		return n, errIdleTimeout
+	}
+	return n, err
+}
+
+func (t *timeoutConnection) Write(p []byte) (int, error) {
+	if err := t.Conn.SetWriteDeadline(time.Now().Add(t.writeTimeout)); err != nil {
+		return 0, err
+	}
+	n, err := t.Conn.Write(p)
+	if isTimeout(err) {
+		slog.Warn("closing connection that can not be written to in time", "remoteAddr", t.RemoteAddr(), "writeTimeout", t.writeTimeout)
+		// Closing the connection ends reading from it, which closes the session.
+		t.Conn.Close()
+	}
+	return n, err
+}
+
+func (t *timeoutConnection) Close() error {
+	if t.warning != nil {
+		t.warning.Stop()
+	}
+	return t.Conn.Close()
+}
+
+// isTimeout reports whether err was caused by a deadline, websocket connections do not wrap os.ErrDeadlineExceeded.
+func isTimeout(err error) bool {
+	var netError net.Error
+	return errors.As(err, &netError) && netError.Timeout()
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"net"
+	"os"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limits", func() {
+	Context("connectionLimiter", func() {
+		It("should limit the connections in total and per host", func() {
+			limiter := newConnectionLimiter(3, 2, newServerMetrics())
+			for range 2 {
+				_, ok := limiter.acquire("10.0.0.1")
+				Expect(ok).To(BeTrue())
+			}
+			exceededLimit, ok := limiter.acquire("10.0.0.1")
+			Expect(ok).To(BeFalse())
+			Expect(exceededLimit).To(Equal("host"))
+
+			_, ok = limiter.acquire("10.0.0.2")
+			Expect(ok).To(BeTrue())
+			exceededLimit, ok = limiter.acquire("10.0.0.3")
+			Expect(ok).To(BeFalse())
+			Expect(exceededLimit).To(Equal("total"))
+			Expect(limiter.open()).To(Equal(3))
+
+			limiter.release("10.0.0.1")
+			_, ok = limiter.acquire("10.0.0.1")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("should allow any number of connections if the limits are zero", func() {
+			limiter := newConnectionLimiter(0, 0, newServerMetrics())
+			for range 100 {
+				_, ok := limiter.acquire("10.0.0.1")
+				Expect(ok).To(BeTrue())
+			}
+		})
+	})
+
+	Context("timeoutConnection", func() {
+		var (
+			local, remote net.Conn
+			notices       chan string
+		)
+
+		BeforeEach(func() {
+			local, remote = net.Pipe()
+			DeferCleanup(remote.Close)
+			notices = make(chan string, 2)
+		})
+
+		newConnection := func(cfg config.ConnectionsConfig) *timeoutConnection {
+			connection := newTimeoutConnection(local, cfg, newServerMetrics(), func(message string) { notices <- message })
+			DeferCleanup(connection.Close)
+			return connection
+		}
+
+		It("should warn before failing reads after the idle timeout", func() {
+			connection := newConnection(config.ConnectionsConfig{IdleTimeout: 200 * time.Millisecond, IdleWarning: 100 * time.Millisecond, WriteTimeout: time.Second})
+			_, err := connection.Read(make([]byte, 1))
+			Expect(err).To(MatchError(errIdleTimeout))
+			Expect(notices).To(Receive(Equal("You will be disconnected in 100ms for being idle")))
+			Expect(notices).To(Receive(Equal("You were disconnected for being idle")))
+		})
+
+		It("should restart the idle timeout after reading", func() {
+			connection := newConnection(config.ConnectionsConfig{IdleTimeout: 200 * time.Millisecond, IdleWarning: 100 * time.Millisecond, WriteTimeout: time.Second})
+			go func() {
+				for range 3 {
+					time.Sleep(50 * time.Millisecond)
+					_, _ = remote.Write([]byte("a"))
+				}
+			}()
+			for range 3 {
+				n, err := connection.Read(make([]byte, 1))
+				Expect(err).To(BeNil())
+				Expect(n).To(Equal(1))
+			}
+			Expect(notices).To(BeEmpty())
+		})
+
+		It("should close the connection if a write times out", func() {
+			connection := newConnection(config.ConnectionsConfig{WriteTimeout: 50 * time.Millisecond})
+			_, err := connection.Write([]byte("hello\n"))
+			Expect(err).To(MatchError(os.ErrDeadlineExceeded))
+			_, err = remote.Read(make([]byte, 1))
+			Expect(err).NotTo(BeNil())
+		})
+	})
+})
@@ -0,0 +1,187 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/application"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "tcpchat"
+
+// serverMetrics implements application.Metrics using prometheus collectors, every server has its own registry.
+type serverMetrics struct {
+	registry            *prometheus.Registry
+	messagesReceived    *prometheus.CounterVec
+	messagesQueued      *prometheus.CounterVec
+	commands            *prometheus.CounterVec
+	loginFailures       prometheus.Counter
+	floodActions        *prometheus.CounterVec
+	writeErrors         prometheus.Counter
+	rejectedConnections *prometheus.CounterVec
+	idleDisconnects     prometheus.Counter
+	handlerDuration     *prometheus.HistogramVec
+}
+
+func newServerMetrics() *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		messagesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "messages_received_total", Help: "Messages received from sessions by type.",
+		}, []string{"type"}),
+		messagesQueued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "messages_sent_total", Help: "Messages queued to be sent to sessions by type.",
+		}, []string{"type"}),
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "commands_total", Help: "Commands handled by command.",
+		}, []string{"command"}),
+		loginFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "login_failures_total", Help: "Logins with an unknown user name or a wrong password.",
+		}),
+		floodActions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "flood_actions_total", Help: "Lines exceeding the rate limits by the action taken.",
+		}, []string{"action"}),
+		writeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "write_errors_total", Help: "Messages that could not be written to a connection.",
+		}),
+		rejectedConnections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "rejected_connections_total", Help: "Connections closed right away by the exceeded connection limit.",
+		}, []string{"limit"}),
+		idleDisconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "idle_disconnects_total", Help: "Connections closed because they were idle for too long.",
+		}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace, Name: "handler_duration_seconds", Help: "Time taken to handle events received from sessions.",
+			Buckets: []float64{.0001, .0005, .001, .005, .01, .05, .1, .25, .5, 1},
+		}, []string{"event"}),
+	}
+	m.registry.MustRegister(m.messagesReceived, m.messagesQueued, m.commands, m.loginFailures, m.floodActions, m.writeErrors, m.rejectedConnections, m.idleDisconnects, m.handlerDuration)
+	m.registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+// registerChatService registers the metrics describing the current state of chatService, they are collected on every scrape.
+func (m *serverMetrics) registerChatService(chatService *application.BasicChatService) {
+	queueDepths := func(aggregate func(depths []int) int) func() float64 {
+		return func() float64 {
+			depths := make([]int, 0)
+			for _, session := range chatService.GetAllSessions() {
+				depths = append(depths, session.Outgoing.Len())
+			}
+			return float64(aggregate(depths))
+		}
+	}
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace, Name: "active_sessions", Help: "Sessions that are currently connected.",
+		}, func() float64 { return float64(len(chatService.GetAllSessions())) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace, Name: "logged_in_users", Help: "Distinct users logged in on at least one session.",
+		}, func() float64 { return float64(chatService.CountLoggedInUsers()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace, Name: "outgoing_queue_messages", Help: "Messages waiting to be written to all sessions.",
+		}, queueDepths(sum)),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace, Name: "outgoing_queue_max_messages", Help: "Messages waiting to be written to the session with the fullest queue.",
+		}, queueDepths(maximum)),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "dropped_messages_total", Help: "Messages dropped because the queue of a session was full.",
+		}, func() float64 { return float64(chatService.DeliveryStats().DroppedMessages.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "disconnected_slow_sessions_total", Help: "Sessions disconnected because their queue was full.",
+		}, func() float64 { return float64(chatService.DeliveryStats().DisconnectedSessions.Load()) }),
+	)
+}
+
+func (m *serverMetrics) SessionRegistered(duration time.Duration) {
+	m.handlerDuration.WithLabelValues("session").Observe(duration.Seconds())
+}
+
+func (m *serverMetrics) TextMessageHandled(duration time.Duration) {
+	m.messagesReceived.WithLabelValues("text").Inc()
+	m.handlerDuration.WithLabelValues("text").Observe(duration.Seconds())
+}
+
+func (m *serverMetrics) CommandHandled(commandType domain.CommandType, duration time.Duration) {
+	m.messagesReceived.WithLabelValues("command").Inc()
+	m.commands.WithLabelValues(commandType.String()).Inc()
+	m.handlerDuration.WithLabelValues("command").Observe(duration.Seconds())
+}
+
+func (m *serverMetrics) MessageQueued(messageType domain.MessageType) {
+	m.messagesQueued.WithLabelValues(messageType.String()).Inc()
+}
+
+func (m *serverMetrics) LoginFailed() {
+	m.loginFailures.Inc()
+}
+
+func (m *serverMetrics) FloodActionTaken(action domain.FloodAction) {
+	m.floodActions.WithLabelValues(action.String()).Inc()
+}
+
+// WriteFailed counts a message that could not be written to a connection.
+func (m *serverMetrics) WriteFailed() {
+	m.writeErrors.Inc()
+}
+
+// registerConnectionLimiter registers the number of connections currently counted by limiter.
+func (m *serverMetrics) registerConnectionLimiter(limiter *connectionLimiter) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace, Name: "open_connections", Help: "Connections that are currently open on all chat listeners.",
+	}, func() float64 { return float64(limiter.open()) }))
+}
+
+// ConnectionRejected counts a connection that was closed right away because it exceeded limit.
+func (m *serverMetrics) ConnectionRejected(limit string) {
+	m.rejectedConnections.WithLabelValues(limit).Inc()
+}
+
+// IdleConnectionClosed counts a connection that was closed because it was idle for too long.
+func (m *serverMetrics) IdleConnectionClosed() {
+	m.idleDisconnects.Inc()
+}
+
+// serveMetrics exposes the metrics on listener until ctx is Done.
+func serveMetrics(ctx context.Context, listener net.Listener, path string, metrics *serverMetrics) {
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	err := server.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("metrics server stopped", "err", err)
+	}
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+func maximum(values []int) int {
+	largest := 0
+	for _, value := range values {
+		largest = max(largest, value)
+	}
+	return largest
+}
@@ -0,0 +1,57 @@
+package plugin_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	var (
+		port        int
+		metricsPort int
+	)
+
+	BeforeEach(func() {
+		port = freePort()
+		metricsPort = freePort()
+		cfg := serverConfig(port)
+		cfg.Metrics.Address = fmt.Sprintf("127.0.0.1:%d", metricsPort)
+		server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+		waitUntilListening(metricsPort)
+	})
+
+	scrape := func() string {
+		response, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", metricsPort))
+		Expect(err).To(BeNil())
+		defer response.Body.Close()
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		body, err := io.ReadAll(response.Body)
+		Expect(err).To(BeNil())
+		return string(body)
+	}
+
+	It("should expose the activity of the sessions", func() {
+		_, reader := connect(port, "/acc alice "+testPassword, "/login alice wrong", "/login alice "+testPassword, "/login alice "+testPassword, "hello", "/info")
+		readLineContaining(reader, "userName:")
+
+		Eventually(scrape).Should(And(
+			ContainSubstring("tcpchat_active_sessions 1\n"),
+			ContainSubstring("tcpchat_logged_in_users 1\n"),
+			ContainSubstring("tcpchat_login_failures_total 1\n"),
+			ContainSubstring(`tcpchat_commands_total{command="login"} 3`),
+			ContainSubstring(`tcpchat_messages_received_total{type="text"} 1`),
+			ContainSubstring(`tcpchat_messages_sent_total{type="server"} `),
+			ContainSubstring(`tcpchat_commands_total{command="info"} 1`),
+			ContainSubstring(`tcpchat_handler_duration_seconds_count{event="text"} 1`),
+			ContainSubstring("tcpchat_outgoing_queue_messages "),
+		))
+	})
+})
@@ -0,0 +1,78 @@
+package plugin_test
+
+import (
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Moderation", func() {
+	var (
+		port          int
+		banRepository *domain.InMemoryBanRepository
+	)
+
+	BeforeEach(func() {
+		port = freePort()
+		cfg := serverConfig(port)
+		cfg.Admins = []string{"admin"}
+		banRepository = domain.NewInMemoryBanRepository()
+		server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), banRepository)
+		Expect(err).To(BeNil())
+		startServer(server, port)
+	})
+
+	It("should not let regular users moderate", func() {
+		connection, reader := login(port, "alice")
+		login(port, "bob")
+		send(connection, "/kick bob")
+		Expect(readLineContaining(reader, "allowed")).To(Equal("[server] you are not allowed to use this command\n"))
+	})
+
+	It("should let admins make moderators that can kick users", func() {
+		adminConnection, adminReader := login(port, "admin")
+		moderatorConnection, moderatorReader := login(port, "alice")
+		_, userReader := login(port, "bob")
+
+		send(adminConnection, "/op alice")
+		Expect(readLineContaining(adminReader, "alice")).To(Equal("[server] alice is now a moderator\n"))
+		Expect(readLineContaining(moderatorReader, "made you")).To(Equal("[server] admin made you a moderator\n"))
+
+		send(moderatorConnection, "/kick admin")
+		Expect(readLineContaining(moderatorReader, "moderate")).To(Equal("[server] you can only moderate users with a lower role than yours\n"))
+
+		send(moderatorConnection, "/kick bob")
+		Expect(readLineContaining(userReader, "kicked")).To(Equal("[server] You were kicked by alice\n"))
+		_, err := userReader.ReadString('\n')
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should keep banned users from logging in until they are unbanned", func() {
+		adminConnection, adminReader := login(port, "admin")
+		_, userReader := login(port, "bob")
+
+		send(adminConnection, "/ban bob 1h")
+		Expect(readLineContaining(adminReader, "Banned")).To(Equal("[server] Banned bob for 1h0m0s\n"))
+		Expect(readLineContaining(userReader, "banned")).To(HavePrefix("[server] you are banned from this server until"))
+
+		connection, reader := connect(port)
+		send(connection, "/login bob "+testPassword)
+		Expect(readLineContaining(reader, "banned")).To(HavePrefix("[server] you are banned from this server until"))
+
+		send(adminConnection, "/unban bob")
+		Expect(readLineContaining(adminReader, "Unbanned")).To(Equal("[server] Unbanned bob\n"))
+		send(connection, "/login bob "+testPassword)
+		readLineContaining(reader, "Logged in")
+	})
+
+	It("should close connections from banned hosts", func() {
+		user, _ := domain.NewUser("mallory", testPassword)
+		banRepository.Add(domain.NewBan(user, []string{"127.0.0.1"}, "admin", 0))
+
+		_, reader := connect(port)
+		Expect(readLineContaining(reader, "banned")).To(Equal("[server] you are banned from this server\n"))
+		_, err := reader.ReadString('\n')
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,40 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/benedictweis/tcpchat-server-go/application"
+	"github.com/benedictweis/tcpchat-server-go/config"
+)
+
+// LoadPasswordPolicy creates the password policy configured by passwordsConfig, reading the deny-list file if one is given.
+func LoadPasswordPolicy(passwordsConfig config.PasswordsConfig) (application.BasicPasswordPolicy, error) {
+	policy := application.BasicPasswordPolicy{
+		MinLength:           passwordsConfig.MinLength,
+		MinCharacterClasses: passwordsConfig.MinCharacterClasses,
+		DeniedPasswords:     make([]string, 0),
+	}
+	if passwordsConfig.DenyCommon {
+		policy.DeniedPasswords = append(policy.DeniedPasswords, application.CommonPasswords()...)
+	}
+	if passwordsConfig.DenyListFile == "" {
+		return policy, nil
+	}
+	denyList, err := os.ReadFile(passwordsConfig.DenyListFile)
+	if err != nil {
+		return application.BasicPasswordPolicy{}, fmt.Errorf("failed to read password deny-list file: %w", err)
+	}
+	for _, line := range strings.Split(string(denyList), "\n") {
+		if deniedPassword := strings.TrimSpace(line); deniedPassword != "" {
+			policy.DeniedPasswords = append(policy.DeniedPasswords, deniedPassword)
+		}
+	}
+	return policy, nil
+}
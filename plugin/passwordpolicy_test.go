@@ -0,0 +1,71 @@
+package plugin_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/benedictweis/tcpchat-server-go/config"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Password policy", func() {
+	var port int
+
+	start := func(cfg config.Config) {
+		server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+	}
+
+	BeforeEach(func() {
+		port = freePort()
+	})
+
+	DescribeTable("Creating accounts",
+		func(password, expectedReply string) {
+			start(serverConfig(port))
+			connection, reader := connect(port)
+			send(connection, "/acc bob "+password)
+			Expect(readLineContaining(reader, expectedReply)).To(HavePrefix("[server] "))
+		},
+		Entry("When given a short password", "1", "your password must be at least 8 characters long"),
+		Entry("When given a password of a single character class", "abcdefghij", "your password must contain at least 2 of"),
+		Entry("When given a common password", "Password123", "your password is too common"),
+		Entry("When given a password that is too long", strings.Repeat("a1", 40), "your password must be at most 72 bytes long"),
+		Entry("When given a strong password", testPassword, "Created new account"),
+	)
+
+	It("should reject the user name as password", func() {
+		start(serverConfig(port))
+		connection, reader := connect(port)
+		send(connection, "/acc bob-smith Bob-Smith")
+		Expect(readLineContaining(reader, "password")).To(Equal("[server] your password must not be your user name\n"))
+	})
+
+	It("should check new passwords when changing them", func() {
+		start(serverConfig(port))
+		connection, reader := connect(port)
+		send(connection, "/acc bob "+testPassword)
+		send(connection, "/login bob "+testPassword)
+		readLineContaining(reader, "Logged in")
+		send(connection, "/passwd "+testPassword+" short")
+		Expect(readLineContaining(reader, "password")).To(Equal("[server] your password must be at least 8 characters long\n"))
+		send(connection, "/passwd "+testPassword+" other-pw1")
+		readLineContaining(reader, "Changed Password")
+	})
+
+	It("should reject passwords from the deny-list file", func() {
+		denyListFile := filepath.Join(GinkgoT().TempDir(), "denied.txt")
+		Expect(os.WriteFile(denyListFile, []byte("company-2024\n\n"), 0o600)).To(Succeed())
+		cfg := serverConfig(port)
+		cfg.Passwords.DenyListFile = denyListFile
+		start(cfg)
+		connection, reader := connect(port)
+		send(connection, "/acc bob Company-2024")
+		Expect(readLineContaining(reader, "password")).To(Equal("[server] your password is too common, please choose another one\n"))
+	})
+})
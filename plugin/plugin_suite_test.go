@@ -0,0 +1,102 @@
+package plugin_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/config"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// testPassword is the password of the accounts created by the specs.
+const testPassword = "s3cret-pw"
+
+func TestPlugin(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Plugin Suite")
+}
+
+// freePort returns a port that was free at the time of calling.
+func freePort() int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(BeNil())
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// serverConfig returns the default config listening on the loopback interface with the given port.
+func serverConfig(port int) config.Config {
+	cfg := config.Default()
+	cfg.Address = "127.0.0.1"
+	cfg.Port = port
+	return cfg
+}
+
+// startServer starts the server in the background and waits until it accepts connections.
+func startServer(server *plugin.TCPChatServer, port int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Start(ctx)
+	}()
+	DeferCleanup(func() {
+		cancel()
+		Eventually(stopped, 5*time.Second).Should(Receive(BeNil()))
+	})
+	waitUntilListening(port)
+}
+
+// waitUntilListening waits until connections to port are accepted.
+func waitUntilListening(port int) {
+	Eventually(func() error {
+		connection, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			connection.Close()
+		}
+		return err
+	}).Should(Succeed())
+}
+
+// connect connects to the plain text protocol on port and sends lines, the connection is closed after the spec.
+func connect(port int, lines ...string) (net.Conn, *bufio.Reader) {
+	connection, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	Expect(err).To(BeNil())
+	DeferCleanup(func() { _ = connection.Close() })
+	Expect(connection.SetDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+	send(connection, lines...)
+	return connection, bufio.NewReader(connection)
+}
+
+// login connects to port, creates an account with testPassword for name and waits until it is logged in.
+func login(port int, name string) (net.Conn, *bufio.Reader) {
+	connection, reader := connect(port, fmt.Sprintf("/acc %s %s", name, testPassword), fmt.Sprintf("/login %s %s", name, testPassword))
+	readLineContaining(reader, "Logged in")
+	return connection, reader
+}
+
+// send writes every line followed by a newline.
+func send(connection net.Conn, lines ...string) {
+	if len(lines) == 0 {
+		return
+	}
+	_, err := fmt.Fprint(connection, strings.Join(lines, "\n")+"\n")
+	Expect(err).To(BeNil())
+}
+
+// readLineContaining reads lines until a line contains substring and returns that line.
+func readLineContaining(reader *bufio.Reader, substring string) string {
+	for {
+		line, err := reader.ReadString('\n')
+		Expect(err).To(BeNil())
+		if strings.Contains(line, substring) {
+			return line
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package plugin_test
+
+import (
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Presence", func() {
+	var port int
+
+	BeforeEach(func() {
+		port = freePort()
+		server, err := plugin.NewTCPChatServer(serverConfig(port), domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+	})
+
+	It("should list all users without logging anybody out", func() {
+		alice, aliceReader := login(port, "alice")
+		bob, bobReader := login(port, "bob")
+
+		send(alice, "/who")
+		Expect(readLineContaining(aliceReader, "alice ")).To(MatchRegexp(`^\[server\] alice online, idle \d+s\n$`))
+		Expect(readLineContaining(aliceReader, "bob ")).To(MatchRegexp(`^\[server\] bob online, idle \d+s\n$`))
+
+		send(bob, "still here")
+		Expect(readLineContaining(aliceReader, "still here")).To(Equal("[bob] still here\n"))
+		send(bob, "/who")
+		readLineContaining(bobReader, "alice online")
+	})
+
+	It("should show the status of users that are away or busy", func() {
+		alice, aliceReader := login(port, "alice")
+		bob, bobReader := login(port, "bob")
+
+		send(bob, "/away out for lunch")
+		readLineContaining(bobReader, "You are now marked as away")
+		send(alice, "/who")
+		Expect(readLineContaining(aliceReader, "bob ")).To(MatchRegexp(`^\[server\] bob away \(out for lunch\), idle \d+s\n$`))
+
+		send(alice, "/msg bob are you there?")
+		readLineContaining(aliceReader, "bob is away: out for lunch")
+		readLineContaining(bobReader, "are you there?")
+
+		send(bob, "/busy")
+		readLineContaining(bobReader, "You are now marked as busy")
+		send(alice, "/who")
+		readLineContaining(aliceReader, "bob busy, idle")
+
+		send(bob, "/back")
+		readLineContaining(bobReader, "You are no longer marked as away")
+		send(alice, "/who")
+		readLineContaining(aliceReader, "bob online, idle")
+	})
+
+	It("should reset the status once the user logs in again", func() {
+		bob, bobReader := login(port, "bob")
+		send(bob, "/away", "/quit")
+		readLineContaining(bobReader, "You are now marked as away")
+
+		alice, aliceReader := login(port, "alice")
+		login(port, "bob")
+		send(alice, "/who")
+		readLineContaining(aliceReader, "bob online, idle")
+	})
+})
@@ -9,35 +9,129 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/benedictweis/tcpchat-server-go/application"
+	"github.com/benedictweis/tcpchat-server-go/domain"
 )
 
-// handleRead is used to read from a reader and return the result on a channel.
-func handleRead(ctx context.Context, reader io.Reader, messages chan<- application.MessageResult, sessionID string) {
+// handleRead is used to read lines from a reader and return them on messages, it returns after the first read error.
+// If the first line is a hello frame requesting the json protocol, protocol is switched to json and all following
+// lines are read as json frames instead. Lines exceeding the rate limits are held back or dropped by floodControl.
+func handleRead(ctx context.Context, reader io.Reader, maxLineLength int, session domain.Session, protocol *negotiatedProtocol, floodControl floodControl, messages chan<- application.MessageResult, textMessages chan<- domain.TextMessage, commands chan<- domain.Command) {
 	bufioReader := bufio.NewReader(reader)
+	firstLine, err := readLine(bufioReader, maxLineLength)
+	if requestID, isHello := parseJSONHello(firstLine); err == nil && isHello {
+		protocol.json.Store(true)
+		session.Outgoing.Push(domain.NewServerOutgoingMessage("Using the json protocol"))
+		if requestID != "" {
+			session.Outgoing.Push(domain.NewReplyOutgoingMessage(requestID, ""))
+		}
+		handleJSONRead(ctx, bufioReader, maxLineLength, session.ID, floodControl, textMessages, commands)
+		return
+	}
+	if !sendLine(ctx, floodControl, messages, session.ID, firstLine, err) {
+		return
+	}
+	if err == nil {
+		readLines(ctx, bufioReader, maxLineLength, floodControl, messages, session.ID)
+	}
+}
+
+// readLines reads lines from bufioReader and returns them on a channel, it returns after the first read error.
+func readLines(ctx context.Context, bufioReader *bufio.Reader, maxLineLength int, floodControl floodControl, messages chan<- application.MessageResult, sessionID string) {
 	for {
-		line, err := bufioReader.ReadString('\n')
+		line, err := readLine(bufioReader, maxLineLength)
+		if !sendLine(ctx, floodControl, messages, sessionID, line, err) || err != nil {
+			return
+		}
+	}
+}
+
+// sendLine sends a line read from the session on messages unless floodControl drops it, read errors are always sent.
+// It returns false once ctx is Done.
+func sendLine(ctx context.Context, floodControl floodControl, messages chan<- application.MessageResult, sessionID, line string, err error) bool {
+	if err == nil && !admitLine(ctx, floodControl, sessionID) {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case messages <- application.MessageResult{SessionID: sessionID, Message: line, Err: err}:
+		return true
+	}
+}
+
+// floodControl decides what happens to the lines read from a session, it is implemented by application.BasicChatService.
+type floodControl interface {
+	CheckFlood(sessionID string) domain.FloodVerdict
+}
+
+// admitLine reports whether a line read from the session may be handled. Throttled lines are held back,
+// which also stops reading from the connection until the rate limits allow further lines.
+func admitLine(ctx context.Context, floodControl floodControl, sessionID string) bool {
+	verdict := floodControl.CheckFlood(sessionID)
+	switch verdict.Action {
+	case domain.FloodAllow:
+		return true
+	case domain.FloodWarn, domain.FloodThrottle:
+		timer := time.NewTimer(verdict.Wait)
+		defer timer.Stop()
 		select {
 		case <-ctx.Done():
-			return
-		case messages <- application.MessageResult{SessionID: sessionID, Message: line, Err: err}:
+			return false
+		case <-timer.C:
+			return true
 		}
+	default:
+		return false
 	}
 }
 
-// handleWrite is used to write from a channel to a writer.
-func handleWrite(ctx context.Context, writer io.Writer, messages <-chan string) {
+// readLine reads a single line, lines longer than maxLineLength bytes are truncated and the rest of the line is discarded.
+func readLine(reader *bufio.Reader, maxLineLength int) (string, error) {
+	line := make([]byte, 0)
+	for {
+		fragment, err := reader.ReadSlice('\n')
+		if remaining := maxLineLength - len(line); remaining > 0 {
+			line = append(line, fragment[:min(len(fragment), remaining)]...)
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		return strings.ToValidUTF8(string(line), ""), err
+	}
+}
+
+// handleWrite is used to write from a channel to a writer, every message is rendered using render.
+// Once flush is closed the messages left in the channel are written and handleWrite returns.
+// Messages that can not be written are counted in metrics.
+func handleWrite(ctx context.Context, writer io.Writer, messages <-chan domain.OutgoingMessage, render func(domain.OutgoingMessage) string, metrics *serverMetrics, flush <-chan struct{}) {
+	write := func(message domain.OutgoingMessage) {
+		_, err := io.Copy(writer, bytes.NewBuffer([]byte(render(message))))
+		if err != nil {
+			slog.Warn("write error", "err", err)
+			metrics.WriteFailed()
+		}
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case message := <-messages:
-			_, err := io.Copy(writer, bytes.NewBuffer([]byte(message)))
-			if err != nil {
-				slog.Warn("write error", "err", err)
+			write(message)
+		case <-flush:
+			for {
+				select {
+				case message := <-messages:
+					write(message)
+				default:
+					return
+				}
 			}
 		}
 	}
@@ -0,0 +1,39 @@
+package plugin
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReadWrite", func() {
+	Context("#readLine", func() {
+		It("should read lines shorter than the limit completely", func() {
+			reader := bufio.NewReader(strings.NewReader("hello\nworld\n"))
+			line, err := readLine(reader, 10)
+			Expect(err).To(BeNil())
+			Expect(line).To(Equal("hello\n"))
+			line, err = readLine(reader, 10)
+			Expect(err).To(BeNil())
+			Expect(line).To(Equal("world\n"))
+		})
+
+		It("should truncate lines longer than the limit and discard the rest of the line", func() {
+			reader := bufio.NewReaderSize(strings.NewReader(strings.Repeat("a", 100)+"\nnext\n"), 16)
+			line, err := readLine(reader, 10)
+			Expect(err).To(BeNil())
+			Expect(line).To(Equal(strings.Repeat("a", 10)))
+			line, err = readLine(reader, 10)
+			Expect(err).To(BeNil())
+			Expect(line).To(Equal("next\n"))
+		})
+
+		It("should return the error of the reader", func() {
+			_, err := readLine(bufio.NewReader(strings.NewReader("")), 10)
+			Expect(err).To(Equal(io.EOF))
+		})
+	})
+})
@@ -0,0 +1,50 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+)
+
+// renderText renders a message for the plain text protocol, every line of the result ends with a newline.
+func renderText(message domain.OutgoingMessage) string {
+	switch message.Type {
+	case domain.MessageTypeServer, domain.MessageTypeError:
+		return fmt.Sprintf("[server] %s\n", message.Message)
+	case domain.MessageTypeUserList:
+		var lines strings.Builder
+		for _, user := range message.Users {
+			lines.WriteString(fmt.Sprintf("[server] %s\n", describePresence(user)))
+		}
+		return lines.String()
+	case domain.MessageTypeReply:
+		// Only json and irc clients send requests with an id, replies are never sent to text clients.
+		return ""
+	case domain.MessageTypePrivate:
+		if message.Replayed {
+			return fmt.Sprintf("[%s] [p %s -> %s] %s\n", message.Timestamp.Format(time.DateTime), message.SenderName, message.RecipientName, message.Message)
+		}
+		return fmt.Sprintf("[p %s] %s\n", message.SenderName, message.Message)
+	default:
+		if message.Replayed {
+			return fmt.Sprintf("[%s] [%s] %s\n", message.Timestamp.Format(time.DateTime), message.SenderName, message.Message)
+		}
+		return fmt.Sprintf("[%s] %s\n", message.SenderName, message.Message)
+	}
+}
+
+// describePresence renders the status and idle time of a user, e.g. "alice away (lunch), idle 5m0s".
+func describePresence(user domain.UserPresence) string {
+	status := user.Status.String()
+	if user.Reason != "" {
+		status = fmt.Sprintf("%s (%s)", status, user.Reason)
+	}
+	return fmt.Sprintf("%s %s, idle %s", user.Name, status, user.Idle.Truncate(time.Second))
+}
@@ -7,6 +7,7 @@ package plugin
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net"
@@ -14,46 +15,174 @@ import (
 
 	"github.com/benedictweis/tcpchat-server-go/application"
 	"github.com/benedictweis/tcpchat-server-go/application/handlers"
+	"github.com/benedictweis/tcpchat-server-go/config"
 	"github.com/benedictweis/tcpchat-server-go/domain"
 )
 
 type TCPChatServer struct {
-	address net.TCPAddr
+	address        net.TCPAddr
+	config         config.Config
+	userRepository domain.UserRepository
+	banRepository  domain.BanRepository
+	tlsConfig      *tls.Config
+	passwordPolicy application.PasswordPolicy
+	// commandRegistry contains the commands understood by the server.
+	commandRegistry *handlers.CommandRegistry
 }
 
-// NewTCPChatServer creates a new instance of TCPChatServer with an address and a port.
-func NewTCPChatServer(address string, port int) (*TCPChatServer, error) {
-	tcpAddress, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", address, port))
+// NewTCPChatServer creates a new instance of TCPChatServer listening on the address and port given by cfg,
+// users are stored in userRepository and bans in banRepository. The server only accepts connections using TLS if it is enabled in cfg.
+func NewTCPChatServer(cfg config.Config, userRepository domain.UserRepository, banRepository domain.BanRepository) (*TCPChatServer, error) {
+	tcpAddress, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", cfg.Address, cfg.Port))
 	if err != nil {
 		return nil, err
 	}
-	return &TCPChatServer{address: *tcpAddress}, nil
+	tcpChatServer := &TCPChatServer{address: *tcpAddress, config: cfg, userRepository: userRepository, banRepository: banRepository, commandRegistry: handlers.NewDefaultCommandRegistry()}
+	tcpChatServer.passwordPolicy, err = LoadPasswordPolicy(cfg.Passwords)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TLS.Enabled() {
+		tcpChatServer.tlsConfig, err = LoadTLSConfig(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tcpChatServer, nil
+}
+
+// CommandRegistry returns the commands understood by the server, additional commands have to be registered before Start is called.
+func (t *TCPChatServer) CommandRegistry() *handlers.CommandRegistry {
+	return t.commandRegistry
 }
 
 // Start starts the TCPChatServer instance and returns when ctx is Done.
 func (t *TCPChatServer) Start(ctx context.Context) error {
-	slog.Info("starting tcp chat plugin", "address", t.address.String())
-	listener, err := net.ListenTCP("tcp", &t.address)
+	slog.Info("starting tcp chat plugin", "address", t.address.String(), "tls", t.tlsConfig != nil)
+	metrics := newServerMetrics()
+	// The limits are shared by all chat listeners, the admin api and metrics are not limited.
+	limiter := newConnectionLimiter(t.config.Connections.MaxTotal, t.config.Connections.MaxPerHost, metrics)
+	metrics.registerConnectionLimiter(limiter)
+	listener, err := t.listen(ctx, t.address.String(), limiter)
 	if err != nil {
 		return err
 	}
 	defer listener.Close()
+	var webSocketListener net.Listener
+	if t.config.WebSocket.Enabled() {
+		webSocketListener, err = t.listen(ctx, t.config.WebSocket.Address, limiter)
+		if err != nil {
+			return err
+		}
+		defer webSocketListener.Close()
+	}
+	var ircListener net.Listener
+	if t.config.IRC.Enabled() {
+		ircListener, err = t.listen(ctx, t.config.IRC.Address, limiter)
+		if err != nil {
+			return err
+		}
+		defer ircListener.Close()
+	}
 	var activeConnections sync.WaitGroup
-	t.createNecessaryGoroutines(ctx, listener, &activeConnections)
+	chatService := t.createNecessaryGoroutines(ctx, listener, webSocketListener, ircListener, metrics, &activeConnections)
+	if t.config.Metrics.Enabled() {
+		// Metrics are scraped by monitoring systems, so they are always served without tls.
+		metricsListener, err := net.Listen("tcp", t.config.Metrics.Address)
+		if err != nil {
+			return err
+		}
+		defer metricsListener.Close()
+		go serveMetrics(ctx, metricsListener, t.config.Metrics.Path, metrics)
+		slog.Info("metrics are up", "address", metricsListener.Addr().String(), "path", t.config.Metrics.Path)
+	}
+	if t.config.Admin.Enabled() {
+		adminListener, err := t.listen(ctx, t.config.Admin.Address, nil)
+		if err != nil {
+			return err
+		}
+		defer adminListener.Close()
+		go serveAdminAPI(ctx, adminListener, t.config.Admin.Token, chatService)
+		slog.Info("admin api is up", "address", adminListener.Addr().String())
+	}
 	slog.Info("tcp chat is up", "address", t.address.String())
+	if webSocketListener != nil {
+		slog.Info("websocket chat is up", "address", webSocketListener.Addr().String(), "path", t.config.WebSocket.Path)
+	}
+	if ircListener != nil {
+		slog.Info("irc chat is up", "address", ircListener.Addr().String())
+	}
 	<-ctx.Done()
 	slog.Info("context is done, waiting for active connections to be closed", "address", t.address.String())
 	activeConnections.Wait()
-	slog.Info("active connections closed, stopping the plugin", "address", t.address.String())
+	deliveryStats := chatService.DeliveryStats()
+	slog.Info("active connections closed, stopping the plugin", "address", t.address.String(), "droppedMessages", deliveryStats.DroppedMessages.Load(), "disconnectedSlowSessions", deliveryStats.DisconnectedSessions.Load())
 	return nil
 }
 
-func (t *TCPChatServer) createNecessaryGoroutines(ctx context.Context, listener net.Listener, activeConnections *sync.WaitGroup) {
-	messagesRead := make(chan application.MessageResult, 5) // Buffer to allow for bursts when sending messages
+// listen listens on a tcp address using the configured keepalive, connections have to use TLS if it is enabled.
+// Connections exceeding the limits of limiter are closed before the TLS handshake, a nil limiter allows all connections.
+func (t *TCPChatServer) listen(ctx context.Context, address string, limiter *connectionLimiter) (net.Listener, error) {
+	keepAlive := t.config.Connections.KeepAlive
+	listenConfig := net.ListenConfig{KeepAlive: -1}
+	if keepAlive.Idle > 0 {
+		listenConfig.KeepAliveConfig = net.KeepAliveConfig{Enable: true, Idle: keepAlive.Idle, Interval: keepAlive.Interval, Count: keepAlive.Count}
+	}
+	listener, err := listenConfig.Listen(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if limiter != nil {
+		listener = &limitedListener{Listener: listener, limiter: limiter}
+	}
+	if t.tlsConfig != nil {
+		listener = tls.NewListener(listener, t.tlsConfig)
+	}
+	return listener, nil
+}
+
+// createNecessaryGoroutines starts handling connections on listener and on webSocketListener and ircListener if they are
+// not nil, messages from all connections are handled by the returned chat service which records to metrics.
+func (t *TCPChatServer) createNecessaryGoroutines(ctx context.Context, listener net.Listener, webSocketListener net.Listener, ircListener net.Listener, metrics *serverMetrics, activeConnections *sync.WaitGroup) *application.BasicChatService {
+	messagesRead := make(chan application.MessageResult, t.config.Buffers.IncomingMessages) // Buffer to allow for bursts when sending messages
 	sessions := make(chan domain.Session)
 	textMessages := make(chan domain.TextMessage)
 	commands := make(chan domain.Command)
 	go application.ConvertMessages(ctx, messagesRead, textMessages, commands)
-	go handlers.HandleMessages(ctx, sessions, textMessages, commands)
-	go handleConnections(ctx, listener, activeConnections, messagesRead, sessions)
+	chatService := t.newChatService(metrics)
+	metrics.registerChatService(chatService)
+	go handlers.HandleMessages(ctx, chatService, t.commandRegistry, t.config.Processing.Workers, sessions, textMessages, commands)
+	go handleConnections(ctx, listener, t.config, activeConnections, metrics, chatService, messagesRead, sessions, textMessages, commands)
+	if webSocketListener != nil {
+		go handleWebSocketConnections(ctx, webSocketListener, t.config, activeConnections, metrics, chatService, messagesRead, sessions, textMessages, commands)
+	}
+	if ircListener != nil {
+		go handleIRCConnections(ctx, ircListener, t.config, activeConnections, metrics, chatService, sessions, textMessages, commands)
+	}
+	return chatService
+}
+
+// newChatService creates the chat service along with all repositories it needs, it records to metrics.
+func (t *TCPChatServer) newChatService(metrics application.Metrics) *application.BasicChatService {
+	sessionRepository := domain.NewInMemorySessionRepository()
+	userSessionRepository := domain.NewInMemoryUserSessionRepository()
+	roomRepository := domain.NewInMemoryRoomRepository()
+	messageStore := domain.NewInMemoryMessageStore(t.config.History.Capacity)
+	mailboxRepository := domain.NewInMemoryMailboxRepository()
+	loginFailureRepository := domain.NewInMemoryLoginFailureRepository()
+	presenceRepository := domain.NewInMemoryPresenceRepository()
+	rateLimitRepository := domain.NewInMemoryRateLimitRepository()
+	floodOffenseRepository := domain.NewInMemoryFloodOffenseRepository()
+	options := application.DefaultOptions()
+	options.HistoryReplayCount = t.config.History.ReplayOnLogin
+	options.MailboxCapacity = t.config.Limits.MailboxCapacity
+	options.AdminUserNames = t.config.Admins
+	options.UserLockout = domain.LockoutPolicy{MaxFailures: t.config.Lockout.MaxUserFailures, BaseDelay: t.config.Lockout.BaseDelay, Duration: t.config.Lockout.Duration}
+	options.HostLockout = domain.LockoutPolicy{MaxFailures: t.config.Lockout.MaxHostFailures, BaseDelay: t.config.Lockout.BaseDelay, Duration: t.config.Lockout.Duration}
+	options.PasswordPolicy = t.passwordPolicy
+	options.MaxSessionsPerUser = t.config.Sessions.MaxPerUser
+	options.SessionLimitPolicy, _ = domain.SessionLimitPolicyFromString(t.config.Sessions.LimitPolicy)
+	options.FloodPolicy = t.config.Flood.Policy()
+	options.Metrics = metrics
+	return application.NewChatService(sessionRepository, t.userRepository, userSessionRepository, roomRepository, messageStore, mailboxRepository, t.banRepository, loginFailureRepository, presenceRepository, rateLimitRepository, floodOffenseRepository, options)
 }
@@ -0,0 +1,87 @@
+package plugin_test
+
+import (
+	"io"
+
+	"github.com/benedictweis/tcpchat-server-go/config"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sessions", func() {
+	var port int
+
+	start := func(cfg config.Config) {
+		server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+	}
+
+	BeforeEach(func() {
+		port = freePort()
+	})
+
+	It("should log out and in as another user on the same session", func() {
+		start(serverConfig(port))
+		connection, reader := connect(port, "/acc alice "+testPassword, "/acc bob "+testPassword, "/login alice "+testPassword)
+		readLineContaining(reader, "Logged in")
+
+		send(connection, "/login bob "+testPassword)
+		readLineContaining(reader, "you are already logged in as alice, use /logout first")
+
+		send(connection, "/logout")
+		readLineContaining(reader, "Logged out")
+		send(connection, "hello")
+		readLineContaining(reader, "you are not logged in")
+		send(connection, "/logout")
+		readLineContaining(reader, "you are not logged in")
+
+		send(connection, "/login bob "+testPassword)
+		readLineContaining(reader, "Logged in")
+		send(connection, "/info")
+		readLineContaining(reader, "userName:  bob")
+	})
+
+	It("should allow many sessions per user by default", func() {
+		start(serverConfig(port))
+		login(port, "alice")
+		_, secondReader := connect(port, "/login alice "+testPassword)
+		readLineContaining(secondReader, "Logged in")
+	})
+
+	It("should reject logins exceeding the session limit", func() {
+		cfg := serverConfig(port)
+		cfg.Sessions.MaxPerUser = 1
+		start(cfg)
+		first, firstReader := login(port, "alice")
+
+		second, secondReader := connect(port, "/login alice "+testPassword)
+		readLineContaining(secondReader, "you are logged in on too many sessions")
+
+		send(first, "/logout")
+		readLineContaining(firstReader, "Logged out")
+		send(second, "/login alice "+testPassword)
+		readLineContaining(secondReader, "Logged in")
+	})
+
+	It("should replace the oldest session if configured", func() {
+		cfg := serverConfig(port)
+		cfg.Sessions.MaxPerUser = 1
+		cfg.Sessions.LimitPolicy = domain.SessionLimitReplaceOldest.String()
+		start(cfg)
+		_, firstReader := login(port, "alice")
+
+		second, secondReader := connect(port, "/login alice "+testPassword)
+		readLineContaining(secondReader, "Logged in")
+		readLineContaining(firstReader, "You were logged in on another session")
+		Eventually(func() error {
+			_, err := firstReader.ReadString('\n')
+			return err
+		}).Should(MatchError(io.EOF))
+
+		send(second, "/who")
+		Expect(readLineContaining(secondReader, "alice ")).To(HavePrefix("[server] alice online"))
+	})
+})
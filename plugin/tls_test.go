@@ -0,0 +1,146 @@
+package plugin_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/config"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// certificate is a self-signed certificate generated for a single test.
+type certificate struct {
+	certFile string
+	keyFile  string
+	tls      tls.Certificate
+	x509     *x509.Certificate
+}
+
+func generateCertificate(dir, name string) certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(BeNil())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).To(BeNil())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).To(BeNil())
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	Expect(os.WriteFile(certFile, certPEM, 0o600)).To(Succeed())
+	Expect(os.WriteFile(keyFile, keyPEM, 0o600)).To(Succeed())
+	tlsCertificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	Expect(err).To(BeNil())
+	x509Certificate, err := x509.ParseCertificate(der)
+	Expect(err).To(BeNil())
+	return certificate{certFile: certFile, keyFile: keyFile, tls: tlsCertificate, x509: x509Certificate}
+}
+
+var _ = Describe("TLS", func() {
+	var (
+		dir               string
+		serverCertificate certificate
+		rootCAs           *x509.CertPool
+		port              int
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		serverCertificate = generateCertificate(dir, "server")
+		rootCAs = x509.NewCertPool()
+		rootCAs.AddCert(serverCertificate.x509)
+		port = freePort()
+	})
+
+	Context("#LoadTLSConfig", func() {
+		It("should return an error when the certificate does not exist", func() {
+			_, err := plugin.LoadTLSConfig(filepath.Join(dir, "missing.crt"), serverCertificate.keyFile, "")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error when the client ca file contains no certificates", func() {
+			invalidCAFile := filepath.Join(dir, "invalid.crt")
+			Expect(os.WriteFile(invalidCAFile, []byte("no certificate"), 0o600)).To(Succeed())
+			_, err := plugin.LoadTLSConfig(serverCertificate.certFile, serverCertificate.keyFile, invalidCAFile)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when the server uses TLS", func() {
+		BeforeEach(func() {
+			cfg := serverConfig(port)
+			cfg.TLS = config.TLSConfig{CertFile: serverCertificate.certFile, KeyFile: serverCertificate.keyFile}
+			server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+			Expect(err).To(BeNil())
+			startServer(server, port)
+		})
+
+		It("should greet clients connecting using TLS", func() {
+			connection, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port), &tls.Config{RootCAs: rootCAs})
+			Expect(err).To(BeNil())
+			defer connection.Close()
+			line, err := bufio.NewReader(connection).ReadString('\n')
+			Expect(err).To(BeNil())
+			Expect(line).To(Equal("[server] Welcome to this server!\n"))
+		})
+	})
+
+	Context("when the server requires client certificates", func() {
+		var clientCertificate certificate
+
+		BeforeEach(func() {
+			clientCertificate = generateCertificate(dir, "client")
+			cfg := serverConfig(port)
+			cfg.TLS = config.TLSConfig{CertFile: serverCertificate.certFile, KeyFile: serverCertificate.keyFile, ClientCAFile: clientCertificate.certFile}
+			server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+			Expect(err).To(BeNil())
+			startServer(server, port)
+		})
+
+		It("should greet clients presenting a trusted certificate", func() {
+			connection, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port), &tls.Config{RootCAs: rootCAs, Certificates: []tls.Certificate{clientCertificate.tls}})
+			Expect(err).To(BeNil())
+			defer connection.Close()
+			line, err := bufio.NewReader(connection).ReadString('\n')
+			Expect(err).To(BeNil())
+			Expect(line).To(Equal("[server] Welcome to this server!\n"))
+		})
+
+		It("should reject clients without a certificate", func() {
+			connection, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port), &tls.Config{RootCAs: rootCAs})
+			if err == nil {
+				defer connection.Close()
+				_, err = bufio.NewReader(connection).ReadString('\n')
+			}
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
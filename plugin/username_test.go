@@ -0,0 +1,57 @@
+package plugin_test
+
+import (
+	"strings"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("User names", func() {
+	var port int
+
+	BeforeEach(func() {
+		port = freePort()
+		server, err := plugin.NewTCPChatServer(serverConfig(port), domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+	})
+
+	DescribeTable("Choosing user names",
+		func(userName, expectedReply string) {
+			_, reader := connect(port, "/acc alice "+testPassword, "/login alice "+testPassword, "/name "+userName)
+			Expect(readLineContaining(reader, expectedReply)).To(HavePrefix("[server] "))
+		},
+		Entry("When given a name with symbols", "<alice>", "user names may only contain letters, digits"),
+		Entry("When given a name that is too long", strings.Repeat("a", 33), "user names may only contain letters, digits"),
+		Entry("When given a reserved name", "Server", "that user name is reserved"),
+		Entry("When given a valid name", "alicia", "Changed username to alicia"),
+	)
+
+	It("should validate the names of new accounts", func() {
+		_, reader := connect(port, "/acc server "+testPassword)
+		readLineContaining(reader, "that user name is reserved")
+	})
+
+	It("should move the user to the new name and tell the other users", func() {
+		alice, aliceReader := login(port, "alice")
+		bob, bobReader := login(port, "bob")
+
+		send(alice, "/name bob")
+		readLineContaining(aliceReader, "a user with that name already exists")
+
+		send(alice, "/name alicia")
+		readLineContaining(aliceReader, "Changed username to alicia")
+		readLineContaining(bobReader, "alice is now known as alicia")
+
+		send(bob, "/msg alice hi")
+		readLineContaining(bobReader, "your Message partner does not exist")
+		send(bob, "/msg alicia hi")
+		Expect(readLineContaining(aliceReader, "[p bob]")).To(Equal("[p bob] hi\n"))
+
+		_, reader := connect(port, "/acc alice "+testPassword)
+		readLineContaining(reader, "Created new account")
+	})
+})
@@ -0,0 +1,117 @@
+// Copyright (c) 2024 Benedict Weis. All rights reserved.
+//
+// This work is licensed under the terms of the MIT license.
+// For a copy, see <https://opensource.org/licenses/MIT>.
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/application"
+	"github.com/benedictweis/tcpchat-server-go/config"
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/gorilla/websocket"
+)
+
+// webSocketCloseTimeout is the time waited for a close frame to be sent before the connection is closed.
+const webSocketCloseTimeout = time.Second
+
+// handleWebSocketConnections serves websocket connections on listener, every connection is handled just like a tcp connection.
+func handleWebSocketConnections(ctx context.Context, listener net.Listener, cfg config.Config, activeConnections *sync.WaitGroup, metrics *serverMetrics, floodControl floodControl, messagesRead chan<- application.MessageResult, sessions chan<- domain.Session, textMessages chan<- domain.TextMessage, commands chan<- domain.Command) {
+	upgrader := websocket.Upgrader{CheckOrigin: checkOrigin(cfg.WebSocket.AllowedOrigins)}
+	mux := http.NewServeMux()
+	mux.HandleFunc(cfg.WebSocket.Path, func(w http.ResponseWriter, r *http.Request) {
+		connection, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			slog.Warn("failed to upgrade websocket connection", "remoteAddr", r.RemoteAddr, "err", err)
+			return
+		}
+		handleConnection(ctx, newWebSocketConnection(connection), cfg, activeConnections, metrics, floodControl, sessions, messagesRead, textMessages, commands)
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	err := server.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("websocket server stopped", "err", err)
+	}
+}
+
+// checkOrigin only allows the origins in allowedOrigins, "*" allows every origin.
+// Requests from the same origin and requests without an origin (non browser clients) are always allowed.
+func checkOrigin(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || slices.Contains(allowedOrigins, "*") || slices.Contains(allowedOrigins, origin) {
+			return true
+		}
+		return strings.TrimPrefix(strings.TrimPrefix(origin, "https://"), "http://") == r.Host
+	}
+}
+
+// webSocketConnection adapts a websocket connection to a net.Conn, every received message is read as a
+// single line and every write is sent as a single text message.
+type webSocketConnection struct {
+	*websocket.Conn
+	reader io.Reader
+}
+
+func newWebSocketConnection(connection *websocket.Conn) *webSocketConnection {
+	return &webSocketConnection{Conn: connection}
+}
+
+func (w *webSocketConnection) Read(p []byte) (int, error) {
+	for {
+		if w.reader == nil {
+			_, reader, err := w.NextReader()
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, err
+			}
+			w.reader = io.MultiReader(reader, strings.NewReader("\n"))
+		}
+		n, err := w.reader.Read(p)
+		if errors.Is(err, io.EOF) {
+			w.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (w *webSocketConnection) Write(p []byte) (int, error) {
+	err := w.WriteMessage(websocket.TextMessage, bytes.TrimSuffix(p, []byte("\n")))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *webSocketConnection) SetDeadline(t time.Time) error {
+	return errors.Join(w.SetReadDeadline(t), w.SetWriteDeadline(t))
+}
+
+// Close sends a close frame before closing the underlying connection.
+func (w *webSocketConnection) Close() error {
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	_ = w.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(webSocketCloseTimeout))
+	return w.Conn.Close()
+}
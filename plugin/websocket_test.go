@@ -0,0 +1,87 @@
+package plugin_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/benedictweis/tcpchat-server-go/domain"
+	"github.com/benedictweis/tcpchat-server-go/plugin"
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebSocket", func() {
+	var (
+		port          int
+		webSocketPort int
+		webSocketURL  string
+	)
+
+	BeforeEach(func() {
+		port = freePort()
+		webSocketPort = freePort()
+		webSocketURL = fmt.Sprintf("ws://127.0.0.1:%d/chat", webSocketPort)
+		cfg := serverConfig(port)
+		cfg.WebSocket.Address = fmt.Sprintf("127.0.0.1:%d", webSocketPort)
+		cfg.WebSocket.Path = "/chat"
+		server, err := plugin.NewTCPChatServer(cfg, domain.NewInMemoryUserRepository(), domain.NewInMemoryBanRepository())
+		Expect(err).To(BeNil())
+		startServer(server, port)
+		waitUntilListening(webSocketPort)
+	})
+
+	dialWebSocket := func(header http.Header) (*websocket.Conn, error) {
+		connection, _, err := websocket.DefaultDialer.Dial(webSocketURL, header)
+		if err != nil {
+			return nil, err
+		}
+		DeferCleanup(connection.Close)
+		return connection, nil
+	}
+
+	readWebSocketMessage := func(connection *websocket.Conn) string {
+		Expect(connection.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+		_, message, err := connection.ReadMessage()
+		Expect(err).To(BeNil())
+		return string(message)
+	}
+
+	readWebSocketMessageContaining := func(connection *websocket.Conn, substring string) string {
+		for {
+			if message := readWebSocketMessage(connection); strings.Contains(message, substring) {
+				return message
+			}
+		}
+	}
+
+	It("should greet websocket clients with a message per line", func() {
+		connection, err := dialWebSocket(nil)
+		Expect(err).To(BeNil())
+		Expect(readWebSocketMessage(connection)).To(Equal("[server] Welcome to this server!"))
+	})
+
+	It("should let websocket and tcp clients chat with each other", func() {
+		webSocketConnection, err := dialWebSocket(nil)
+		Expect(err).To(BeNil())
+
+		for _, message := range []string{"/acc alice " + testPassword, "/login alice " + testPassword} {
+			Expect(webSocketConnection.WriteMessage(websocket.TextMessage, []byte(message))).To(Succeed())
+		}
+		readWebSocketMessageContaining(webSocketConnection, "Logged in")
+		tcpConnection, tcpReader := login(port, "bob")
+
+		send(tcpConnection, "hello from tcp")
+		Expect(readWebSocketMessageContaining(webSocketConnection, "hello")).To(Equal("[bob] hello from tcp"))
+
+		Expect(webSocketConnection.WriteMessage(websocket.TextMessage, []byte("hello from websocket"))).To(Succeed())
+		Expect(readLineContaining(tcpReader, "hello")).To(Equal("[alice] hello from websocket\n"))
+	})
+
+	It("should reject browsers from other origins", func() {
+		_, err := dialWebSocket(http.Header{"Origin": []string{"https://evil.example"}})
+		Expect(err).To(MatchError(websocket.ErrBadHandshake))
+	})
+})
@@ -7,13 +7,19 @@ package test
 
 const (
 	SESSION_ID_A = "1234"
+	SESSION_ID_B = "5678"
 
 	USER_NAME_A              = "max"
 	USER_PASSWORD_A          = "1234"
 	USER_NAME_B              = "maria"
 	USER_PASSWORD_B          = "password"
+	USER_NAME_C              = "moritz"
 	USER_PASSWORD_X_TOO_LONG = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
 
+	ROOM_NAME_A          = "golang"
+	ROOM_NAME_A_PREFIXED = "#golang"
+	ROOM_NAME_INVALID    = "no spaces allowed"
+
 	TEXT_MESSAGE_A = "hi, this is a text message"
 
 	UNKNOWN_ERROR_TEXT = "unknown error occurred"